@@ -0,0 +1,233 @@
+package node
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/accounts"
+	"github.com/Cryptochain-VON/common"
+	"github.com/Cryptochain-VON/core/types"
+	"github.com/Cryptochain-VON/event"
+	"github.com/Cryptochain-VON/log"
+)
+const (
+	AuditWalletOpened   = "wallet-opened"
+	AuditAccountDerived = "account-derived"
+	AuditSignRequested  = "sign-requested"
+)
+type AccountAuditEvent struct {
+	Time    time.Time       `json:"time"`
+	Action  string          `json:"action"`
+	Wallet  string          `json:"wallet"`
+	Account *common.Address `json:"account,omitempty"`
+	Detail  string          `json:"detail,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+type accountAuditor struct {
+	mux   *event.TypeMux
+	clock Clock
+	log   log.Logger
+	lock  sync.Mutex
+	file  *os.File
+	sub   event.Subscription
+}
+func newAccountAuditor(conf *Config, mux *event.TypeMux) (*accountAuditor, error) {
+	if !conf.AccountAudit && conf.AccountAuditLog == "" {
+		return nil, nil
+	}
+	a := &accountAuditor{mux: mux, clock: conf.clock(), log: conf.logger()}
+	var path string
+	if conf.AccountAuditLog != "" {
+		path = conf.ResolvePath(conf.AccountAuditLog)
+	}
+	if conf.AccountAuditLog != "" && path == "" {
+		a.log.Warn("Account audit log needs a datadir or absolute path, logging to event bus only", "path", conf.AccountAuditLog)
+	}
+	if path != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		a.file = file
+	}
+	return a, nil
+}
+func (a *accountAuditor) record(action string, wallet accounts.Wallet, account *accounts.Account, detail string, err error) {
+	ev := AccountAuditEvent{Time: a.clock.Now(), Action: action, Wallet: wallet.URL().String(), Detail: detail}
+	if account != nil {
+		addr := account.Address
+		ev.Account = &addr
+	}
+	if err != nil {
+		ev.Error = err.Error()
+	}
+	a.mux.Post(ev)
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.file == nil {
+		return
+	}
+	blob, _ := json.Marshal(ev)
+	if _, err := a.file.Write(append(blob, '\n')); err != nil {
+		a.log.Warn("Failed to write account audit log", "err", err)
+	}
+}
+func (a *accountAuditor) watch(am *accounts.Manager) {
+	if a == nil {
+		return
+	}
+	events := make(chan accounts.WalletEvent, 16)
+	sub := am.Subscribe(events)
+	a.lock.Lock()
+	a.sub = sub
+	a.lock.Unlock()
+	go func() {
+		for {
+			select {
+			case ev := <-events:
+				if _, audited := ev.Wallet.(*auditWallet); !audited && ev.Kind == accounts.WalletOpened {
+					a.record(AuditWalletOpened, ev.Wallet, nil, "", nil)
+				}
+			case <-sub.Err():
+				return
+			}
+		}
+	}()
+}
+func (a *accountAuditor) close() error {
+	if a == nil {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.sub != nil {
+		a.sub.Unsubscribe()
+		a.sub = nil
+	}
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+	return err
+}
+func (a *accountAuditor) wrap(backend accounts.Backend) accounts.Backend {
+	if a == nil {
+		return backend
+	}
+	return &auditBackend{Backend: backend, audit: a, wallets: make(map[accounts.Wallet]*auditWallet)}
+}
+func (a *accountAuditor) wrapWallet(wallet accounts.Wallet) accounts.Wallet {
+	if _, audited := wallet.(*auditWallet); a == nil || audited {
+		return wallet
+	}
+	return &auditWallet{Wallet: wallet, audit: a, watched: true}
+}
+func (n *Node) AuditedWallet(account accounts.Account) (accounts.Wallet, error) {
+	wallet, err := n.accman.Find(account)
+	if err != nil {
+		return nil, err
+	}
+	return n.accountAudit.wrapWallet(wallet), nil
+}
+type auditBackend struct {
+	accounts.Backend
+	audit   *accountAuditor
+	lock    sync.Mutex
+	wallets map[accounts.Wallet]*auditWallet
+}
+func (b *auditBackend) wrapWallet(wallet accounts.Wallet, drop bool) accounts.Wallet {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	wrapped, ok := b.wallets[wallet]
+	if !ok {
+		wrapped = &auditWallet{Wallet: wallet, audit: b.audit}
+		b.wallets[wallet] = wrapped
+	}
+	if drop {
+		delete(b.wallets, wallet)
+	}
+	return wrapped
+}
+func (b *auditBackend) Wallets() []accounts.Wallet {
+	wallets := b.Backend.Wallets()
+	wrapped := make([]accounts.Wallet, len(wallets))
+	for i, wallet := range wallets {
+		wrapped[i] = b.wrapWallet(wallet, false)
+	}
+	return wrapped
+}
+func (b *auditBackend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	events := make(chan accounts.WalletEvent, 16)
+	inner := b.Backend.Subscribe(events)
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer inner.Unsubscribe()
+		for {
+			select {
+			case ev := <-events:
+				ev.Wallet = b.wrapWallet(ev.Wallet, ev.Kind == accounts.WalletDropped)
+				select {
+				case sink <- ev:
+				case <-quit:
+					return nil
+				}
+			case err := <-inner.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	})
+}
+type auditWallet struct {
+	accounts.Wallet
+	audit   *accountAuditor
+	watched bool
+}
+func (w *auditWallet) Open(passphrase string) error {
+	err := w.Wallet.Open(passphrase)
+	if !w.watched || err != nil {
+		w.audit.record(AuditWalletOpened, w.Wallet, nil, "", err)
+	}
+	return err
+}
+func (w *auditWallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	account, err := w.Wallet.Derive(path, pin)
+	w.audit.record(AuditAccountDerived, w.Wallet, &account, path.String(), err)
+	return account, err
+}
+func (w *auditWallet) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+	sig, err := w.Wallet.SignData(account, mimeType, data)
+	w.audit.record(AuditSignRequested, w.Wallet, &account, "data "+mimeType, err)
+	return sig, err
+}
+func (w *auditWallet) SignDataWithPassphrase(account accounts.Account, passphrase, mimeType string, data []byte) ([]byte, error) {
+	sig, err := w.Wallet.SignDataWithPassphrase(account, passphrase, mimeType, data)
+	w.audit.record(AuditSignRequested, w.Wallet, &account, "data "+mimeType+" with passphrase", err)
+	return sig, err
+}
+func (w *auditWallet) SignText(account accounts.Account, text []byte) ([]byte, error) {
+	sig, err := w.Wallet.SignText(account, text)
+	w.audit.record(AuditSignRequested, w.Wallet, &account, "text", err)
+	return sig, err
+}
+func (w *auditWallet) SignTextWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	sig, err := w.Wallet.SignTextWithPassphrase(account, passphrase, hash)
+	w.audit.record(AuditSignRequested, w.Wallet, &account, "text with passphrase", err)
+	return sig, err
+}
+func (w *auditWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signed, err := w.Wallet.SignTx(account, tx, chainID)
+	w.audit.record(AuditSignRequested, w.Wallet, &account, "tx "+tx.Hash().Hex(), err)
+	return signed, err
+}
+func (w *auditWallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	signed, err := w.Wallet.SignTxWithPassphrase(account, passphrase, tx, chainID)
+	w.audit.record(AuditSignRequested, w.Wallet, &account, "tx "+tx.Hash().Hex()+" with passphrase", err)
+	return signed, err
+}
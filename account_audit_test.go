@@ -0,0 +1,245 @@
+package node
+import (
+	"bufio"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	ethereum "github.com/Cryptochain-VON"
+	"github.com/Cryptochain-VON/accounts"
+	"github.com/Cryptochain-VON/accounts/keystore"
+	"github.com/Cryptochain-VON/common"
+	"github.com/Cryptochain-VON/core/types"
+	"github.com/Cryptochain-VON/event"
+)
+type testWallet struct {
+	url     accounts.URL
+	account accounts.Account
+	feed    *event.Feed
+}
+func (w *testWallet) URL() accounts.URL           { return w.url }
+func (w *testWallet) Status() (string, error)     { return "ok", nil }
+func (w *testWallet) Close() error                { return nil }
+func (w *testWallet) Accounts() []accounts.Account { return []accounts.Account{w.account} }
+func (w *testWallet) Open(passphrase string) error {
+	w.feed.Send(accounts.WalletEvent{Wallet: w, Kind: accounts.WalletOpened})
+	return nil
+}
+func (w *testWallet) Contains(account accounts.Account) bool {
+	return account.Address == w.account.Address
+}
+func (w *testWallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return w.account, nil
+}
+func (w *testWallet) SelfDerive(bases []accounts.DerivationPath, chain ethereum.ChainStateReader) {}
+func (w *testWallet) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+	return []byte{1}, nil
+}
+func (w *testWallet) SignDataWithPassphrase(account accounts.Account, passphrase, mimeType string, data []byte) ([]byte, error) {
+	return []byte{1}, nil
+}
+func (w *testWallet) SignText(account accounts.Account, text []byte) ([]byte, error) {
+	return []byte{1}, nil
+}
+func (w *testWallet) SignTextWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	return []byte{1}, nil
+}
+func (w *testWallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return tx, nil
+}
+func (w *testWallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return tx, nil
+}
+type testBackend struct {
+	wallet *testWallet
+	feed   event.Feed
+}
+func newTestBackend(name string) *testBackend {
+	b := new(testBackend)
+	b.wallet = &testWallet{
+		url:     accounts.URL{Scheme: "test", Path: name},
+		account: accounts.Account{Address: common.BytesToAddress([]byte(name)), URL: accounts.URL{Scheme: "test", Path: name}},
+		feed:    &b.feed,
+	}
+	return b
+}
+func (b *testBackend) Wallets() []accounts.Wallet { return []accounts.Wallet{b.wallet} }
+func (b *testBackend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return b.feed.Subscribe(sink)
+}
+func collectAuditEvents(mux *event.TypeMux) (chan AccountAuditEvent, func()) {
+	sub := mux.Subscribe(AccountAuditEvent{})
+	events := make(chan AccountAuditEvent, 16)
+	go func() {
+		for ev := range sub.Chan() {
+			events <- ev.Data.(AccountAuditEvent)
+		}
+	}()
+	return events, sub.Unsubscribe
+}
+func expectAuditEvent(t *testing.T, events chan AccountAuditEvent, action, wallet string) {
+	t.Helper()
+	select {
+	case ev := <-events:
+		if ev.Action != action || ev.Wallet != wallet {
+			t.Fatalf("audit event mismatch: have %s on %s, want %s on %s", ev.Action, ev.Wallet, action, wallet)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("no %s audit event recorded", action)
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected extra audit event: %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+func expectNoAuditEvent(t *testing.T, events chan AccountAuditEvent) {
+	t.Helper()
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected audit event: %+v", ev)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+var auditOperations = []struct {
+	name   string
+	action string
+	run    func(accounts.Wallet, accounts.Account) error
+}{
+	{"open", AuditWalletOpened, func(w accounts.Wallet, a accounts.Account) error { return w.Open("") }},
+	{"derive", AuditAccountDerived, func(w accounts.Wallet, a accounts.Account) error {
+		_, err := w.Derive(accounts.DerivationPath{0}, false)
+		return err
+	}},
+	{"sign data", AuditSignRequested, func(w accounts.Wallet, a accounts.Account) error {
+		_, err := w.SignData(a, accounts.MimetypeTypedData, []byte("data"))
+		return err
+	}},
+	{"sign text with passphrase", AuditSignRequested, func(w accounts.Wallet, a accounts.Account) error {
+		_, err := w.SignTextWithPassphrase(a, "pass", []byte("text"))
+		return err
+	}},
+	{"sign tx", AuditSignRequested, func(w accounts.Wallet, a accounts.Account) error {
+		_, err := w.SignTx(a, types.NewTransaction(0, common.Address{}, big.NewInt(0), 0, big.NewInt(0), nil), big.NewInt(1))
+		return err
+	}},
+}
+func TestAccountAuditKeepsBackendTypes(t *testing.T) {
+	conf := testNodeConfig()
+	conf.DataDir = testDataDir(t)
+	conf.AccountAudit = true
+	conf.NoUSB = true
+	stack, err := New(conf)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	defer stack.Close()
+	backends := stack.AccountManager().Backends(keystore.KeyStoreType)
+	if len(backends) != 1 {
+		t.Fatalf("keystore backend count mismatch: have %d, want 1", len(backends))
+	}
+	if _, ok := backends[0].(*keystore.KeyStore); !ok {
+		t.Fatalf("keystore backend type mismatch: have %T", backends[0])
+	}
+}
+func TestAccountAuditRuntimeBackend(t *testing.T) {
+	conf := testNodeConfig()
+	conf.DataDir = testDataDir(t)
+	conf.AccountAudit = true
+	conf.NoUSB = true
+	stack, err := New(conf)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	defer stack.Close()
+	events, unsubscribe := collectAuditEvents(stack.EventMux())
+	defer unsubscribe()
+	backend := newTestBackend("runtime")
+	if err := stack.AddAccountBackend("runtime", backend); err != nil {
+		t.Fatalf("failed to attach backend: %v", err)
+	}
+	var wallet accounts.Wallet
+	for i := 0; i < 100 && wallet == nil; i++ {
+		wallet, _ = stack.AccountManager().Wallet(backend.wallet.url.String())
+		time.Sleep(10 * time.Millisecond)
+	}
+	if wallet == nil {
+		t.Fatalf("attached wallet not visible in account manager")
+	}
+	for _, op := range auditOperations {
+		t.Run(op.name, func(t *testing.T) {
+			if err := op.run(wallet, backend.wallet.account); err != nil {
+				t.Fatalf("operation failed: %v", err)
+			}
+			expectAuditEvent(t, events, op.action, backend.wallet.url.String())
+		})
+	}
+}
+func TestAccountAuditRegisteredBackend(t *testing.T) {
+	mux := new(event.TypeMux)
+	events, unsubscribe := collectAuditEvents(mux)
+	defer unsubscribe()
+	audit, err := newAccountAuditor(&Config{AccountAudit: true}, mux)
+	if err != nil {
+		t.Fatalf("failed to create auditor: %v", err)
+	}
+	backend := newTestBackend("registered")
+	am := accounts.NewManager(&accounts.Config{}, backend)
+	defer am.Close()
+	audit.watch(am)
+	defer audit.close()
+	url := backend.wallet.url.String()
+	for _, op := range auditOperations {
+		t.Run(op.name, func(t *testing.T) {
+			if err := op.run(backend.wallet, backend.wallet.account); err != nil {
+				t.Fatalf("operation failed: %v", err)
+			}
+			if op.action == AuditWalletOpened {
+				expectAuditEvent(t, events, op.action, url)
+			} else {
+				expectNoAuditEvent(t, events)
+			}
+			if err := op.run(audit.wrapWallet(backend.wallet), backend.wallet.account); err != nil {
+				t.Fatalf("audited operation failed: %v", err)
+			}
+			expectAuditEvent(t, events, op.action, url)
+		})
+	}
+}
+func TestAccountAuditLog(t *testing.T) {
+	conf := testNodeConfig()
+	conf.DataDir = testDataDir(t)
+	conf.AccountAuditLog = "audit.log"
+	conf.NoUSB = true
+	stack, err := New(conf)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	backend := newTestBackend("logged")
+	if err := stack.AddAccountBackend("logged", backend); err != nil {
+		t.Fatalf("failed to attach backend: %v", err)
+	}
+	wallet := stack.accountAudit.wrapWallet(backend.wallet)
+	if _, err := wallet.SignText(backend.wallet.account, []byte("text")); err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	stack.Close()
+	file, err := os.Open(filepath.Join(conf.DataDir, conf.Name, "audit.log"))
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+	var logged []AccountAuditEvent
+	for scanner := bufio.NewScanner(file); scanner.Scan(); {
+		var ev AccountAuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil {
+			t.Fatalf("invalid audit log line %q: %v", scanner.Text(), err)
+		}
+		logged = append(logged, ev)
+	}
+	if len(logged) != 1 || logged[0].Action != AuditSignRequested || logged[0].Account == nil || *logged[0].Account != backend.wallet.account.Address {
+		t.Fatalf("audit log mismatch: have %+v", logged)
+	}
+}
@@ -0,0 +1,160 @@
+package node
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"github.com/Cryptochain-VON/accounts"
+	"github.com/Cryptochain-VON/accounts/external"
+	"github.com/Cryptochain-VON/accounts/scwallet"
+	"github.com/Cryptochain-VON/accounts/usbwallet"
+	"github.com/Cryptochain-VON/event"
+)
+type hotBackend struct {
+	lock     sync.Mutex
+	backends map[string]accounts.Backend
+	subs     map[string]event.Subscription
+	order    []string
+	feed     event.Feed
+	scope    event.SubscriptionScope
+}
+func newHotBackend() *hotBackend {
+	return &hotBackend{
+		backends: make(map[string]accounts.Backend),
+		subs:     make(map[string]event.Subscription),
+	}
+}
+func (b *hotBackend) Wallets() []accounts.Wallet {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var wallets []accounts.Wallet
+	for _, name := range b.order {
+		wallets = append(wallets, b.backends[name].Wallets()...)
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].URL().String() < wallets[j].URL().String() })
+	return wallets
+}
+func (b *hotBackend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	return b.scope.Track(b.feed.Subscribe(sink))
+}
+func (b *hotBackend) attach(name string, backend accounts.Backend) error {
+	b.lock.Lock()
+	if _, ok := b.backends[name]; ok {
+		b.lock.Unlock()
+		return ErrBackendExists
+	}
+	events := make(chan accounts.WalletEvent, 16)
+	inner := backend.Subscribe(events)
+	sub := event.NewSubscription(func(quit <-chan struct{}) error {
+		defer inner.Unsubscribe()
+		for {
+			select {
+			case ev := <-events:
+				b.feed.Send(ev)
+			case err := <-inner.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	})
+	b.backends[name] = backend
+	b.subs[name] = sub
+	b.order = append(b.order, name)
+	b.lock.Unlock()
+	for _, wallet := range backend.Wallets() {
+		b.feed.Send(accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletArrived})
+	}
+	return nil
+}
+func (b *hotBackend) detach(name string) error {
+	b.lock.Lock()
+	backend, ok := b.backends[name]
+	if !ok {
+		b.lock.Unlock()
+		return ErrBackendUnknown
+	}
+	sub := b.subs[name]
+	delete(b.subs, name)
+	delete(b.backends, name)
+	for i, n := range b.order {
+		if n == name {
+			b.order = append(b.order[:i], b.order[i+1:]...)
+			break
+		}
+	}
+	b.lock.Unlock()
+	sub.Unsubscribe()
+	for _, wallet := range backend.Wallets() {
+		b.feed.Send(accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletDropped})
+	}
+	return nil
+}
+func (b *hotBackend) lookup(name string) (accounts.Backend, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	backend, ok := b.backends[name]
+	if !ok {
+		return nil, ErrBackendUnknown
+	}
+	return backend, nil
+}
+func (b *hotBackend) backendsOf(kind reflect.Type) []accounts.Backend {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var backends []accounts.Backend
+	for _, name := range b.order {
+		if reflect.TypeOf(b.backends[name]) == kind {
+			backends = append(backends, b.backends[name])
+		}
+	}
+	return backends
+}
+func (b *hotBackend) names() []string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return append([]string{}, b.order...)
+}
+func (b *hotBackend) close() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.scope.Close()
+	for _, sub := range b.subs {
+		sub.Unsubscribe()
+	}
+}
+func newAccountBackend(kind, arg, keydir string) (accounts.Backend, error) {
+	switch kind {
+	case "ledger":
+		return usbwallet.NewLedgerHub()
+	case "trezor-hid":
+		return usbwallet.NewTrezorHubWithHID()
+	case "trezor-webusb":
+		return usbwallet.NewTrezorHubWithWebUSB()
+	case "smartcard":
+		if arg == "" {
+			return nil, errors.New("smartcard backend requires a daemon path")
+		}
+		return scwallet.NewHub(arg, scwallet.Scheme, keydir)
+	case "external":
+		if arg == "" {
+			return nil, errors.New("external backend requires a signer URL")
+		}
+		return external.NewExternalBackend(arg)
+	default:
+		return nil, fmt.Errorf("unsupported account backend kind %q", kind)
+	}
+}
+func (n *Node) AddAccountBackend(name string, backend accounts.Backend) error {
+	return n.accountBackends.attach(name, backend)
+}
+func (n *Node) RemoveAccountBackend(name string) error {
+	return n.accountBackends.detach(name)
+}
+func (n *Node) AccountBackendsByType(kind reflect.Type) []accounts.Backend {
+	return append(n.accman.Backends(kind), n.accountBackends.backendsOf(kind)...)
+}
+func (n *Node) AccountBackends() []string {
+	return n.accountBackends.names()
+}
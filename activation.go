@@ -0,0 +1,76 @@
+package node
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"github.com/Cryptochain-VON/log"
+)
+const listenFdsStart = 3
+var (
+	activatedOnce      sync.Once
+	activatedLock      sync.Mutex
+	activatedListeners []net.Listener
+)
+func loadActivatedListeners() {
+	if pid, err := strconv.Atoi(os.Getenv("LISTEN_PID")); err == nil && pid != os.Getpid() {
+		return
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	for i := 0; i < count; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(listenFdsStart+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		file := os.NewFile(uintptr(listenFdsStart+i), name)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			log.Warn("Ignoring inherited file descriptor", "fd", listenFdsStart+i, "name", name, "err", err)
+			continue
+		}
+		log.Info("Inherited activated listener", "fd", listenFdsStart+i, "name", name, "addr", listener.Addr())
+		activatedListeners = append(activatedListeners, listener)
+	}
+}
+func takeActivatedListener(network, endpoint string) net.Listener {
+	activatedOnce.Do(loadActivatedListeners)
+	activatedLock.Lock()
+	defer activatedLock.Unlock()
+	for i, listener := range activatedListeners {
+		if listener.Addr().Network() != network || !sameListenAddr(network, listener.Addr().String(), endpoint) {
+			continue
+		}
+		activatedListeners = append(activatedListeners[:i], activatedListeners[i+1:]...)
+		return listener
+	}
+	return nil
+}
+func sameListenAddr(network, bound, endpoint string) bool {
+	if network == "unix" {
+		return bound == endpoint
+	}
+	have, err := net.ResolveTCPAddr("tcp", bound)
+	if err != nil {
+		return false
+	}
+	want, err := net.ResolveTCPAddr("tcp", endpoint)
+	if err != nil || want.Port != have.Port {
+		return false
+	}
+	return want.IP == nil || (want.IP.IsUnspecified() && have.IP.IsUnspecified()) || want.IP.Equal(have.IP)
+}
+func listen(network, endpoint string) (net.Listener, error) {
+	if listener := takeActivatedListener(network, endpoint); listener != nil {
+		return listener, nil
+	}
+	return net.Listen(network, endpoint)
+}
@@ -3,6 +3,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 	"github.com/Cryptochain-VON/common/hexutil"
 	"github.com/Cryptochain-VON/crypto"
 	"github.com/Cryptochain-VON/p2p"
@@ -16,9 +17,9 @@ func NewPrivateAdminAPI(node *Node) *PrivateAdminAPI {
 	return &PrivateAdminAPI{node: node}
 }
 func (api *PrivateAdminAPI) AddPeer(url string) (bool, error) {
-	server := api.node.Server()
-	if server == nil {
-		return false, ErrNodeStopped
+	server, err := api.node.p2pServer()
+	if err != nil {
+		return false, err
 	}
 	node, err := enode.Parse(enode.ValidSchemes, url)
 	if err != nil {
@@ -28,9 +29,9 @@ func (api *PrivateAdminAPI) AddPeer(url string) (bool, error) {
 	return true, nil
 }
 func (api *PrivateAdminAPI) RemovePeer(url string) (bool, error) {
-	server := api.node.Server()
-	if server == nil {
-		return false, ErrNodeStopped
+	server, err := api.node.p2pServer()
+	if err != nil {
+		return false, err
 	}
 	node, err := enode.Parse(enode.ValidSchemes, url)
 	if err != nil {
@@ -40,9 +41,9 @@ func (api *PrivateAdminAPI) RemovePeer(url string) (bool, error) {
 	return true, nil
 }
 func (api *PrivateAdminAPI) AddTrustedPeer(url string) (bool, error) {
-	server := api.node.Server()
-	if server == nil {
-		return false, ErrNodeStopped
+	server, err := api.node.p2pServer()
+	if err != nil {
+		return false, err
 	}
 	node, err := enode.Parse(enode.ValidSchemes, url)
 	if err != nil {
@@ -52,9 +53,9 @@ func (api *PrivateAdminAPI) AddTrustedPeer(url string) (bool, error) {
 	return true, nil
 }
 func (api *PrivateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
-	server := api.node.Server()
-	if server == nil {
-		return false, ErrNodeStopped
+	server, err := api.node.p2pServer()
+	if err != nil {
+		return false, err
 	}
 	node, err := enode.Parse(enode.ValidSchemes, url)
 	if err != nil {
@@ -63,16 +64,77 @@ func (api *PrivateAdminAPI) RemoveTrustedPeer(url string) (bool, error) {
 	server.RemoveTrustedPeer(node)
 	return true, nil
 }
+type PeerOpResult struct {
+	Enode string `json:"enode"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+func (api *PrivateAdminAPI) batchPeerOp(urls []string, op func(*p2p.Server, *enode.Node)) ([]PeerOpResult, error) {
+	server, err := api.node.p2pServer()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]PeerOpResult, len(urls))
+	for i, url := range urls {
+		results[i].Enode = url
+		node, err := enode.Parse(enode.ValidSchemes, url)
+		if err != nil {
+			results[i].Error = fmt.Sprintf("invalid enode: %v", err)
+			continue
+		}
+		op(server, node)
+		results[i].OK = true
+	}
+	return results, nil
+}
+func (api *PrivateAdminAPI) AddPeers(urls []string) ([]PeerOpResult, error) {
+	return api.batchPeerOp(urls, (*p2p.Server).AddPeer)
+}
+func (api *PrivateAdminAPI) RemovePeers(urls []string) ([]PeerOpResult, error) {
+	return api.batchPeerOp(urls, (*p2p.Server).RemovePeer)
+}
+func (api *PrivateAdminAPI) AddTrustedPeers(urls []string) ([]PeerOpResult, error) {
+	return api.batchPeerOp(urls, (*p2p.Server).AddTrustedPeer)
+}
+func (api *PrivateAdminAPI) RemoveTrustedPeers(urls []string) ([]PeerOpResult, error) {
+	return api.batchPeerOp(urls, (*p2p.Server).RemoveTrustedPeer)
+}
+func (api *PrivateAdminAPI) PeerHistory(since *int64) []PeerHistoryEvent {
+	var t time.Time
+	if since != nil {
+		t = time.Unix(*since, 0)
+	}
+	return api.node.PeerHistory(t)
+}
+func (api *PrivateAdminAPI) AnnotatePeer(url string, labels []string, note *string) (*PeerAnnotation, error) {
+	id, err := enode.ParseID(url)
+	if err != nil {
+		node, perr := enode.Parse(enode.ValidSchemes, url)
+		if perr != nil {
+			return nil, fmt.Errorf("invalid peer id or enode: %v", perr)
+		}
+		id = node.ID()
+	}
+	text := ""
+	if note != nil {
+		text = *note
+	}
+	return api.node.AnnotatePeer(id, labels, text)
+}
+func (api *PrivateAdminAPI) PeerAnnotations() map[enode.ID]PeerAnnotation {
+	return api.node.PeerAnnotations()
+}
 func (api *PrivateAdminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription, error) {
-	server := api.node.Server()
-	if server == nil {
-		return nil, ErrNodeStopped
+	server, stopped, err := api.node.p2pSession()
+	if err != nil {
+		return nil, err
 	}
 	notifier, supported := rpc.NotifierFromContext(ctx)
 	if !supported {
 		return nil, rpc.ErrNotificationsUnsupported
 	}
 	rpcSub := notifier.CreateSubscription()
+	buffer := api.node.NewSubscriptionBuffer(notifier, rpcSub)
 	go func() {
 		events := make(chan *p2p.PeerEvent)
 		sub := server.SubscribeEvents(events)
@@ -80,12 +142,13 @@ func (api *PrivateAdminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription,
 		for {
 			select {
 			case event := <-events:
-				notifier.Notify(rpcSub.ID, event)
-			case <-sub.Err():
+				buffer.Send(event)
+			case <-stopped:
+				buffer.End(ErrP2PStopped)
 				return
-			case <-rpcSub.Err():
+			case <-sub.Err():
 				return
-			case <-notifier.Closed():
+			case <-buffer.Done():
 				return
 			}
 		}
@@ -95,41 +158,37 @@ func (api *PrivateAdminAPI) PeerEvents(ctx context.Context) (*rpc.Subscription,
 func (api *PrivateAdminAPI) StartRPC(host *string, port *int, cors *string, apis *string, vhosts *string) (bool, error) {
 	api.node.lock.Lock()
 	defer api.node.lock.Unlock()
-	if api.node.httpHandler != nil {
-		return false, fmt.Errorf("HTTP RPC already running on %s", api.node.httpEndpoint)
+	cfg := HTTPConfig{
+		Port:         api.node.config.HTTPPort,
+		Cors:         api.node.config.HTTPCors,
+		VirtualHosts: api.node.config.HTTPVirtualHosts,
+		Modules:      api.node.httpWhitelist,
 	}
-	if host == nil {
-		h := DefaultHTTPHost
-		if api.node.config.HTTPHost != "" {
-			h = api.node.config.HTTPHost
-		}
-		host = &h
+	if host != nil {
+		cfg.Host = *host
 	}
-	if port == nil {
-		port = &api.node.config.HTTPPort
+	if port != nil {
+		cfg.Port = *port
 	}
-	allowedOrigins := api.node.config.HTTPCors
 	if cors != nil {
-		allowedOrigins = nil
+		cfg.Cors = nil
 		for _, origin := range strings.Split(*cors, ",") {
-			allowedOrigins = append(allowedOrigins, strings.TrimSpace(origin))
+			cfg.Cors = append(cfg.Cors, strings.TrimSpace(origin))
 		}
 	}
-	allowedVHosts := api.node.config.HTTPVirtualHosts
 	if vhosts != nil {
-		allowedVHosts = nil
-		for _, vhost := range strings.Split(*host, ",") {
-			allowedVHosts = append(allowedVHosts, strings.TrimSpace(vhost))
+		cfg.VirtualHosts = nil
+		for _, vhost := range strings.Split(*vhosts, ",") {
+			cfg.VirtualHosts = append(cfg.VirtualHosts, strings.TrimSpace(vhost))
 		}
 	}
-	modules := api.node.httpWhitelist
 	if apis != nil {
-		modules = nil
+		cfg.Modules = nil
 		for _, m := range strings.Split(*apis, ",") {
-			modules = append(modules, strings.TrimSpace(m))
+			cfg.Modules = append(cfg.Modules, strings.TrimSpace(m))
 		}
 	}
-	if err := api.node.startHTTP(fmt.Sprintf("%s:%d", *host, *port), api.node.rpcAPIs, modules, allowedOrigins, allowedVHosts, api.node.config.HTTPTimeouts, api.node.config.WSOrigins); err != nil {
+	if err := api.node.startHTTPConfig(cfg); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -137,43 +196,39 @@ func (api *PrivateAdminAPI) StartRPC(host *string, port *int, cors *string, apis
 func (api *PrivateAdminAPI) StopRPC() (bool, error) {
 	api.node.lock.Lock()
 	defer api.node.lock.Unlock()
-	if api.node.httpHandler == nil {
-		return false, fmt.Errorf("HTTP RPC not running")
+	if err := api.node.stopHTTPChecked(); err != nil {
+		return false, err
 	}
-	api.node.stopHTTP()
 	return true, nil
 }
 func (api *PrivateAdminAPI) StartWS(host *string, port *int, allowedOrigins *string, apis *string) (bool, error) {
 	api.node.lock.Lock()
 	defer api.node.lock.Unlock()
-	if api.node.wsHandler != nil {
-		return false, fmt.Errorf("WebSocket RPC already running on %s", api.node.wsEndpoint)
+	cfg := WSConfig{
+		Port:      api.node.config.WSPort,
+		Origins:   api.node.config.WSOrigins,
+		Modules:   api.node.config.WSModules,
+		ExposeAll: api.node.config.WSExposeAll,
 	}
-	if host == nil {
-		h := DefaultWSHost
-		if api.node.config.WSHost != "" {
-			h = api.node.config.WSHost
-		}
-		host = &h
+	if host != nil {
+		cfg.Host = *host
 	}
-	if port == nil {
-		port = &api.node.config.WSPort
+	if port != nil {
+		cfg.Port = *port
 	}
-	origins := api.node.config.WSOrigins
 	if allowedOrigins != nil {
-		origins = nil
+		cfg.Origins = nil
 		for _, origin := range strings.Split(*allowedOrigins, ",") {
-			origins = append(origins, strings.TrimSpace(origin))
+			cfg.Origins = append(cfg.Origins, strings.TrimSpace(origin))
 		}
 	}
-	modules := api.node.config.WSModules
 	if apis != nil {
-		modules = nil
+		cfg.Modules = nil
 		for _, m := range strings.Split(*apis, ",") {
-			modules = append(modules, strings.TrimSpace(m))
+			cfg.Modules = append(cfg.Modules, strings.TrimSpace(m))
 		}
 	}
-	if err := api.node.startWS(fmt.Sprintf("%s:%d", *host, *port), api.node.rpcAPIs, modules, origins, api.node.config.WSExposeAll); err != nil {
+	if err := api.node.startWSConfig(cfg); err != nil {
 		return false, err
 	}
 	return true, nil
@@ -181,10 +236,251 @@ func (api *PrivateAdminAPI) StartWS(host *string, port *int, allowedOrigins *str
 func (api *PrivateAdminAPI) StopWS() (bool, error) {
 	api.node.lock.Lock()
 	defer api.node.lock.Unlock()
-	if api.node.wsHandler == nil {
-		return false, fmt.Errorf("WebSocket RPC not running")
+	if err := api.node.stopWSChecked(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (api *PrivateAdminAPI) AddAllowedOrigin(origin string) ([]string, error) {
+	return api.node.AddAllowedOrigin(origin)
+}
+func (api *PrivateAdminAPI) RemoveAllowedOrigin(origin string) ([]string, error) {
+	return api.node.RemoveAllowedOrigin(origin)
+}
+func (api *PrivateAdminAPI) RpcStats() map[string]WorkerPoolStats {
+	return api.node.RPCStats()
+}
+func (api *PrivateAdminAPI) WriteProfiles(types []string, dir *string, cpuDuration *string) ([]string, error) {
+	var (
+		target   string
+		duration time.Duration
+		err      error
+	)
+	if dir != nil {
+		target = *dir
+	}
+	if cpuDuration != nil {
+		if duration, err = time.ParseDuration(*cpuDuration); err != nil {
+			return nil, fmt.Errorf("invalid cpu duration %q: %v", *cpuDuration, err)
+		}
+	}
+	return api.node.WriteProfiles(types, target, duration)
+}
+func (api *PrivateAdminAPI) RecentLogs(level *string, limit *int) ([]LogRecord, error) {
+	var (
+		lvl   string
+		count int
+	)
+	if level != nil {
+		lvl = *level
+	}
+	if limit != nil {
+		count = *limit
+	}
+	return api.node.RecentLogs(lvl, count)
+}
+func (api *PrivateAdminAPI) ReconfigureEndpoint(endpoint string, cfg EndpointConfig) (*EndpointMove, error) {
+	return api.node.ReconfigureEndpoint(endpoint, cfg)
+}
+func (api *PrivateAdminAPI) RestartP2P() (bool, error) {
+	if err := api.node.RestartP2P(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (api *PrivateAdminAPI) StartP2P() (bool, error) {
+	if err := api.node.StartP2P(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (api *PrivateAdminAPI) SetGCConfig(gcPercent *int, memoryLimit *int64, ballastSize *int64) (*GCSettings, error) {
+	settings := api.node.GCSettings()
+	if gcPercent != nil {
+		settings.GCPercent = gcPercent
+	}
+	if memoryLimit != nil {
+		settings.MemoryLimit = memoryLimit
+	}
+	if ballastSize != nil {
+		settings.BallastSize = *ballastSize
+	}
+	if err := api.node.SetGCSettings(settings); err != nil {
+		return nil, err
+	}
+	return &settings, nil
+}
+func (api *PrivateAdminAPI) SubscriptionStats() SubscriptionStats {
+	return api.node.SubscriptionStats()
+}
+func (api *PrivateAdminAPI) SelfTest() *SelfTestReport {
+	return api.node.SelfTest()
+}
+func (api *PrivateAdminAPI) MetricsSnapshot() (string, error) {
+	return api.node.MetricsSnapshot()
+}
+func (api *PrivateAdminAPI) WsClients() []WSClientInfo {
+	return api.node.WSClients()
+}
+func (api *PrivateAdminAPI) DisconnectClient(id string) (bool, error) {
+	if err := api.node.DisconnectWSClient(id); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (api *PrivateAdminAPI) ScheduledTasks() []ScheduledTaskInfo {
+	return api.node.ScheduledTasks()
+}
+func (api *PrivateAdminAPI) RunScheduledTask(name string) (bool, error) {
+	if err := api.node.RunScheduledTask(name); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (api *PrivateAdminAPI) UsageReport() []UsageEntry {
+	return api.node.UsageReport()
+}
+func (api *PrivateAdminAPI) ListServices() ([]ServiceInfo, error) {
+	return api.node.Services()
+}
+func (api *PrivateAdminAPI) Health() (*HealthReport, error) {
+	return api.node.Health()
+}
+func (api *PrivateAdminAPI) DialStatus() (*DialStatus, error) {
+	return api.node.DialStatus()
+}
+func (api *PrivateAdminAPI) SetDialConfig(concurrency *int, preferStatic *bool, retryBackoff, maxRetryBackoff *string) (bool, error) {
+	backoff, err := parseBackoff(retryBackoff)
+	if err != nil {
+		return false, err
+	}
+	maxBackoff, err := parseBackoff(maxRetryBackoff)
+	if err != nil {
+		return false, err
+	}
+	err = api.node.updateDialSettings(func(s *dialSettings) {
+		if concurrency != nil {
+			s.concurrency = *concurrency
+		}
+		if preferStatic != nil {
+			s.preferStatic = *preferStatic
+		}
+		if backoff != nil {
+			s.backoff = *backoff
+		}
+		if maxBackoff != nil {
+			s.maxBackoff = *maxBackoff
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func parseBackoff(value *string) (*time.Duration, error) {
+	if value == nil {
+		return nil, nil
+	}
+	d, err := time.ParseDuration(*value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid backoff %q: %v", *value, err)
+	}
+	return &d, nil
+}
+func (api *PrivateAdminAPI) AccountBackends() []string {
+	return api.node.AccountBackends()
+}
+func (api *PrivateAdminAPI) AddAccountBackend(kind string, name *string, arg *string) (string, error) {
+	backendName, backendArg := kind, ""
+	if name != nil && *name != "" {
+		backendName = *name
+	}
+	if arg != nil {
+		backendArg = *arg
+	}
+	_, _, keydir, err := api.node.config.AccountConfig()
+	if err != nil {
+		return "", err
+	}
+	backend, err := newAccountBackend(kind, backendArg, keydir)
+	if err != nil {
+		return "", err
+	}
+	if err := api.node.AddAccountBackend(backendName, backend); err != nil {
+		return "", err
+	}
+	return backendName, nil
+}
+func (api *PrivateAdminAPI) RemoveAccountBackend(name string) (bool, error) {
+	if err := api.node.RemoveAccountBackend(name); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+type ConfigDump struct {
+	Config       Config              `json:"config"`
+	Deprecations []ConfigDeprecation `json:"deprecations"`
+	FeatureFlags []FeatureFlagState  `json:"featureFlags"`
+}
+func (api *PrivateAdminAPI) DumpConfig() *ConfigDump {
+	api.node.lock.RLock()
+	defer api.node.lock.RUnlock()
+	conf := api.node.config.redacted()
+	deprecations := conf.Deprecations()
+	if deprecations == nil {
+		deprecations = []ConfigDeprecation{}
+	}
+	return &ConfigDump{Config: conf, Deprecations: deprecations, FeatureFlags: api.node.FeatureFlags()}
+}
+func (api *PrivateAdminAPI) ConfigDiff() (*ConfigDiff, error) {
+	return api.node.ConfigDiff()
+}
+func (api *PrivateAdminAPI) MigrateLegacyFiles() []LegacyMigration {
+	return api.node.MigrateLegacyFiles()
+}
+func (api *PrivateAdminAPI) SetFeatureFlag(name string, enabled bool) (bool, error) {
+	if err := api.node.SetFeatureFlag(name, enabled); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+func (api *PrivateAdminAPI) StartupReport() []StartupEvent {
+	return api.node.StartupReport()
+}
+func (api *PrivateAdminAPI) SetHTTPConfig(endpoint string, readTimeout, writeTimeout, idleTimeout *string) (bool, error) {
+	api.node.lock.Lock()
+	defer api.node.lock.Unlock()
+	var timeouts *rpc.HTTPTimeouts
+	switch endpoint {
+	case "http":
+		timeouts = &api.node.config.HTTPTimeouts
+	case "ws":
+		timeouts = &api.node.config.WSTimeouts
+	default:
+		return false, fmt.Errorf("unsupported endpoint %q, want http or ws", endpoint)
+	}
+	updated := *timeouts
+	for _, setting := range []struct {
+		value *string
+		field *time.Duration
+	}{{readTimeout, &updated.ReadTimeout}, {writeTimeout, &updated.WriteTimeout}, {idleTimeout, &updated.IdleTimeout}} {
+		if setting.value == nil {
+			continue
+		}
+		d, err := time.ParseDuration(*setting.value)
+		if err != nil {
+			return false, fmt.Errorf("invalid timeout %q: %v", *setting.value, err)
+		}
+		*setting.field = d
+	}
+	if updated == *timeouts {
+		return true, nil
+	}
+	previous := *timeouts
+	*timeouts = updated
+	if err := api.node.restartEndpoint(endpoint, func() { *timeouts = previous }); err != nil {
+		return false, err
 	}
-	api.node.stopWS()
 	return true, nil
 }
 type PublicAdminAPI struct {
@@ -193,19 +489,35 @@ type PublicAdminAPI struct {
 func NewPublicAdminAPI(node *Node) *PublicAdminAPI {
 	return &PublicAdminAPI{node: node}
 }
-func (api *PublicAdminAPI) Peers() ([]*p2p.PeerInfo, error) {
-	server := api.node.Server()
-	if server == nil {
-		return nil, ErrNodeStopped
+func (api *PublicAdminAPI) Peers() ([]*PeerInfo, error) {
+	server, err := api.node.p2pServer()
+	if err != nil {
+		return nil, err
+	}
+	infos := server.PeersInfo()
+	peers := make([]*PeerInfo, len(infos))
+	for i, info := range infos {
+		peers[i] = &PeerInfo{PeerInfo: info}
+		if id, err := enode.ParseID(info.ID); err == nil {
+			peers[i].Annotation = api.node.peerNotes.get(id)
+			if score, ok := api.node.PeerScore(id); ok {
+				peers[i].Score = &score
+			}
+		}
 	}
-	return server.PeersInfo(), nil
+	return peers, nil
 }
-func (api *PublicAdminAPI) NodeInfo() (*p2p.NodeInfo, error) {
-	server := api.node.Server()
-	if server == nil {
-		return nil, ErrNodeStopped
+type NodeInfo struct {
+	*p2p.NodeInfo
+	Endpoints EndpointsInfo        `json:"endpoints"`
+	Identity  *IdentityAttestation `json:"identity,omitempty"`
+}
+func (api *PublicAdminAPI) NodeInfo() (*NodeInfo, error) {
+	server, err := api.node.p2pServer()
+	if err != nil {
+		return nil, err
 	}
-	return server.NodeInfo(), nil
+	return &NodeInfo{NodeInfo: server.NodeInfo(), Endpoints: api.node.Endpoints(), Identity: api.node.IdentityAttestation()}, nil
 }
 func (api *PublicAdminAPI) Datadir() string {
 	return api.node.DataDir()
@@ -217,7 +529,7 @@ func NewPublicWeb3API(stack *Node) *PublicWeb3API {
 	return &PublicWeb3API{stack}
 }
 func (s *PublicWeb3API) ClientVersion() string {
-	return s.stack.Server().Name
+	return s.stack.config.NodeName()
 }
 func (s *PublicWeb3API) Sha3(input hexutil.Bytes) hexutil.Bytes {
 	return crypto.Keccak256(input)
@@ -0,0 +1,48 @@
+package node
+import (
+	"reflect"
+	"sort"
+	"unicode"
+	"github.com/Cryptochain-VON/rpc"
+)
+const nodeAPIOrigin = "node"
+type APIInfo struct {
+	Namespace string   `json:"namespace"`
+	Version   string   `json:"version"`
+	Public    bool     `json:"public"`
+	Origin    string   `json:"origin"`
+	Methods   []string `json:"methods"`
+	API       rpc.API  `json:"-"`
+}
+func newAPIInfo(api rpc.API, origin string) APIInfo {
+	info := APIInfo{
+		Namespace: api.Namespace,
+		Version:   api.Version,
+		Public:    api.Public,
+		Origin:    origin,
+		Methods:   []string{},
+		API:       api,
+	}
+	if api.Service != nil {
+		typ := reflect.TypeOf(api.Service)
+		for i := 0; i < typ.NumMethod(); i++ {
+			name := []rune(typ.Method(i).Name)
+			name[0] = unicode.ToLower(name[0])
+			info.Methods = append(info.Methods, api.Namespace+"_"+string(name))
+		}
+		sort.Strings(info.Methods)
+	}
+	return info
+}
+func (n *Node) APIs() ([]APIInfo, error) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	if n.server == nil {
+		return nil, ErrNodeStopped
+	}
+	infos := make([]APIInfo, len(n.rpcAPIs))
+	for i, api := range n.rpcAPIs {
+		infos[i] = newAPIInfo(api, n.rpcAPIOrigins[i])
+	}
+	return infos, nil
+}
@@ -0,0 +1,302 @@
+package node
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+const (
+	AuthProviderBearer  = "bearer"
+	AuthProviderAPIKey  = "apikey"
+	AuthProviderJWT     = "jwt"
+	AuthProviderMTLS    = "mtls"
+	DefaultAPIKeyHeader = "X-API-Key"
+	jwtLeeway           = 5 * time.Second
+	jwtIssuedWindow     = 60 * time.Second
+	jwtMinSecretLength  = 32
+)
+type Identity struct {
+	Subject  string                 `json:"subject"`
+	Provider string                 `json:"provider"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+}
+type AuthProvider interface {
+	Authenticate(r *http.Request) (Identity, error)
+}
+type authIdentityKey struct{}
+func AuthIdentity(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(authIdentityKey{}).(Identity)
+	return id, ok
+}
+func authSubject(r *http.Request) string {
+	if id, ok := AuthIdentity(r.Context()); ok {
+		return id.Subject
+	}
+	return ""
+}
+func isCORSPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != "" &&
+		r.ContentLength == 0 && len(r.TransferEncoding) == 0
+}
+func newAuthHandler(provider AuthProvider, next http.Handler, writeErr HTTPErrorWriter, preflight bool) http.Handler {
+	if provider == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if preflight && isCORSPreflight(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		id, err := provider.Authenticate(r)
+		if err != nil {
+			if err == ErrNoCredentials {
+				writeErr(w, r, http.StatusUnauthorized, "missing or invalid authorization")
+			} else {
+				writeErr(w, r, http.StatusUnauthorized, err.Error())
+			}
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), authIdentityKey{}, id)))
+	})
+}
+type AuthChain []AuthProvider
+func (c AuthChain) Authenticate(r *http.Request) (Identity, error) {
+	for _, provider := range c {
+		id, err := provider.Authenticate(r)
+		if err == ErrNoCredentials {
+			continue
+		}
+		return id, err
+	}
+	return Identity{}, ErrNoCredentials
+}
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
+type BearerTokenAuthProvider struct {
+	Token   string
+	Subject string
+}
+func (p *BearerTokenAuthProvider) Authenticate(r *http.Request) (Identity, error) {
+	token, ok := bearerToken(r)
+	if !ok {
+		return Identity{}, ErrNoCredentials
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(p.Token)) != 1 {
+		return Identity{}, errors.New("invalid bearer token")
+	}
+	return Identity{Subject: p.Subject, Provider: AuthProviderBearer}, nil
+}
+type APIKeyAuthProvider struct {
+	Header string
+	Keys   map[string]string
+}
+func NewAPIKeyAuthProvider(header string, entries []string) (*APIKeyAuthProvider, error) {
+	if header == "" {
+		header = DefaultAPIKeyHeader
+	}
+	p := &APIKeyAuthProvider{Header: header, Keys: make(map[string]string, len(entries))}
+	for _, entry := range entries {
+		i := strings.IndexByte(entry, ':')
+		if i <= 0 || i == len(entry)-1 {
+			return nil, errors.New("invalid API key entry, want subject:key")
+		}
+		p.Keys[entry[i+1:]] = entry[:i]
+	}
+	return p, nil
+}
+func (p *APIKeyAuthProvider) Authenticate(r *http.Request) (Identity, error) {
+	presented := r.Header.Get(p.Header)
+	if presented == "" {
+		return Identity{}, ErrNoCredentials
+	}
+	var subject string
+	for key, sub := range p.Keys {
+		if subtle.ConstantTimeCompare([]byte(presented), []byte(key)) == 1 {
+			subject = sub
+		}
+	}
+	if subject == "" {
+		return Identity{}, errors.New("invalid API key")
+	}
+	return Identity{Subject: subject, Provider: AuthProviderAPIKey}, nil
+}
+type JWTAuthProvider struct {
+	Secret   []byte
+	Audience string
+	Clock    Clock
+}
+func NewJWTAuthProvider(secret string, clock Clock) (*JWTAuthProvider, error) {
+	key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(secret), "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWT secret: %v", err)
+	}
+	if len(key) < jwtMinSecretLength {
+		return nil, fmt.Errorf("JWT secret must be at least %d bytes", jwtMinSecretLength)
+	}
+	return &JWTAuthProvider{Secret: key, Clock: clock}, nil
+}
+func (p *JWTAuthProvider) Authenticate(r *http.Request) (Identity, error) {
+	token, ok := bearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		return Identity{}, ErrNoCredentials
+	}
+	parts := strings.Split(token, ".")
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return Identity{}, fmt.Errorf("invalid JWT header: %v", err)
+	}
+	if header.Alg != "HS256" {
+		return Identity{}, fmt.Errorf("unsupported JWT algorithm %q", header.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, fmt.Errorf("invalid JWT signature: %v", err)
+	}
+	mac := hmac.New(sha256.New, p.Secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return Identity{}, errors.New("invalid JWT signature")
+	}
+	var claims map[string]interface{}
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return Identity{}, fmt.Errorf("invalid JWT claims: %v", err)
+	}
+	now := time.Now()
+	if p.Clock != nil {
+		now = p.Clock.Now()
+	}
+	exp, hasExp := claims["exp"].(float64)
+	iat, hasIat := claims["iat"].(float64)
+	switch {
+	case hasExp && now.After(time.Unix(int64(exp), 0).Add(jwtLeeway)):
+		return Identity{}, errors.New("JWT expired")
+	case !hasExp && !hasIat:
+		return Identity{}, errors.New("JWT must carry an exp or iat claim")
+	case !hasExp:
+		issued := time.Unix(int64(iat), 0)
+		if now.Sub(issued) > jwtIssuedWindow || issued.Sub(now) > jwtIssuedWindow {
+			return Identity{}, errors.New("JWT iat outside the allowed window")
+		}
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(jwtLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return Identity{}, errors.New("JWT not yet valid")
+	}
+	if p.Audience != "" && !jwtHasAudience(claims["aud"], p.Audience) {
+		return Identity{}, errors.New("JWT audience mismatch")
+	}
+	subject, _ := claims["sub"].(string)
+	return Identity{Subject: subject, Provider: AuthProviderJWT, Claims: claims}, nil
+}
+func decodeJWTSegment(segment string, v interface{}) error {
+	blob, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(blob, v)
+}
+func jwtHasAudience(aud interface{}, want string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == want
+	case []interface{}:
+		for _, a := range aud {
+			if s, ok := a.(string); ok && s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+type MTLSAuthProvider struct {
+	Roots *x509.CertPool
+}
+func NewMTLSAuthProvider(caFile string) (*MTLSAuthProvider, error) {
+	blob, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(blob) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", caFile)
+	}
+	return &MTLSAuthProvider{Roots: roots}, nil
+}
+func (p *MTLSAuthProvider) Authenticate(r *http.Request) (Identity, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return Identity{}, ErrNoCredentials
+	}
+	certs := r.TLS.PeerCertificates
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	opts := x509.VerifyOptions{Roots: p.Roots, Intermediates: intermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return Identity{}, fmt.Errorf("client certificate rejected: %v", err)
+	}
+	return Identity{Subject: certs[0].Subject.String(), Provider: AuthProviderMTLS}, nil
+}
+func (c *Config) authProvider() (AuthProvider, *x509.CertPool, error) {
+	var (
+		chain AuthChain
+		roots *x509.CertPool
+	)
+	if c.AuthProvider != nil {
+		chain = append(chain, c.AuthProvider)
+	}
+	if c.RPCAuthClientCA != "" {
+		p, err := NewMTLSAuthProvider(c.RPCAuthClientCA)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain, roots = append(chain, p), p.Roots
+	}
+	if c.RPCAuthJWTSecret != "" {
+		p, err := NewJWTAuthProvider(c.RPCAuthJWTSecret, c.clock())
+		if err != nil {
+			return nil, nil, err
+		}
+		p.Audience = c.RPCAuthJWTAudience
+		chain = append(chain, p)
+	}
+	if len(c.RPCAuthAPIKeys) > 0 {
+		p, err := NewAPIKeyAuthProvider(c.RPCAuthAPIKeyHeader, c.RPCAuthAPIKeys)
+		if err != nil {
+			return nil, nil, err
+		}
+		chain = append(chain, p)
+	}
+	switch len(chain) {
+	case 0:
+		return nil, nil, nil
+	case 1:
+		return chain[0], roots, nil
+	default:
+		return chain, roots, nil
+	}
+}
+func (c *Config) adminAuthProvider() AuthProvider {
+	if c.AdminAuthToken == "" {
+		return nil
+	}
+	return &BearerTokenAuthProvider{Token: c.AdminAuthToken, Subject: "admin"}
+}
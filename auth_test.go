@@ -0,0 +1,111 @@
+package node
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+func TestAuthHandlerPreflight(t *testing.T) {
+	preflight := func(r *http.Request) {
+		r.Header.Set("Origin", "http://example.com")
+		r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	}
+	tests := []struct {
+		name      string
+		method    string
+		body      string
+		setup     func(*http.Request)
+		preflight bool
+		want      int
+	}{
+		{name: "preflight", method: http.MethodOptions, setup: preflight, preflight: true, want: http.StatusOK},
+		{name: "preflight on admin", method: http.MethodOptions, setup: preflight, want: http.StatusUnauthorized},
+		{name: "options without origin", method: http.MethodOptions, preflight: true, setup: func(r *http.Request) {
+			r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}, want: http.StatusUnauthorized},
+		{name: "options without request method", method: http.MethodOptions, preflight: true, setup: func(r *http.Request) {
+			r.Header.Set("Origin", "http://example.com")
+		}, want: http.StatusUnauthorized},
+		{name: "options with body", method: http.MethodOptions, body: `{"method":"admin_peers"}`, setup: preflight, preflight: true, want: http.StatusUnauthorized},
+		{name: "post with preflight headers", method: http.MethodPost, setup: preflight, preflight: true, want: http.StatusUnauthorized},
+		{name: "authenticated post", method: http.MethodPost, preflight: true, setup: func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer secret")
+		}, want: http.StatusOK},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newAuthHandler(&BearerTokenAuthProvider{Token: "secret"}, next, PlainHTTPErrorWriter, tt.preflight)
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.setup != nil {
+				tt.setup(req)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status mismatch: have %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+func makeTestJWT(secret []byte, alg string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+func TestJWTAuthProvider(t *testing.T) {
+	secret := strings.Repeat("ab", jwtMinSecretLength)
+	now := time.Unix(1600000000, 0)
+	provider, err := NewJWTAuthProvider(secret, NewSimulatedClock(now))
+	if err != nil {
+		t.Fatalf("failed to create provider: %v", err)
+	}
+	provider.Audience = "node"
+	unix := func(d time.Duration) float64 { return float64(now.Add(d).Unix()) }
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{name: "exp in future", token: makeTestJWT(provider.Secret, "HS256", map[string]interface{}{"sub": "alice", "aud": "node", "exp": unix(time.Minute)})},
+		{name: "exp within leeway", token: makeTestJWT(provider.Secret, "HS256", map[string]interface{}{"sub": "alice", "aud": "node", "exp": unix(-jwtLeeway / 2)})},
+		{name: "expired", token: makeTestJWT(provider.Secret, "HS256", map[string]interface{}{"sub": "alice", "aud": "node", "exp": unix(-time.Minute)}), wantErr: "JWT expired"},
+		{name: "fresh iat", token: makeTestJWT(provider.Secret, "HS256", map[string]interface{}{"sub": "alice", "aud": "node", "iat": unix(-jwtIssuedWindow / 2)})},
+		{name: "stale iat", token: makeTestJWT(provider.Secret, "HS256", map[string]interface{}{"sub": "alice", "aud": "node", "iat": unix(-2 * jwtIssuedWindow)}), wantErr: "JWT iat outside the allowed window"},
+		{name: "future iat", token: makeTestJWT(provider.Secret, "HS256", map[string]interface{}{"sub": "alice", "aud": "node", "iat": unix(2 * jwtIssuedWindow)}), wantErr: "JWT iat outside the allowed window"},
+		{name: "no exp or iat", token: makeTestJWT(provider.Secret, "HS256", map[string]interface{}{"sub": "alice", "aud": "node"}), wantErr: "JWT must carry an exp or iat claim"},
+		{name: "not yet valid", token: makeTestJWT(provider.Secret, "HS256", map[string]interface{}{"sub": "alice", "aud": "node", "exp": unix(time.Hour), "nbf": unix(time.Minute)}), wantErr: "JWT not yet valid"},
+		{name: "audience mismatch", token: makeTestJWT(provider.Secret, "HS256", map[string]interface{}{"sub": "alice", "aud": []string{"other"}, "exp": unix(time.Minute)}), wantErr: "JWT audience mismatch"},
+		{name: "audience list", token: makeTestJWT(provider.Secret, "HS256", map[string]interface{}{"sub": "alice", "aud": []string{"other", "node"}, "exp": unix(time.Minute)})},
+		{name: "wrong secret", token: makeTestJWT([]byte(strings.Repeat("x", jwtMinSecretLength)), "HS256", map[string]interface{}{"sub": "alice", "aud": "node", "exp": unix(time.Minute)}), wantErr: "invalid JWT signature"},
+		{name: "unsupported algorithm", token: makeTestJWT(provider.Secret, "none", map[string]interface{}{"sub": "alice", "aud": "node", "exp": unix(time.Minute)}), wantErr: `unsupported JWT algorithm "none"`},
+		{name: "not a jwt", token: "opaque-token", wantErr: ErrNoCredentials.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			id, err := provider.Authenticate(req)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error mismatch: have %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("authentication failed: %v", err)
+			}
+			if id.Subject != "alice" || id.Provider != AuthProviderJWT {
+				t.Fatalf("identity mismatch: have %+v", id)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package node
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/log"
+)
+const (
+	ntpEpochOffset = 2208988800
+	ClockInSync    = "in-sync"
+	ClockSkewed    = "skewed"
+	ClockUnknown   = "unknown"
+)
+type ClockStatus struct {
+	Checked   time.Time     `json:"checked"`
+	Server    string        `json:"server,omitempty"`
+	Drift     time.Duration `json:"drift"`
+	Threshold time.Duration `json:"threshold"`
+	State     string        `json:"state"`
+	OK        bool          `json:"ok"`
+	Error     string        `json:"error,omitempty"`
+}
+type clockMonitor struct {
+	servers   []string
+	threshold time.Duration
+	interval  time.Duration
+	log       log.Logger
+	clock     Clock
+	lock      sync.RWMutex
+	status    ClockStatus
+	quit      chan struct{}
+	wg        sync.WaitGroup
+}
+func newClockMonitor(servers []string, threshold, interval time.Duration, clock Clock, logger log.Logger) *clockMonitor {
+	return &clockMonitor{
+		servers:   servers,
+		threshold: threshold,
+		interval:  interval,
+		log:       logger,
+		clock:     clock,
+		status:    ClockStatus{Threshold: threshold, State: ClockUnknown, OK: true},
+		quit:      make(chan struct{}),
+	}
+}
+func (m *clockMonitor) start() {
+	m.wg.Add(1)
+	go m.loop()
+}
+func (m *clockMonitor) stop() {
+	close(m.quit)
+	m.wg.Wait()
+}
+func (m *clockMonitor) loop() {
+	defer m.wg.Done()
+	ticker := m.clock.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		m.check()
+		select {
+		case <-ticker.C():
+		case <-m.quit:
+			return
+		}
+	}
+}
+func (m *clockMonitor) check() {
+	status := ClockStatus{Checked: m.clock.Now(), Threshold: m.threshold}
+	var err error
+	for _, server := range m.servers {
+		var drift time.Duration
+		if drift, err = sntpDrift(server); err == nil {
+			status.Server, status.Drift = server, drift
+			break
+		}
+	}
+	switch {
+	case err != nil:
+		status.State, status.OK, status.Error = ClockUnknown, true, err.Error()
+		m.log.Debug("Clock drift check failed", "err", err)
+	case status.Drift < -m.threshold || status.Drift > m.threshold:
+		status.State = ClockSkewed
+		m.log.Warn("System clock drift exceeds threshold", "drift", status.Drift, "threshold", m.threshold, "server", status.Server)
+	default:
+		status.State, status.OK = ClockInSync, true
+		m.log.Trace("System clock in sync", "drift", status.Drift, "server", status.Server)
+	}
+	m.lock.Lock()
+	m.status = status
+	m.lock.Unlock()
+}
+func (m *clockMonitor) Status() ClockStatus {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return m.status
+}
+func sntpDrift(server string) (time.Duration, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "123")
+	}
+	conn, err := net.DialTimeout("udp", server, 5*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req := make([]byte, 48)
+	req[0] = 3<<3 | 3
+	sent := time.Now()
+	if _, err := conn.Write(req); err != nil {
+		return 0, err
+	}
+	reply := make([]byte, 48)
+	if _, err := conn.Read(reply); err != nil {
+		return 0, err
+	}
+	received := time.Now()
+	if reply[0]&0x7 != 4 || reply[1] == 0 {
+		return 0, errors.New("invalid NTP reply")
+	}
+	serverRecv := ntpTime(reply[32:40])
+	serverSent := ntpTime(reply[40:48])
+	return (serverRecv.Sub(sent) + serverSent.Sub(received)) / 2, nil
+}
+func ntpTime(b []byte) time.Time {
+	secs := int64(binary.BigEndian.Uint32(b[0:4])) - ntpEpochOffset
+	frac := int64(binary.BigEndian.Uint32(b[4:8]))
+	return time.Unix(secs, frac*1e9>>32)
+}
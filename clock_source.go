@@ -0,0 +1,115 @@
+package node
+import (
+	"sort"
+	"sync"
+	"time"
+)
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+type SystemClock struct{}
+func (SystemClock) Now() time.Time { return time.Now() }
+func (SystemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+func (SystemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+type systemTimer struct{ *time.Timer }
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
+type systemTicker struct{ *time.Ticker }
+func (t systemTicker) C() <-chan time.Time { return t.Ticker.C }
+type SimulatedClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	waiters []*simWaiter
+}
+type simWaiter struct {
+	clock  *SimulatedClock
+	at     time.Time
+	period time.Duration
+	ch     chan time.Time
+}
+func NewSimulatedClock(start time.Time) *SimulatedClock {
+	return &SimulatedClock{now: start}
+}
+func (c *SimulatedClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+func (c *SimulatedClock) NewTimer(d time.Duration) Timer {
+	return c.schedule(d, 0)
+}
+func (c *SimulatedClock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return simTicker{c.schedule(d, d)}
+}
+func (c *SimulatedClock) schedule(d, period time.Duration) *simWaiter {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	w := &simWaiter{clock: c, at: c.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	c.waiters = append(c.waiters, w)
+	return w
+}
+func (c *SimulatedClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	end := c.now.Add(d)
+	for {
+		sort.Slice(c.waiters, func(i, j int) bool { return c.waiters[i].at.Before(c.waiters[j].at) })
+		if len(c.waiters) == 0 || c.waiters[0].at.After(end) {
+			break
+		}
+		w := c.waiters[0]
+		c.now = w.at
+		select {
+		case w.ch <- c.now:
+		default:
+		}
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			c.waiters = c.waiters[1:]
+		}
+	}
+	c.now = end
+}
+func (c *SimulatedClock) Waiters() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.waiters)
+}
+func (c *SimulatedClock) remove(w *simWaiter) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for i, other := range c.waiters {
+		if other == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+func (w *simWaiter) C() <-chan time.Time { return w.ch }
+func (w *simWaiter) Stop() bool          { return w.clock.remove(w) }
+type simTicker struct{ *simWaiter }
+func (t simTicker) Stop() { t.simWaiter.Stop() }
+func (c *Config) clock() Clock {
+	if c.Clock != nil {
+		return c.Clock
+	}
+	return SystemClock{}
+}
@@ -5,9 +5,11 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 	"github.com/Cryptochain-VON/accounts"
 	"github.com/Cryptochain-VON/accounts/external"
 	"github.com/Cryptochain-VON/accounts/keystore"
@@ -26,42 +28,201 @@ const (
 	datadirStaticNodes     = "static-nodes.json"  
 	datadirTrustedNodes    = "trusted-nodes.json" 
 	datadirNodeDatabase    = "nodes"              
+	datadirKeyStoreIndex   = "keystore-index.json"
+	datadirEndpointsFile   = "endpoints.json"
+	datadirPeerAnnotations = "peer-annotations.json"
 )
 type Config struct {
 	Name string `toml:"-"`
 	UserIdent string `toml:",omitempty"`
+	Identity *NodeIdentity `toml:",omitempty"`
+	IdentityInClientName bool `toml:",omitempty"`
+	NodeNameTemplate string `toml:",omitempty"`
+	NodeNameLabels map[string]string `toml:",omitempty"`
 	Version string `toml:"-"`
 	DataDir string
+	DefaultDataDirOverride func() (string, error) `toml:"-" json:"-"`
 	P2P p2p.Config
 	KeyStoreDir string `toml:",omitempty"`
 	ExternalSigner string `toml:",omitempty"`
 	UseLightweightKDF bool `toml:",omitempty"`
+	KeyStoreIndex bool `toml:",omitempty"`
+	KeyStoreFormat string `toml:",omitempty"`
+	KeyStoreArgon2Time uint32 `toml:",omitempty"`
+	KeyStoreArgon2Memory uint32 `toml:",omitempty"`
+	KeyStoreArgon2Threads uint8 `toml:",omitempty"`
 	InsecureUnlockAllowed bool `toml:",omitempty"`
+	PassphraseFile string `toml:",omitempty"`
+	PassphraseEnv string `toml:",omitempty"`
+	ConfigKeyFile string `toml:",omitempty"`
+	ConfigKeyEnv string `toml:",omitempty"`
+	ConfigKeyProvider ConfigKeyProvider `toml:"-" json:"-"`
+	PassphraseProvider PassphraseProvider `toml:"-" json:"-"`
 	NoUSB bool `toml:",omitempty"`
+	NoP2P bool `toml:",omitempty"`
+	DeferP2P bool `toml:",omitempty"`
+	P2PReadyCheck func() bool `toml:"-" json:"-"`
+	NoIPC bool `toml:",omitempty"`
 	SmartCardDaemonPath string `toml:",omitempty"`
 	IPCPath string `toml:",omitempty"`
+	IPCMaxConnections int `toml:",omitempty"`
+	IPCMaxRequestBytes int64 `toml:",omitempty"`
+	IPCModules []string `toml:",omitempty"`
 	HTTPHost string `toml:",omitempty"`
 	HTTPPort int `toml:",omitempty"`
 	HTTPCors []string `toml:",omitempty"`
 	HTTPVirtualHosts []string `toml:",omitempty"`
 	HTTPModules []string `toml:",omitempty"`
 	HTTPTimeouts rpc.HTTPTimeouts
+	HTTPTLSCert string `toml:",omitempty"`
+	HTTPTLSKey string `toml:",omitempty"`
+	HTTPUnixSocket string `toml:",omitempty"`
+	HTTPJSONErrors bool `toml:",omitempty"`
+	HTTPHeaderPassthrough []string `toml:",omitempty"`
+	HTTPExtraHeaders map[string]string `toml:",omitempty" secret:"true"`
+	RPCMaxConnections int `toml:",omitempty"`
+	RPCMaxRequestBytes int64 `toml:",omitempty"`
+	RPCWorkerPools map[string]int `toml:",omitempty"`
+	RPCWorkerQueue int `toml:",omitempty"`
+	RPCUsageAccounting bool `toml:",omitempty"`
+	RPCPrebind bool `toml:",omitempty"`
+	RPCJournal string `toml:",omitempty"`
+	RPCJournalMaxBytes int64 `toml:",omitempty"`
+	RPCJournalFullParams []string `toml:",omitempty"`
+	RPCQuotaKey string `toml:",omitempty"`
+	RPCQuotaKeyHeader string `toml:",omitempty"`
+	RPCQuotaHourly uint64 `toml:",omitempty"`
+	RPCQuotaDaily uint64 `toml:",omitempty"`
+	HTTPErrorWriter HTTPErrorWriter `toml:"-" json:"-"`
 	WSHost string `toml:",omitempty"`
 	WSPort int `toml:",omitempty"`
 	WSOrigins []string `toml:",omitempty"`
+	WSOriginChecker WSOriginChecker `toml:"-" json:"-"`
 	WSModules []string `toml:",omitempty"`
 	WSExposeAll bool `toml:",omitempty"`
+	WSTimeouts rpc.HTTPTimeouts
+	WSMaxSubscriptionsPerConn int `toml:",omitempty"`
+	WSMaxSubscriptionsPerClient int `toml:",omitempty"`
+	SubscriptionBufferSize int `toml:",omitempty"`
+	SubscriptionOverflowPolicy string `toml:",omitempty"`
+	WSClientIdentityHeader string `toml:",omitempty"`
+	WriteEndpointsFile bool `toml:",omitempty"`
+	AdminHost string `toml:",omitempty"`
+	AdminPort int `toml:",omitempty"`
+	AdminModules []string `toml:",omitempty"`
+	AdminAuthToken string `toml:",omitempty" secret:"true"`
+	AuthProvider AuthProvider `toml:"-" json:"-"`
+	RPCAuthJWTSecret string `toml:",omitempty" secret:"true"`
+	RPCAuthJWTAudience string `toml:",omitempty"`
+	RPCAuthAPIKeys []string `toml:",omitempty" secret:"true"`
+	RPCAuthAPIKeyHeader string `toml:",omitempty"`
+	RPCAuthClientCA string `toml:",omitempty"`
 	GraphQLHost string `toml:",omitempty"`
 	GraphQLPort int `toml:",omitempty"`
 	GraphQLCors []string `toml:",omitempty"`
 	GraphQLVirtualHosts []string `toml:",omitempty"`
-	Logger log.Logger `toml:",omitempty"`
+	GraphQLTimeouts rpc.HTTPTimeouts
+	Logger log.Logger `toml:",omitempty" json:"-"`
+	LogBufferSize int `toml:",omitempty"`
+	LogBufferLevel string `toml:",omitempty"`
+	AccountAudit bool `toml:",omitempty"`
+	AccountAuditLog string `toml:",omitempty"`
+	FeatureFlags map[string]bool `toml:",omitempty"`
+	GCPercent *int `toml:",omitempty"`
+	GCMemoryLimit *int64 `toml:",omitempty"`
+	GCBallastSize int64 `toml:",omitempty"`
+	Webhooks []WebhookConfig `toml:",omitempty"`
+	ScheduledTasks []ScheduledTaskConfig `toml:",omitempty"`
+	ConfigFile string `toml:"-"`
+	ConfigFileLoader func(path string) (*Config, error) `toml:"-" json:"-"`
+	ServiceStopTimeout time.Duration `toml:",omitempty"`
+	DrainTimeout time.Duration `toml:",omitempty"`
+	IdleTimeout time.Duration `toml:",omitempty"`
+	NTPServers []string `toml:",omitempty"`
+	NTPDriftThreshold time.Duration `toml:",omitempty"`
+	NTPCheckInterval time.Duration `toml:",omitempty"`
+	DialConcurrency int `toml:",omitempty"`
+	DialRetryBackoff time.Duration `toml:",omitempty"`
+	DialMaxRetryBackoff time.Duration `toml:",omitempty"`
+	PreferStaticPeers bool `toml:",omitempty"`
+	PeerScoring bool `toml:",omitempty"`
+	PeerEvictScore float64 `toml:",omitempty"`
+	PeerProtectScore float64 `toml:",omitempty"`
+	PeerScorer PeerScorer `toml:"-" json:"-"`
+	PeerHistorySize int `toml:",omitempty"`
+	StartupProgress func(StartupEvent) `toml:"-" json:"-"`
+	Clock Clock `toml:"-" json:"-"`
+	DatabaseHooks []DatabaseHooks `toml:"-" json:"-"`
 	staticNodesWarning     bool
 	trustedNodesWarning    bool
 	oldGethResourceWarning bool
+	decryptedFields        map[string]bool
+	defaultDataDir         string
+	dataDirDefaulted       bool
+}
+const redactedValue = "<redacted>"
+func (c *Config) redacted() Config {
+	return redactConfig(*c, c.decryptedFields)
+}
+func redactConfig(conf Config, decrypted map[string]bool) Config {
+	conf.P2P.PrivateKey = nil
+	redactFields(reflect.ValueOf(&conf).Elem(), "", false, decrypted)
+	return conf
+}
+func redactFields(v reflect.Value, path string, secret bool, decrypted map[string]bool) {
+	secret = secret || decrypted[path]
+	switch v.Kind() {
+	case reflect.String:
+		if secret && v.String() != "" {
+			v.SetString(redactedValue)
+		}
+	case reflect.Ptr:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct {
+			return
+		}
+		clone := reflect.New(v.Elem().Type())
+		clone.Elem().Set(v.Elem())
+		redactFields(clone.Elem(), path, secret, decrypted)
+		v.Set(clone)
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		clone := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(clone, v)
+		for i := 0; i < clone.Len(); i++ {
+			redactFields(clone.Index(i), fmt.Sprintf("%s[%d]", path, i), secret, decrypted)
+		}
+		v.Set(clone)
+	case reflect.Map:
+		if v.IsNil() || v.Type().Elem().Kind() != reflect.String {
+			return
+		}
+		clone := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(iter.Value())
+			redactFields(value, fmt.Sprintf("%s[%v]", path, iter.Key()), secret, decrypted)
+			clone.SetMapIndex(iter.Key(), value)
+		}
+		v.Set(clone)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := field.Name
+			if path != "" {
+				name = path + "." + name
+			}
+			redactFields(v.Field(i), name, secret || field.Tag.Get("secret") == "true", decrypted)
+		}
+	}
 }
 func (c *Config) IPCEndpoint() string {
-	if c.IPCPath == "" {
+	if c.IPCPath == "" || c.NoIPC {
 		return ""
 	}
 	if runtime.GOOS == "windows" {
@@ -100,6 +261,28 @@ func (c *Config) HTTPEndpoint() string {
 	}
 	return fmt.Sprintf("%s:%d", c.HTTPHost, c.HTTPPort)
 }
+func (c *Config) HTTPUnixSocketEndpoint() string {
+	if c.HTTPUnixSocket == "" || runtime.GOOS == "windows" {
+		return ""
+	}
+	if filepath.Base(c.HTTPUnixSocket) == c.HTTPUnixSocket {
+		if c.DataDir == "" {
+			return filepath.Join(os.TempDir(), c.HTTPUnixSocket)
+		}
+		return filepath.Join(c.DataDir, c.HTTPUnixSocket)
+	}
+	return c.HTTPUnixSocket
+}
+func (c *Config) httpErrorWriter() HTTPErrorWriter {
+	switch {
+	case c.HTTPErrorWriter != nil:
+		return c.HTTPErrorWriter
+	case c.HTTPJSONErrors:
+		return JSONHTTPErrorWriter
+	default:
+		return PlainHTTPErrorWriter
+	}
+}
 func (c *Config) GraphQLEndpoint() string {
 	if c.GraphQLHost == "" {
 		return ""
@@ -110,6 +293,18 @@ func DefaultHTTPEndpoint() string {
 	config := &Config{HTTPHost: DefaultHTTPHost, HTTPPort: DefaultHTTPPort}
 	return config.HTTPEndpoint()
 }
+func (c *Config) AdminEndpoint() string {
+	if c.AdminHost == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s:%d", c.AdminHost, c.AdminPort)
+}
+func (c *Config) adminModules() []string {
+	if len(c.AdminModules) == 0 {
+		return DefaultAdminModules
+	}
+	return c.AdminModules
+}
 func (c *Config) WSEndpoint() string {
 	if c.WSHost == "" {
 		return ""
@@ -123,14 +318,42 @@ func DefaultWSEndpoint() string {
 func (c *Config) ExtRPCEnabled() bool {
 	return c.HTTPHost != "" || c.WSHost != "" || c.GraphQLHost != ""
 }
+func (c *Config) serviceStopTimeout() time.Duration {
+	if c.ServiceStopTimeout <= 0 {
+		return DefaultServiceStopTimeout
+	}
+	return c.ServiceStopTimeout
+}
+func (c *Config) drainTimeout() time.Duration {
+	if c.DrainTimeout <= 0 {
+		return DefaultDrainTimeout
+	}
+	return c.DrainTimeout
+}
+func (c *Config) ntpSettings() (time.Duration, time.Duration) {
+	threshold, interval := c.NTPDriftThreshold, c.NTPCheckInterval
+	if threshold <= 0 {
+		threshold = DefaultNTPDriftThreshold
+	}
+	if interval <= 0 {
+		interval = DefaultNTPCheckInterval
+	}
+	return threshold, interval
+}
 func (c *Config) NodeName() string {
 	name := c.name()
 	if name == "geth" || name == "geth-testnet" {
 		name = "Geth"
 	}
+	if templated, ok := c.templatedNodeName(name); ok {
+		return templated
+	}
 	if c.UserIdent != "" {
 		name += "/" + c.UserIdent
 	}
+	if c.IdentityInClientName && c.Identity != nil && c.Identity.Operator != "" {
+		name += "/" + c.Identity.clientTag()
+	}
 	if c.Version != "" {
 		name += "/v" + c.Version
 	}
@@ -148,13 +371,6 @@ func (c *Config) name() string {
 	}
 	return c.Name
 }
-var isOldGethResource = map[string]bool{
-	"chaindata":          true,
-	"nodes":              true,
-	"nodekey":            true,
-	"static-nodes.json":  false, 
-	"trusted-nodes.json": false, 
-}
 func (c *Config) ResolvePath(path string) string {
 	if filepath.IsAbs(path) {
 		return path
@@ -162,17 +378,8 @@ func (c *Config) ResolvePath(path string) string {
 	if c.DataDir == "" {
 		return ""
 	}
-	if warn, isOld := isOldGethResource[path]; isOld {
-		oldpath := ""
-		if c.name() == "geth" {
-			oldpath = filepath.Join(c.DataDir, path)
-		}
-		if oldpath != "" && common.FileExist(oldpath) {
-			if warn {
-				c.warnOnce(&c.oldGethResourceWarning, "Using deprecated resource file %s, please move this file to the 'geth' subdirectory of datadir.", oldpath)
-			}
-			return oldpath
-		}
+	if oldpath := c.resolveLegacyPath(path); oldpath != "" {
+		return oldpath
 	}
 	return filepath.Join(c.instanceDir(), path)
 }
@@ -213,19 +420,19 @@ func (c *Config) NodeKey() *ecdsa.PrivateKey {
 	return key
 }
 func (c *Config) StaticNodes() []*enode.Node {
-	return c.parsePersistentNodes(&c.staticNodesWarning, c.ResolvePath(datadirStaticNodes))
+	return c.parsePersistentNodes(&c.staticNodesWarning, deprecatedStaticNodes, c.ResolvePath(datadirStaticNodes))
 }
 func (c *Config) TrustedNodes() []*enode.Node {
-	return c.parsePersistentNodes(&c.trustedNodesWarning, c.ResolvePath(datadirTrustedNodes))
+	return c.parsePersistentNodes(&c.trustedNodesWarning, deprecatedTrustedNodes, c.ResolvePath(datadirTrustedNodes))
 }
-func (c *Config) parsePersistentNodes(w *bool, path string) []*enode.Node {
+func (c *Config) parsePersistentNodes(w *bool, dep *ConfigDeprecation, path string) []*enode.Node {
 	if c.DataDir == "" {
 		return nil
 	}
 	if _, err := os.Stat(path); err != nil {
 		return nil
 	}
-	c.warnOnce(w, "Found deprecated node list file %s, please use the TOML config file instead.", path)
+	c.warnDeprecatedOnce(w, dep, path)
 	var nodelist []string
 	if err := common.LoadJSON(path, &nodelist); err != nil {
 		log.Error(fmt.Sprintf("Can't load node list file: %v", err))
@@ -270,7 +477,11 @@ func (c *Config) AccountConfig() (int, int, string, error) {
 	}
 	return scryptN, scryptP, keydir, err
 }
-func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
+func makeAccountManager(conf *Config, audit *accountAuditor, index *keystoreIndex) (*accounts.Manager, *hotBackend, *keyStoreV4, string, error) {
+	format, err := conf.keyStoreFormat()
+	if err != nil {
+		return nil, nil, nil, "", err
+	}
 	scryptN, scryptP, keydir, err := conf.AccountConfig()
 	var ephemeral string
 	if keydir == "" {
@@ -278,10 +489,10 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 		ephemeral = keydir
 	}
 	if err != nil {
-		return nil, "", err
+		return nil, nil, nil, "", err
 	}
 	if err := os.MkdirAll(keydir, 0700); err != nil {
-		return nil, "", err
+		return nil, nil, nil, "", err
 	}
 	var backends []accounts.Backend
 	if len(conf.ExternalSigner) > 0 {
@@ -289,11 +500,21 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 		if extapi, err := external.NewExternalBackend(conf.ExternalSigner); err == nil {
 			backends = append(backends, extapi)
 		} else {
-			return nil, "", fmt.Errorf("error connecting to external signer: %v", err)
+			return nil, nil, nil, "", fmt.Errorf("error connecting to external signer: %v", err)
 		}
 	}
+	var v4 *keyStoreV4
 	if len(backends) == 0 {
-		backends = append(backends, keystore.NewKeyStore(keydir, scryptN, scryptP))
+		if index != nil {
+			v4 = newKeyStoreV4(keydir, conf.argon2Params(), index, &keyStoreLegacy{scryptN: scryptN, scryptP: scryptP, write: format != KeyStoreFormatV4})
+			backends = append(backends, audit.wrap(v4))
+		} else {
+			v4 = newKeyStoreV4(keydir, conf.argon2Params(), nil, nil)
+			backends = append(backends, keystore.NewKeyStore(keydir, scryptN, scryptP), audit.wrap(v4))
+		}
+		if format == KeyStoreFormatV4 {
+			log.Info("Writing new keys in argon2id keystore format", "keydir", keydir)
+		}
 		if !conf.NoUSB {
 			if ledgerhub, err := usbwallet.NewLedgerHub(); err != nil {
 				log.Warn(fmt.Sprintf("Failed to start Ledger hub, disabling: %v", err))
@@ -319,19 +540,25 @@ func makeAccountManager(conf *Config) (*accounts.Manager, string, error) {
 			}
 		}
 	}
-	return accounts.NewManager(&accounts.Config{InsecureUnlockAllowed: conf.InsecureUnlockAllowed}, backends...), ephemeral, nil
+	hot := newHotBackend()
+	backends = append(backends, audit.wrap(hot))
+	am := accounts.NewManager(&accounts.Config{InsecureUnlockAllowed: conf.InsecureUnlockAllowed}, backends...)
+	audit.watch(am)
+	return am, hot, v4, ephemeral, nil
 }
 var warnLock sync.Mutex
-func (c *Config) warnOnce(w *bool, format string, args ...interface{}) {
+func (c *Config) warnDeprecatedOnce(w *bool, dep *ConfigDeprecation, path string) {
 	warnLock.Lock()
 	defer warnLock.Unlock()
 	if *w {
 		return
 	}
-	l := c.Logger
-	if l == nil {
-		l = log.Root()
-	}
-	l.Warn(fmt.Sprintf(format, args...))
+	dep.warn(c.logger(), "path", path)
 	*w = true
 }
+func (c *Config) logger() log.Logger {
+	if c.Logger == nil {
+		return log.Root()
+	}
+	return c.Logger
+}
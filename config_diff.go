@@ -0,0 +1,132 @@
+package node
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"github.com/naoina/toml"
+	"github.com/naoina/toml/ast"
+)
+type ConfigChange struct {
+	Field string      `json:"field"`
+	Live  interface{} `json:"live"`
+	Disk  interface{} `json:"disk"`
+}
+type ConfigDiff struct {
+	File    string         `json:"file"`
+	Changes []ConfigChange `json:"changes"`
+}
+var configFileSettings = toml.Config{
+	NormFieldName: func(rt reflect.Type, key string) string { return key },
+	FieldToKey:    func(rt reflect.Type, field string) string { return field },
+	MissingField:  func(rt reflect.Type, field string) error { return nil },
+}
+func LoadConfigFile(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	conf := DefaultConfig
+	file := struct{ Node *Config }{Node: &conf}
+	if err := configFileSettings.NewDecoder(bufio.NewReader(f)).Decode(&file); err != nil {
+		return nil, err
+	}
+	return &conf, nil
+}
+func configFileKeys(path string) (map[string]bool, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	root, err := toml.Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]bool)
+	if section, ok := root.Fields["Node"].(*ast.Table); ok {
+		collectConfigKeys(section, "", keys)
+	}
+	return keys, nil
+}
+func collectConfigKeys(table *ast.Table, prefix string, keys map[string]bool) {
+	for key, value := range table.Fields {
+		keys[prefix+key] = true
+		if sub, ok := value.(*ast.Table); ok {
+			collectConfigKeys(sub, prefix+key+".", keys)
+		}
+	}
+}
+func flattenConfig(v reflect.Value, prefix string, fields map[string]reflect.Value, order *[]string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" || strings.HasPrefix(field.Tag.Get("toml"), "-") {
+			continue
+		}
+		value := v.Field(i)
+		switch value.Kind() {
+		case reflect.Func, reflect.Chan, reflect.Interface, reflect.UnsafePointer:
+			continue
+		case reflect.Struct:
+			flattenConfig(value, prefix+field.Name+".", fields, order)
+			continue
+		}
+		fields[prefix+field.Name] = value
+		*order = append(*order, prefix+field.Name)
+	}
+}
+func (n *Node) ConfigDiff() (*ConfigDiff, error) {
+	n.lock.RLock()
+	live := *n.config
+	n.lock.RUnlock()
+	if live.ConfigFile == "" {
+		return nil, ErrNoConfigFile
+	}
+	var (
+		loader = live.ConfigFileLoader
+		keys   map[string]bool
+	)
+	if loader == nil {
+		k, err := configFileKeys(live.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		loader, keys = LoadConfigFile, k
+	}
+	disk, err := loader(live.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if disk.ConfigKeyProvider == nil {
+		disk.ConfigKeyProvider = live.ConfigKeyProvider
+	}
+	if err := disk.DecryptValues(); err != nil {
+		return nil, err
+	}
+	var order []string
+	liveFields, diskFields := make(map[string]reflect.Value), make(map[string]reflect.Value)
+	flattenConfig(reflect.ValueOf(live), "", liveFields, &order)
+	flattenConfig(reflect.ValueOf(*disk), "", diskFields, new([]string))
+	decrypted := make(map[string]bool)
+	for _, fields := range []map[string]bool{live.decryptedFields, disk.decryptedFields} {
+		for path := range fields {
+			decrypted[path] = true
+		}
+	}
+	liveShown, diskShown := make(map[string]reflect.Value), make(map[string]reflect.Value)
+	flattenConfig(reflect.ValueOf(redactConfig(live, decrypted)), "", liveShown, new([]string))
+	flattenConfig(reflect.ValueOf(redactConfig(*disk, decrypted)), "", diskShown, new([]string))
+	diff := &ConfigDiff{File: live.ConfigFile, Changes: []ConfigChange{}}
+	for _, path := range order {
+		if keys != nil && !keys[path] {
+			continue
+		}
+		if reflect.DeepEqual(liveFields[path].Interface(), diskFields[path].Interface()) {
+			continue
+		}
+		diff.Changes = append(diff.Changes, ConfigChange{Field: path, Live: liveShown[path].Interface(), Disk: diskShown[path].Interface()})
+	}
+	return diff, nil
+}
@@ -0,0 +1,215 @@
+package node
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"github.com/Cryptochain-VON/core/rawdb"
+	"github.com/Cryptochain-VON/ethdb"
+)
+type DatabaseHook func(name string, db ethdb.Database) error
+type DatabaseHooks struct {
+	PostOpen   DatabaseHook
+	Checkpoint DatabaseHook
+	PreClose   DatabaseHook
+}
+func (n *Node) AddDatabaseHooks(hooks DatabaseHooks) {
+	n.dbLock.Lock()
+	defer n.dbLock.Unlock()
+	n.dbHooks = append(n.dbHooks, hooks)
+}
+func (n *Node) OpenDatabase(name string, cache, handles int, namespace string) (ethdb.Database, error) {
+	return n.openDatabase(nil, name, cache, handles, namespace)
+}
+func (n *Node) openDatabase(owner *serviceKey, name string, cache, handles int, namespace string) (ethdb.Database, error) {
+	n.dbOpenLock.Lock()
+	defer n.dbOpenLock.Unlock()
+	if n.config.DataDir == "" {
+		return n.openMemoryDatabase(owner, name)
+	}
+	path := n.config.ResolvePath(name)
+	kind := fmt.Sprintf("leveldb (namespace %q)", namespace)
+	if db, err := n.shareDatabase(owner, path, name, kind); db != nil || err != nil {
+		return db, err
+	}
+	db, err := rawdb.NewLevelDBDatabase(path, cache, handles, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return n.trackDatabase(owner, path, name, kind, db)
+}
+func (n *Node) openMemoryDatabase(owner *serviceKey, name string) (ethdb.Database, error) {
+	if db, err := n.shareDatabase(owner, "memory:"+name, name, "memory"); db != nil || err != nil {
+		return db, err
+	}
+	return n.trackDatabase(owner, "memory:"+name, name, "memory", rawdb.NewMemoryDatabase())
+}
+func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer, namespace string) (ethdb.Database, error) {
+	return n.openDatabaseWithFreezer(nil, name, cache, handles, freezer, namespace)
+}
+func (n *Node) openDatabaseWithFreezer(owner *serviceKey, name string, cache, handles int, freezer, namespace string) (ethdb.Database, error) {
+	n.dbOpenLock.Lock()
+	defer n.dbOpenLock.Unlock()
+	if n.config.DataDir == "" {
+		return n.openMemoryDatabase(owner, name)
+	}
+	root := n.config.ResolvePath(name)
+	switch {
+	case freezer == "":
+		freezer = filepath.Join(root, "ancient")
+	case !filepath.IsAbs(freezer):
+		freezer = n.config.ResolvePath(freezer)
+	}
+	kind := fmt.Sprintf("leveldb with freezer %s (namespace %q)", freezer, namespace)
+	if db, err := n.shareDatabase(owner, root, name, kind); db != nil || err != nil {
+		return db, err
+	}
+	db, err := rawdb.NewLevelDBDatabaseWithFreezer(root, cache, handles, freezer, namespace)
+	if err != nil {
+		return nil, err
+	}
+	return n.trackDatabase(owner, root, name, kind, db)
+}
+type sharedDatabase struct {
+	ethdb.Database
+	key  string
+	name string
+	kind string
+	refs int
+}
+type closeTrackingDB struct {
+	ethdb.Database
+	shared *sharedDatabase
+	owner  *serviceKey
+	n      *Node
+	once   sync.Once
+}
+func (db *closeTrackingDB) Close() error {
+	var err error
+	db.once.Do(func() { err = db.n.releaseDatabase(db) })
+	return err
+}
+func (n *Node) releaseDatabase(handle *closeTrackingDB) error {
+	n.dbLock.Lock()
+	shared := handle.shared
+	delete(n.databases, handle)
+	shared.refs--
+	if shared.refs > 0 || n.sharedDBs[shared.key] != shared {
+		n.dbLock.Unlock()
+		return nil
+	}
+	delete(n.sharedDBs, shared.key)
+	hooks := n.dbHooks
+	n.dbLock.Unlock()
+	n.runPreClose(hooks, shared)
+	return shared.Database.Close()
+}
+func (n *Node) runPreClose(hooks []DatabaseHooks, db *sharedDatabase) {
+	for _, hook := range hooks {
+		if hook.PreClose == nil {
+			continue
+		}
+		if err := hook.PreClose(db.name, db.Database); err != nil {
+			n.log.Warn("Database pre-close hook failed", "database", db.name, "err", err)
+		}
+	}
+}
+func (n *Node) shareDatabase(owner *serviceKey, key, name, kind string) (ethdb.Database, error) {
+	n.dbLock.Lock()
+	defer n.dbLock.Unlock()
+	shared, ok := n.sharedDBs[key]
+	if !ok {
+		return nil, nil
+	}
+	if shared.kind != kind {
+		return nil, &DatabaseKindError{Name: name, Open: shared.kind, Requested: kind}
+	}
+	shared.refs++
+	n.log.Debug("Sharing open database", "database", shared.name, "refs", shared.refs)
+	return n.newDatabaseHandle(owner, shared), nil
+}
+func (n *Node) newDatabaseHandle(owner *serviceKey, shared *sharedDatabase) *closeTrackingDB {
+	handle := &closeTrackingDB{Database: shared.Database, shared: shared, owner: owner, n: n}
+	n.databases[handle] = struct{}{}
+	return handle
+}
+func (n *Node) trackDatabase(owner *serviceKey, key, name, kind string, db ethdb.Database) (ethdb.Database, error) {
+	n.dbLock.Lock()
+	hooks := n.dbHooks
+	n.dbLock.Unlock()
+	for _, hook := range hooks {
+		if hook.PostOpen == nil {
+			continue
+		}
+		if err := hook.PostOpen(name, db); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+	n.dbLock.Lock()
+	defer n.dbLock.Unlock()
+	shared := &sharedDatabase{Database: db, key: key, name: name, kind: kind, refs: 1}
+	n.sharedDBs[key] = shared
+	return n.newDatabaseHandle(owner, shared), nil
+}
+func (n *Node) openDatabases() []*sharedDatabase {
+	n.dbLock.Lock()
+	defer n.dbLock.Unlock()
+	dbs := make([]*sharedDatabase, 0, len(n.sharedDBs))
+	for _, db := range n.sharedDBs {
+		dbs = append(dbs, db)
+	}
+	return dbs
+}
+func (n *Node) checkpointDatabases() {
+	dbs := n.openDatabases()
+	n.dbLock.Lock()
+	hooks := n.dbHooks
+	n.dbLock.Unlock()
+	for _, hook := range hooks {
+		if hook.Checkpoint == nil {
+			continue
+		}
+		for _, db := range dbs {
+			if err := hook.Checkpoint(db.name, db.Database); err != nil {
+				n.log.Warn("Database checkpoint hook failed", "database", db.name, "err", err)
+			}
+		}
+	}
+}
+func (n *Node) closeDatabases(stalled map[serviceKey]bool) {
+	n.closeDatabasesExcept(nil, stalled)
+}
+func (n *Node) closeDatabasesExcept(keep []*sharedDatabase, stalled map[serviceKey]bool) {
+	kept := make(map[*sharedDatabase]bool, len(keep))
+	for _, db := range keep {
+		kept[db] = true
+	}
+	n.dbLock.Lock()
+	for handle := range n.databases {
+		if handle.owner != nil && stalled[*handle.owner] && !kept[handle.shared] {
+			kept[handle.shared] = true
+			n.log.Warn("Leaving database open for stalled service", "database", handle.shared.name, "service", *handle.owner)
+		}
+	}
+	var closing []*sharedDatabase
+	for key, db := range n.sharedDBs {
+		if !kept[db] {
+			delete(n.sharedDBs, key)
+			closing = append(closing, db)
+		}
+	}
+	for handle := range n.databases {
+		if !kept[handle.shared] {
+			delete(n.databases, handle)
+		}
+	}
+	hooks := n.dbHooks
+	n.dbLock.Unlock()
+	for _, db := range closing {
+		n.log.Warn("Force-closing database", "database", db.name, "refs", db.refs)
+		n.runPreClose(hooks, db)
+		if err := db.Database.Close(); err != nil {
+			n.log.Error("Failed to close database", "database", db.name, "err", err)
+		}
+	}
+}
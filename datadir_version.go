@@ -0,0 +1,46 @@
+package node
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+const (
+	datadirVersionStamp  = "VERSION"
+	DatadirFormatVersion = 1
+)
+type DatadirStamp struct {
+	Format  int       `json:"format"`
+	Release string    `json:"release,omitempty"`
+	Written time.Time `json:"written"`
+}
+func checkDatadirStamp(instdir, release string, now time.Time) (*DatadirStamp, error) {
+	path := filepath.Join(instdir, datadirVersionStamp)
+	blob, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		stamp := new(DatadirStamp)
+		if err := json.Unmarshal(blob, stamp); err != nil {
+			return nil, &ErrDatadirIncompatible{Path: path, Err: err}
+		}
+		if stamp.Format > DatadirFormatVersion {
+			return stamp, &ErrDatadirIncompatible{Path: path, Have: stamp.Format, Release: stamp.Release}
+		}
+		if stamp.Format == DatadirFormatVersion {
+			return stamp, nil
+		}
+	}
+	stamp := &DatadirStamp{Format: DatadirFormatVersion, Release: release, Written: now.UTC()}
+	blob, err = json.MarshalIndent(stamp, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(path+".tmp", blob, 0600); err != nil {
+		return nil, err
+	}
+	return stamp, os.Rename(path+".tmp", path)
+}
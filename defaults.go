@@ -4,6 +4,7 @@ import (
 	"os/user"
 	"path/filepath"
 	"runtime"
+	"time"
 	"github.com/Cryptochain-VON/p2p"
 	"github.com/Cryptochain-VON/p2p/nat"
 	"github.com/Cryptochain-VON/rpc"
@@ -16,8 +17,18 @@ const (
 	DefaultGraphQLHost = "localhost" 
 	DefaultGraphQLPort = 8547        
 )
+const (
+	DefaultServiceStopTimeout = 30 * time.Second
+	DefaultDrainTimeout       = 10 * time.Second
+	DefaultNTPDriftThreshold  = 10 * time.Second
+	DefaultNTPCheckInterval   = 10 * time.Minute
+)
+var DefaultAdminModules = []string{"admin", "debug"}
+var resolvedDefaultDataDir = DefaultDataDir()
 var DefaultConfig = Config{
-	DataDir:             DefaultDataDir(),
+	DataDir:             resolvedDefaultDataDir,
+	defaultDataDir:      resolvedDefaultDataDir,
+	dataDirDefaulted:    true,
 	HTTPPort:            DefaultHTTPPort,
 	HTTPModules:         []string{"net", "web3"},
 	HTTPVirtualHosts:    []string{"localhost"},
@@ -26,6 +37,9 @@ var DefaultConfig = Config{
 	WSModules:           []string{"net", "web3"},
 	GraphQLPort:         DefaultGraphQLPort,
 	GraphQLVirtualHosts: []string{"localhost"},
+	GraphQLTimeouts:     rpc.DefaultHTTPTimeouts,
+	ServiceStopTimeout:  DefaultServiceStopTimeout,
+	DrainTimeout:        DefaultDrainTimeout,
 	P2P: p2p.Config{
 		ListenAddr: ":30303",
 		MaxPeers:   50,
@@ -33,30 +47,63 @@ var DefaultConfig = Config{
 	},
 }
 func DefaultDataDir() string {
+	dir, _ := defaultDataDir()
+	return dir
+}
+func defaultDataDir() (string, error) {
 	home := homeDir()
-	if home != "" {
-		switch runtime.GOOS {
-		case "darwin":
-			return filepath.Join(home, "Library", "Ethereum")
-		case "windows":
-			fallback := filepath.Join(home, "AppData", "Roaming", "Ethereum")
-			appdata := windowsAppData()
-			if appdata == "" || isNonEmptyDir(fallback) {
-				return fallback
+	switch runtime.GOOS {
+	case "darwin":
+		if home == "" {
+			return "", ErrNoDefaultDataDir
+		}
+		return filepath.Join(home, "Library", "Ethereum"), nil
+	case "windows":
+		var fallback string
+		if home != "" {
+			fallback = filepath.Join(home, "AppData", "Roaming", "Ethereum")
+			if isNonEmptyDir(fallback) {
+				return fallback, nil
 			}
-			return filepath.Join(appdata, "Ethereum")
-		default:
-			return filepath.Join(home, ".ethereum")
 		}
+		if appdata := windowsAppData(); appdata != "" {
+			return filepath.Join(appdata, "Ethereum"), nil
+		}
+		if fallback == "" {
+			return "", ErrNoDefaultDataDir
+		}
+		return fallback, nil
+	default:
+		if home == "" {
+			return "", ErrNoDefaultDataDir
+		}
+		return filepath.Join(home, ".ethereum"), nil
 	}
-	return ""
+}
+func (c *Config) DefaultDataDir() (string, error) {
+	if c.DefaultDataDirOverride == nil {
+		return defaultDataDir()
+	}
+	dir, err := c.DefaultDataDirOverride()
+	if err != nil {
+		return "", err
+	}
+	if dir == "" {
+		return "", ErrNoDefaultDataDir
+	}
+	return dir, nil
+}
+func (c *Config) usesDefaultDataDir() bool {
+	return c.dataDirDefaulted && c.DataDir == c.defaultDataDir
 }
 func windowsAppData() string {
-	v := os.Getenv("LOCALAPPDATA")
-	if v == "" {
-		panic("environment variable LocalAppData is undefined")
+	if v := os.Getenv("LOCALAPPDATA"); v != "" {
+		return v
 	}
-	return v
+	if v := os.Getenv("USERPROFILE"); v != "" {
+		return filepath.Join(v, "AppData", "Local")
+	}
+	return ""
 }
 func isNonEmptyDir(dir string) bool {
 	f, err := os.Open(dir)
@@ -0,0 +1,68 @@
+package node
+import (
+	"github.com/Cryptochain-VON/log"
+)
+const (
+	DeprecatedField = "field"
+	DeprecatedFile  = "file"
+)
+type ConfigDeprecation struct {
+	Name           string `json:"name"`
+	Kind           string `json:"kind"`
+	Replacement    string `json:"replacement"`
+	RemovalVersion string `json:"removalVersion,omitempty"`
+	isSet          func(c *Config) bool
+}
+func (d *ConfigDeprecation) warn(logger log.Logger, ctx ...interface{}) {
+	ctx = append([]interface{}{"kind", d.Kind, "name", d.Name, "replacement", d.Replacement}, ctx...)
+	if d.RemovalVersion != "" {
+		ctx = append(ctx, "removal", d.RemovalVersion)
+	}
+	logger.Warn("Deprecated configuration in use", ctx...)
+}
+var (
+	deprecatedStaticNodes = &ConfigDeprecation{
+		Name:        datadirStaticNodes,
+		Kind:        DeprecatedFile,
+		Replacement: "P2P.StaticNodes in the TOML config file",
+	}
+	deprecatedTrustedNodes = &ConfigDeprecation{
+		Name:        datadirTrustedNodes,
+		Kind:        DeprecatedFile,
+		Replacement: "P2P.TrustedNodes in the TOML config file",
+	}
+	deprecatedGethResource = &ConfigDeprecation{
+		Name:        "datadir root resource",
+		Kind:        DeprecatedFile,
+		Replacement: "the 'geth' subdirectory of datadir, see admin_migrateLegacyFiles",
+	}
+	configDeprecations = []*ConfigDeprecation{
+		{
+			Name:           "WSExposeAll",
+			Kind:           DeprecatedField,
+			Replacement:    "WSModules",
+			RemovalVersion: "1.10.0",
+			isSet:          func(c *Config) bool { return c.WSExposeAll },
+		},
+		deprecatedStaticNodes,
+		deprecatedTrustedNodes,
+		deprecatedGethResource,
+	}
+)
+func (c *Config) Deprecations() []ConfigDeprecation {
+	var used []ConfigDeprecation
+	for _, dep := range configDeprecations {
+		if dep.isSet != nil && dep.isSet(c) {
+			used = append(used, *dep)
+		}
+	}
+	return used
+}
+func (c *Config) CheckDeprecations() {
+	logger := c.logger()
+	for _, dep := range configDeprecations {
+		if dep.isSet != nil && dep.isSet(c) {
+			dep.warn(logger)
+		}
+	}
+}
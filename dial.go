@@ -0,0 +1,219 @@
+package node
+import (
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/log"
+	"github.com/Cryptochain-VON/p2p"
+	"github.com/Cryptochain-VON/p2p/enode"
+)
+type DialStatus struct {
+	Concurrency     int                `json:"concurrency"`
+	DialRatio       int                `json:"dialRatio"`
+	PreferStatic    bool               `json:"preferStatic"`
+	RetryBackoff    time.Duration      `json:"retryBackoff"`
+	MaxRetryBackoff time.Duration      `json:"maxRetryBackoff"`
+	Static          []StaticDialStatus `json:"static"`
+}
+type StaticDialStatus struct {
+	Enode     string    `json:"enode"`
+	Connected bool      `json:"connected"`
+	Failures  int       `json:"failures"`
+	NextDial  time.Time `json:"nextDial,omitempty"`
+}
+type dialTarget struct {
+	node      *enode.Node
+	connected bool
+	added     bool
+	addedAt   time.Time
+	failures  int
+	next      time.Time
+}
+type staticDialer struct {
+	server     *p2p.Server
+	log        log.Logger
+	clock      Clock
+	lock       sync.Mutex
+	backoff    time.Duration
+	maxBackoff time.Duration
+	targets    map[enode.ID]*dialTarget
+	order      []enode.ID
+	quit       chan struct{}
+	wg         sync.WaitGroup
+}
+func newStaticDialer(server *p2p.Server, nodes []*enode.Node, backoff, maxBackoff time.Duration, clock Clock, logger log.Logger) *staticDialer {
+	d := &staticDialer{
+		server:     server,
+		log:        logger,
+		clock:      clock,
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		targets:    make(map[enode.ID]*dialTarget),
+		quit:       make(chan struct{}),
+	}
+	for _, node := range nodes {
+		if _, ok := d.targets[node.ID()]; ok {
+			continue
+		}
+		d.targets[node.ID()] = &dialTarget{node: node}
+		d.order = append(d.order, node.ID())
+	}
+	return d
+}
+func (d *staticDialer) start() {
+	events := make(chan *p2p.PeerEvent, 16)
+	sub := d.server.SubscribeEvents(events)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer sub.Unsubscribe()
+		ticker := d.clock.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			d.schedule(d.clock.Now())
+			select {
+			case ev := <-events:
+				d.handle(ev)
+			case <-ticker.C():
+			case <-sub.Err():
+				return
+			case <-d.quit:
+				return
+			}
+		}
+	}()
+}
+func (d *staticDialer) stop() {
+	close(d.quit)
+	d.wg.Wait()
+}
+func (d *staticDialer) handle(ev *p2p.PeerEvent) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	t, ok := d.targets[ev.Peer]
+	if !ok {
+		return
+	}
+	switch ev.Type {
+	case p2p.PeerEventTypeAdd:
+		t.connected, t.failures = true, 0
+	case p2p.PeerEventTypeDrop:
+		t.connected = false
+		d.release(t, d.clock.Now(), false)
+	}
+}
+func (d *staticDialer) schedule(now time.Time) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for _, id := range d.order {
+		t := d.targets[id]
+		switch {
+		case t.connected:
+		case t.added && now.Sub(t.addedAt) >= d.backoff:
+			d.release(t, now, true)
+		case !t.added && !now.Before(t.next):
+			d.server.AddPeer(t.node)
+			t.added, t.addedAt = true, now
+		}
+	}
+}
+func (d *staticDialer) release(t *dialTarget, now time.Time, failed bool) {
+	if t.added {
+		d.server.RemovePeer(t.node)
+		t.added = false
+	}
+	if failed {
+		t.failures++
+	}
+	t.next = now.Add(d.delay(t.failures))
+	if failed {
+		d.log.Debug("Static peer unreachable, backing off", "id", t.node.ID(), "failures", t.failures, "next", t.next)
+	}
+}
+func (d *staticDialer) delay(failures int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < failures && (d.maxBackoff == 0 || delay < d.maxBackoff); i++ {
+		delay *= 2
+	}
+	if d.maxBackoff > 0 && delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
+func (d *staticDialer) setBackoff(backoff, maxBackoff time.Duration) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.backoff, d.maxBackoff = backoff, maxBackoff
+}
+func (d *staticDialer) status() []StaticDialStatus {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	status := make([]StaticDialStatus, 0, len(d.order))
+	for _, id := range d.order {
+		t := d.targets[id]
+		entry := StaticDialStatus{Enode: t.node.String(), Connected: t.connected, Failures: t.failures}
+		if !t.connected && !t.added {
+			entry.NextDial = t.next
+		}
+		status = append(status, entry)
+	}
+	return status
+}
+type dialSettings struct {
+	concurrency  int
+	preferStatic bool
+	backoff      time.Duration
+	maxBackoff   time.Duration
+}
+func (c *Config) dialSettings() dialSettings {
+	return dialSettings{concurrency: c.DialConcurrency, preferStatic: c.PreferStaticPeers, backoff: c.DialRetryBackoff, maxBackoff: c.DialMaxRetryBackoff}
+}
+func (s dialSettings) apply(cfg *p2p.Config) {
+	if s.concurrency > 0 {
+		cfg.MaxPendingPeers = s.concurrency
+	}
+	if !s.preferStatic || cfg.MaxPeers == 0 {
+		return
+	}
+	free := cfg.MaxPeers - len(cfg.StaticNodes)
+	if free < 1 {
+		free = 1
+	}
+	ratio := (cfg.MaxPeers + free - 1) / free
+	if ratio > cfg.DialRatio {
+		cfg.DialRatio = ratio
+	}
+}
+func (n *Node) DialStatus() (*DialStatus, error) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	if n.server == nil {
+		return nil, ErrNodeStopped
+	}
+	status := &DialStatus{
+		Concurrency:     n.serverConfig.MaxPendingPeers,
+		DialRatio:       n.serverConfig.DialRatio,
+		PreferStatic:    n.dial.preferStatic,
+		RetryBackoff:    n.dial.backoff,
+		MaxRetryBackoff: n.dial.maxBackoff,
+		Static:          []StaticDialStatus{},
+	}
+	if n.staticDialer != nil {
+		status.Static = n.staticDialer.status()
+	}
+	return status, nil
+}
+func (n *Node) updateDialSettings(update func(*dialSettings)) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	next := n.dial
+	update(&next)
+	restart := next.concurrency != n.dial.concurrency || next.preferStatic != n.dial.preferStatic || (next.backoff > 0) != (n.dial.backoff > 0)
+	n.dial = next
+	if n.staticDialer != nil && next.backoff > 0 {
+		n.staticDialer.setBackoff(next.backoff, next.maxBackoff)
+	}
+	if restart && n.server != nil {
+		return ErrDialRestartRequired
+	}
+	return nil
+}
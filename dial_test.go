@@ -0,0 +1,145 @@
+package node
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+	"github.com/Cryptochain-VON/crypto"
+	"github.com/Cryptochain-VON/p2p/enode"
+)
+func newDialTestNode(t *testing.T) *Node {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	conf := testNodeConfig()
+	conf.DataDir = testDataDir(t)
+	conf.NoUSB = true
+	conf.P2P.ListenAddr = "127.0.0.1:0"
+	conf.P2P.NoDiscovery = true
+	conf.P2P.MaxPeers = 10
+	conf.P2P.StaticNodes = []*enode.Node{enode.NewV4(&key.PublicKey, net.IP{127, 0, 0, 1}, 1, 1)}
+	conf.DialConcurrency = 4
+	conf.DialRetryBackoff = time.Second
+	conf.DialMaxRetryBackoff = time.Minute
+	return startTestNode(t, conf)
+}
+func TestSetDialConfig(t *testing.T) {
+	intp := func(v int) *int { return &v }
+	boolp := func(v bool) *bool { return &v }
+	strp := func(v string) *string { return &v }
+	tests := []struct {
+		name         string
+		concurrency  *int
+		preferStatic *bool
+		backoff      *string
+		maxBackoff   *string
+		wantErr      error
+		wantInvalid  bool
+		wantDialer   time.Duration
+		want         DialStatus
+		wantRestart  DialStatus
+	}{
+		{
+			name:        "backoff applied live",
+			backoff:     strp("2s"),
+			maxBackoff:  strp("2m"),
+			wantDialer:  2 * time.Second,
+			want:        DialStatus{Concurrency: 4, RetryBackoff: 2 * time.Second, MaxRetryBackoff: 2 * time.Minute},
+			wantRestart: DialStatus{Concurrency: 4, RetryBackoff: 2 * time.Second, MaxRetryBackoff: 2 * time.Minute},
+		},
+		{
+			name:        "concurrency needs restart",
+			concurrency: intp(8),
+			wantErr:     ErrDialRestartRequired,
+			wantDialer:  time.Second,
+			want:        DialStatus{Concurrency: 4, RetryBackoff: time.Second, MaxRetryBackoff: time.Minute},
+			wantRestart: DialStatus{Concurrency: 8, RetryBackoff: time.Second, MaxRetryBackoff: time.Minute},
+		},
+		{
+			name:         "prefer static needs restart",
+			preferStatic: boolp(true),
+			wantErr:      ErrDialRestartRequired,
+			wantDialer:   time.Second,
+			want:         DialStatus{Concurrency: 4, PreferStatic: true, RetryBackoff: time.Second, MaxRetryBackoff: time.Minute},
+			wantRestart:  DialStatus{Concurrency: 4, PreferStatic: true, RetryBackoff: time.Second, MaxRetryBackoff: time.Minute},
+		},
+		{
+			name:        "disabling backoff needs restart",
+			backoff:     strp("0s"),
+			wantErr:     ErrDialRestartRequired,
+			wantDialer:  time.Second,
+			want:        DialStatus{Concurrency: 4, MaxRetryBackoff: time.Minute},
+			wantRestart: DialStatus{Concurrency: 4, MaxRetryBackoff: time.Minute},
+		},
+		{
+			name:        "invalid backoff",
+			concurrency: intp(8),
+			backoff:     strp("soon"),
+			wantInvalid: true,
+			wantDialer:  time.Second,
+			want:        DialStatus{Concurrency: 4, RetryBackoff: time.Second, MaxRetryBackoff: time.Minute},
+			wantRestart: DialStatus{Concurrency: 4, RetryBackoff: time.Second, MaxRetryBackoff: time.Minute},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stack := newDialTestNode(t)
+			api := NewPrivateAdminAPI(stack)
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					api.DumpConfig()
+					stack.DialStatus()
+				}
+			}()
+			ok, err := api.SetDialConfig(tt.concurrency, tt.preferStatic, tt.backoff, tt.maxBackoff)
+			wg.Wait()
+			switch {
+			case tt.wantInvalid:
+				if ok || err == nil {
+					t.Fatalf("invalid settings accepted")
+				}
+			case err != tt.wantErr || ok != (tt.wantErr == nil):
+				t.Fatalf("result mismatch: have %v, %v, want error %v", ok, err, tt.wantErr)
+			}
+			checkDialStatus(t, stack, tt.want)
+			if have := staticDialerBackoff(stack); have != tt.wantDialer {
+				t.Fatalf("static dialer backoff mismatch: have %v, want %v", have, tt.wantDialer)
+			}
+			if stack.config.DialConcurrency != 4 || stack.config.DialRetryBackoff != time.Second || stack.config.PreferStaticPeers {
+				t.Fatalf("node config modified: %+v", stack.config)
+			}
+			if err := stack.RestartP2P(); err != nil {
+				t.Fatalf("failed to restart p2p: %v", err)
+			}
+			checkDialStatus(t, stack, tt.wantRestart)
+			if have := staticDialerBackoff(stack); have != tt.wantRestart.RetryBackoff {
+				t.Fatalf("static dialer backoff after restart mismatch: have %v, want %v", have, tt.wantRestart.RetryBackoff)
+			}
+		})
+	}
+}
+func checkDialStatus(t *testing.T, stack *Node, want DialStatus) {
+	t.Helper()
+	have, err := stack.DialStatus()
+	if err != nil {
+		t.Fatalf("failed to get dial status: %v", err)
+	}
+	if have.Concurrency != want.Concurrency || have.PreferStatic != want.PreferStatic || have.RetryBackoff != want.RetryBackoff || have.MaxRetryBackoff != want.MaxRetryBackoff {
+		t.Fatalf("dial status mismatch: have %d/%v/%v/%v, want %d/%v/%v/%v", have.Concurrency, have.PreferStatic, have.RetryBackoff, have.MaxRetryBackoff, want.Concurrency, want.PreferStatic, want.RetryBackoff, want.MaxRetryBackoff)
+	}
+}
+func staticDialerBackoff(stack *Node) time.Duration {
+	stack.lock.RLock()
+	dialer := stack.staticDialer
+	stack.lock.RUnlock()
+	if dialer == nil {
+		return 0
+	}
+	dialer.lock.Lock()
+	defer dialer.lock.Unlock()
+	return dialer.backoff
+}
@@ -14,8 +14,10 @@ across restarts. Node also loads static and trusted node lists and ensures that
 about other hosts is persisted.
 JSON-RPC servers which run HTTP, WebSocket or IPC can be started on a Node. RPC modules
 offered by registered services will be offered on those endpoints. Users can restrict any
-endpoint to a subset of RPC modules. Node itself offers the "debug", "admin" and "web3"
-modules.
+endpoint to a subset of RPC modules. Node itself offers the "debug", "admin", "web3" and
+"keystore" modules. The "keystore" module creates, imports and unlocks accounts in the
+key store format selected by Config.KeyStoreFormat; it is not registered if a service
+already offers a module of that name.
 Service implementations can open LevelDB databases through the service context. Package
 node chooses the file system location of each database. If the node is configured to run
 without a data directory, databases are opened in memory instead.
@@ -34,6 +36,33 @@ instances use the same data directory, opening the databases with identical name
 create one database for each instance.
 The account key store is shared among all node instances using the same data directory
 unless its location is changed through the KeyStoreDir configuration option.
+Restarting Peer-to-Peer Networking
+Node.RestartP2P stops the running p2p.Server and replaces it with a freshly configured one.
+Services that keep a reference to the server passed to Start, or that subscribe to its peer
+events, must implement P2PRestartHandler to pick up the replacement; the old server and its
+event feed are not revived. Subscriptions to admin_peerEvents receive a final notification
+carrying an error and no further events; clients should unsubscribe and subscribe again.
+Scheduled Backups
+The "backup" scheduled task copies the account key store, the node key and the static and
+trusted node lists into a timestamped directory. It does not copy LevelDB databases such as
+chaindata: they are held open by their services and cannot be copied consistently while the
+node runs. Back up database directories with the node stopped.
+Account Auditing
+With Config.AccountAudit or Config.AccountAuditLog set, Node posts AccountAuditEvent values
+on its event mux and appends them to the audit log. The key store, hardware wallet hubs and
+external signer stay registered with the account manager under their own types, so lookups
+through AccountManager().Backends are unaffected. For their wallets Node records each
+wallet-opened event the backend reports; derivations and signing requests are recorded for
+wallets obtained through Node.AuditedWallet. Wallets of the argon2id key store and of
+backends added with AddAccountBackend are audited on every path.
+Keystore Index
+With Config.KeyStoreIndex set, Node keeps an address to key file index in the instance
+directory. Lookups are answered from the index; the key directory is listed again only when
+its modification time no longer matches the indexed one, and then only new or changed files
+are read. A corrupt index is discarded and rebuilt. In this mode the scrypt and argon2id key
+files are both served by the node's own key store, so AccountManager().Backends does not
+contain a keystore.KeyStore; create and unlock accounts through Node.NewKeyStoreAccount or
+the "keystore" RPC module.
 Data Directory Sharing Example
 In this example, two node instances named A and B are started with the same data
 directory. Node instance A opens the database "db", node instance B opens the databases
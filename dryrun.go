@@ -0,0 +1,124 @@
+package node
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"github.com/prometheus/tsdb/fileutil"
+)
+type DryRunCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+type DryRunReport struct {
+	OK       bool          `json:"ok"`
+	Checks   []DryRunCheck `json:"checks"`
+	Services []string      `json:"services"`
+}
+func (r *DryRunReport) add(name, detail string, err error) {
+	check := DryRunCheck{Name: name, OK: err == nil, Detail: detail}
+	if err != nil {
+		check.Error = err.Error()
+		r.OK = false
+	}
+	r.Checks = append(r.Checks, check)
+}
+func (n *Node) DryRun() (*DryRunReport, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.server != nil {
+		return nil, ErrNodeRunning
+	}
+	report := &DryRunReport{OK: true, Services: []string{}}
+	_, err := loadTLSConfig(n.httpEndpoint, n.config.HTTPTLSCert, n.config.HTTPTLSKey)
+	report.add("http-tls", "", err)
+	if n.config.DataDir != "" {
+		instdir := n.config.instanceDir()
+		report.add("datadir", instdir, checkWritableDir(instdir))
+		report.add("datadir-lock", filepath.Join(instdir, "LOCK"), checkDatadirLock(instdir))
+	}
+	if n.ipcEndpoint != "" && runtime.GOOS != "windows" {
+		report.add("ipc", n.ipcEndpoint, checkIPCEndpoint(n.ipcEndpoint))
+	}
+	if n.httpEndpoint != "" {
+		report.add("http-port", n.httpEndpoint, checkPortAvailable(n.httpEndpoint))
+	}
+	if n.wsEndpoint != "" && !n.wsSharesHTTP() {
+		report.add("ws-port", n.wsEndpoint, checkPortAvailable(n.wsEndpoint))
+	}
+	if endpoint := n.config.GraphQLEndpoint(); endpoint != "" {
+		report.add("graphql-port", endpoint, checkPortAvailable(endpoint))
+	}
+	if addr := n.config.P2P.ListenAddr; addr != "" && !n.config.NoP2P {
+		report.add("p2p-port", addr, checkPortAvailable(addr))
+	}
+	if _, _, keydir, err := n.config.AccountConfig(); err != nil {
+		report.add("keystore", "", err)
+	} else if keydir != "" {
+		_, err := ioutil.ReadDir(keydir)
+		report.add("keystore", keydir, err)
+	}
+	for i, sf := range n.serviceFuncs {
+		name := fmt.Sprintf("constructor #%d", i)
+		if sf.instance != "" {
+			name += " (instance " + sf.instance + ")"
+		}
+		report.Services = append(report.Services, name)
+	}
+	return report, nil
+}
+func checkWritableDir(dir string) error {
+	dir = filepath.Clean(dir)
+	for {
+		info, err := os.Stat(dir)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", dir)
+			}
+			break
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		dir = parent
+	}
+	f, err := ioutil.TempFile(dir, ".dryrun")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+func checkDatadirLock(instdir string) error {
+	path := filepath.Join(instdir, "LOCK")
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	release, _, err := fileutil.Flock(path)
+	if err != nil {
+		return convertFileLockError(err)
+	}
+	return release.Release()
+}
+func checkPortAvailable(endpoint string) error {
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		return convertListenError(endpoint, err)
+	}
+	return listener.Close()
+}
+func checkIPCEndpoint(endpoint string) error {
+	if conn, err := net.Dial("unix", endpoint); err == nil {
+		conn.Close()
+		return fmt.Errorf("IPC endpoint %s is served by another process", endpoint)
+	}
+	return checkWritableDir(filepath.Dir(endpoint))
+}
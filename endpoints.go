@@ -1,18 +1,29 @@
 package node
 import (
+	"crypto/tls"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
 	"time"
 	"github.com/Cryptochain-VON/log"
 	"github.com/Cryptochain-VON/rpc"
 )
 func StartHTTPEndpoint(endpoint string, timeouts rpc.HTTPTimeouts, handler http.Handler) (*http.Server, net.Addr, error) {
+	return startHTTPEndpoint(endpoint, timeouts, nil, 0, handler)
+}
+func startHTTPEndpoint(endpoint string, timeouts rpc.HTTPTimeouts, tlsConfig *tls.Config, maxConns int, handler http.Handler) (*http.Server, net.Addr, error) {
 	var (
 		listener net.Listener
 		err      error
 	)
-	if listener, err = net.Listen("tcp", endpoint); err != nil {
-		return nil, nil, err
+	if listener, err = listen("tcp", endpoint); err != nil {
+		return nil, nil, convertListenError(endpoint, err)
+	}
+	listener = newLimitListener(listener, maxConns)
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
 	}
 	CheckTimeouts(&timeouts)
 	httpSrv := &http.Server{
@@ -21,21 +32,99 @@ func StartHTTPEndpoint(endpoint string, timeouts rpc.HTTPTimeouts, handler http.
 		WriteTimeout: timeouts.WriteTimeout,
 		IdleTimeout:  timeouts.IdleTimeout,
 	}
-	go httpSrv.Serve(listener)
+	serveEndpoint(httpSrv, listener)
 	return httpSrv, listener.Addr(), err
 }
-func startWSEndpoint(endpoint string, handler http.Handler) (*http.Server, net.Addr, error) {
+func startHTTPUnixEndpoint(path string, timeouts rpc.HTTPTimeouts, handler http.Handler) (*http.Server, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0751); err != nil {
+		return nil, err
+	}
+	listener := takeActivatedListener("unix", path)
+	if listener == nil {
+		if err := clearStaleSocket(path); err != nil {
+			return nil, err
+		}
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, convertListenError(path, err)
+		}
+		os.Chmod(path, 0600)
+		listener = l
+	}
+	CheckTimeouts(&timeouts)
+	httpSrv := &http.Server{
+		Handler:      handler,
+		ReadTimeout:  timeouts.ReadTimeout,
+		WriteTimeout: timeouts.WriteTimeout,
+		IdleTimeout:  timeouts.IdleTimeout,
+	}
+	serveEndpoint(httpSrv, listener)
+	return httpSrv, nil
+}
+func startWSEndpoint(endpoint string, timeouts rpc.HTTPTimeouts, maxConns int, handler http.Handler) (*http.Server, net.Addr, error) {
 	var (
 		listener net.Listener
 		err      error
 	)
-	if listener, err = net.Listen("tcp", endpoint); err != nil {
-		return nil, nil, err
+	if listener, err = listen("tcp", endpoint); err != nil {
+		return nil, nil, convertListenError(endpoint, err)
+	}
+	listener = newLimitListener(listener, maxConns)
+	wsSrv := &http.Server{
+		Handler:      handler,
+		ReadTimeout:  timeouts.ReadTimeout,
+		WriteTimeout: timeouts.WriteTimeout,
+		IdleTimeout:  timeouts.IdleTimeout,
 	}
-	wsSrv := &http.Server{Handler: handler}
-	go wsSrv.Serve(listener)
+	serveEndpoint(wsSrv, listener)
 	return wsSrv, listener.Addr(), err
 }
+type servingListener struct {
+	net.Listener
+	serving chan struct{}
+	once    sync.Once
+}
+func (l *servingListener) Accept() (net.Conn, error) {
+	l.once.Do(func() { close(l.serving) })
+	return l.Listener.Accept()
+}
+func serveEndpoint(srv *http.Server, listener net.Listener) {
+	sl := &servingListener{Listener: listener, serving: make(chan struct{})}
+	done := make(chan struct{})
+	go func() {
+		srv.Serve(sl)
+		close(done)
+	}()
+	select {
+	case <-sl.serving:
+	case <-done:
+	}
+}
+func filterAPIs(apis []rpc.API, modules []string) []rpc.API {
+	whitelist := make(map[string]bool)
+	for _, module := range modules {
+		whitelist[module] = true
+	}
+	var filtered []rpc.API
+	for _, api := range apis {
+		if whitelist[api.Namespace] {
+			filtered = append(filtered, api)
+		}
+	}
+	return filtered
+}
+func boundEndpoint(endpoint string, addr net.Addr) string {
+	if _, port, err := net.SplitHostPort(endpoint); err == nil && port == "0" && addr != nil {
+		return addr.String()
+	}
+	return endpoint
+}
+func checkModules(modules []string, apis []rpc.API) error {
+	if bad, available := checkModuleAvailability(modules, apis); len(bad) > 0 {
+		return &ErrInvalidWhitelist{Modules: bad, Available: available}
+	}
+	return nil
+}
 func checkModuleAvailability(modules []string, apis []rpc.API) (bad, available []string) {
 	availableSet := make(map[string]struct{})
 	for _, api := range apis {
@@ -0,0 +1,154 @@
+package node
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"github.com/Cryptochain-VON/rpc"
+)
+const (
+	endpointAuthNone   = "none"
+	endpointAuthCustom = "custom"
+)
+type EndpointInfo struct {
+	URL     string   `json:"url"`
+	Modules []string `json:"modules,omitempty"`
+	TLS     bool     `json:"tls,omitempty"`
+	Auth    string   `json:"auth"`
+}
+type EndpointsInfo struct {
+	IPC     *EndpointInfo `json:"ipc,omitempty"`
+	HTTP    *EndpointInfo `json:"http,omitempty"`
+	WS      *EndpointInfo `json:"ws,omitempty"`
+	GraphQL *EndpointInfo `json:"graphql,omitempty"`
+	Admin   *EndpointInfo `json:"admin,omitempty"`
+}
+func (n *Node) Endpoints() EndpointsInfo {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.endpointsInfo()
+}
+func authDescription(provider AuthProvider) string {
+	switch p := provider.(type) {
+	case nil:
+		return endpointAuthNone
+	case *BearerTokenAuthProvider:
+		return AuthProviderBearer
+	case *APIKeyAuthProvider:
+		return AuthProviderAPIKey
+	case *JWTAuthProvider:
+		return AuthProviderJWT
+	case *MTLSAuthProvider:
+		return AuthProviderMTLS
+	case AuthChain:
+		names := make([]string, len(p))
+		for i, inner := range p {
+			names[i] = authDescription(inner)
+		}
+		return strings.Join(names, ",")
+	default:
+		return endpointAuthCustom
+	}
+}
+func (n *Node) endpointsInfo() EndpointsInfo {
+	var info EndpointsInfo
+	auth := authDescription(n.auth)
+	if n.ipcListener != nil {
+		apis := n.rpcAPIs
+		if len(n.config.IPCModules) > 0 {
+			apis = filterAPIs(apis, n.config.IPCModules)
+		}
+		info.IPC = &EndpointInfo{URL: n.ipcEndpoint, Modules: enabledModules(apis, nil, true), Auth: endpointAuthNone}
+	}
+	if n.httpHandler != nil && n.httpListenerAddr != nil {
+		scheme := "http://"
+		if n.httpTLS {
+			scheme = "https://"
+		}
+		info.HTTP = &EndpointInfo{
+			URL:     scheme + n.httpListenerAddr.String(),
+			Modules: enabledModules(n.publicAPIs(n.rpcAPIs), n.httpWhitelist, false),
+			TLS:     n.httpTLS,
+			Auth:    auth,
+		}
+		if n.wsSharesHTTP() {
+			info.WS = &EndpointInfo{
+				URL:     "ws://" + n.httpListenerAddr.String(),
+				Modules: info.HTTP.Modules,
+				TLS:     n.httpTLS,
+				Auth:    auth,
+			}
+			if n.httpTLS {
+				info.WS.URL = "wss://" + n.httpListenerAddr.String()
+			}
+		}
+	}
+	if n.wsHandler != nil && n.wsListenerAddr != nil {
+		info.WS = &EndpointInfo{
+			URL:     "ws://" + n.wsListenerAddr.String(),
+			Modules: enabledModules(n.publicAPIs(n.rpcAPIs), n.wsWhitelist, n.wsExposeAll),
+			Auth:    auth,
+		}
+	}
+	info.GraphQL = n.graphqlInfo()
+	if n.adminHandler != nil && n.adminListenerAddr != nil {
+		info.Admin = &EndpointInfo{
+			URL:     "http://" + n.adminListenerAddr.String(),
+			Modules: enabledModules(n.rpcAPIs, n.config.adminModules(), false),
+			Auth:    authDescription(n.config.adminAuthProvider()),
+		}
+	}
+	return info
+}
+func enabledModules(apis []rpc.API, modules []string, exposeAll bool) []string {
+	whitelist := make(map[string]bool)
+	for _, module := range modules {
+		whitelist[module] = true
+	}
+	seen := make(map[string]bool)
+	var enabled []string
+	for _, api := range apis {
+		if seen[api.Namespace] {
+			continue
+		}
+		if exposeAll || whitelist[api.Namespace] || (len(whitelist) == 0 && api.Public) {
+			seen[api.Namespace] = true
+			enabled = append(enabled, api.Namespace)
+		}
+	}
+	sort.Strings(enabled)
+	return enabled
+}
+func (n *Node) endpointsFilePath() string {
+	if !n.config.WriteEndpointsFile || n.config.DataDir == "" {
+		return ""
+	}
+	return filepath.Join(n.config.instanceDir(), datadirEndpointsFile)
+}
+func (n *Node) writeEndpointsFile() error {
+	path := n.endpointsFilePath()
+	if path == "" {
+		return nil
+	}
+	blob, err := json.MarshalIndent(n.endpointsInfo(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, blob, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+func (n *Node) updateEndpointsFile() {
+	if err := n.writeEndpointsFile(); err != nil {
+		n.log.Warn("Failed to update endpoints file", "err", err)
+	}
+}
+func (n *Node) removeEndpointsFile() {
+	if path := n.endpointsFilePath(); path != "" {
+		os.Remove(path)
+	}
+}
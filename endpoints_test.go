@@ -0,0 +1,72 @@
+package node
+import (
+	"context"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+func TestHTTPUnixSocketStack(t *testing.T) {
+	tests := []struct {
+		name       string
+		token      string
+		host       string
+		origin     string
+		body       string
+		wantStatus int
+	}{
+		{name: "missing credentials", body: `{"jsonrpc":"2.0","id":1,"method":"web3_clientVersion"}`, wantStatus: http.StatusUnauthorized},
+		{name: "wrong credentials", token: "wrong", body: `{"jsonrpc":"2.0","id":1,"method":"web3_clientVersion"}`, wantStatus: http.StatusUnauthorized},
+		{name: "authenticated", token: "secret", body: `{"jsonrpc":"2.0","id":1,"method":"web3_clientVersion"}`, wantStatus: http.StatusOK},
+		{name: "body limit", token: "secret", body: `{"jsonrpc":"2.0","id":1,"method":"web3_clientVersion","params":["` + strings.Repeat("a", 512) + `"]}`, wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "vhosts not applied", token: "secret", host: "unlisted.example", body: `{"jsonrpc":"2.0","id":1,"method":"web3_clientVersion"}`, wantStatus: http.StatusOK},
+		{name: "cors not applied", token: "secret", origin: "http://allowed.example", body: `{"jsonrpc":"2.0","id":1,"method":"web3_clientVersion"}`, wantStatus: http.StatusOK},
+	}
+	conf := testNodeConfig()
+	conf.DataDir = testDataDir(t)
+	conf.NoUSB = true
+	conf.HTTPHost = "127.0.0.1"
+	conf.HTTPPort = freeTCPAddr(t).Port
+	conf.HTTPCors = []string{"http://allowed.example"}
+	conf.HTTPVirtualHosts = []string{"localhost"}
+	conf.HTTPUnixSocket = "http.sock"
+	conf.RPCMaxRequestBytes = 256
+	conf.AuthProvider = &BearerTokenAuthProvider{Token: "secret", Subject: "test"}
+	startTestNode(t, conf)
+	path := filepath.Join(conf.DataDir, conf.HTTPUnixSocket)
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, "unix", path)
+		},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost/", strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.host != "" {
+				req.Host = tt.host
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status mismatch: have %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if allowed := resp.Header.Get("Access-Control-Allow-Origin"); allowed != "" {
+				t.Fatalf("cors header set on unix socket: %q", allowed)
+			}
+		})
+	}
+}
@@ -2,15 +2,41 @@ package node
 import (
 	"errors"
 	"fmt"
+	"net"
 	"reflect"
+	"strings"
 	"syscall"
 )
 var (
-	ErrDatadirUsed    = errors.New("datadir already used by another process")
-	ErrNodeStopped    = errors.New("node not started")
-	ErrNodeRunning    = errors.New("node already running")
-	ErrServiceUnknown = errors.New("unknown service")
+	ErrDatadirUsed           = errors.New("datadir already used by another process")
+	ErrNodeStopped           = errors.New("node not started")
+	ErrNodeRunning           = errors.New("node already running")
+	ErrServiceUnknown        = errors.New("unknown service")
+	ErrServiceStopTimeout    = errors.New("service stop timed out")
+	ErrKeyStoreIndexOff      = errors.New("keystore index not enabled")
+	ErrKeyFileUnknown        = errors.New("no key file for address")
+	ErrNoPassphraseProvider  = errors.New("no passphrase provider configured")
+	ErrBackendUnknown        = errors.New("unknown account backend")
+	ErrBackendExists         = errors.New("account backend already attached")
+	ErrInvalidConfigKey      = errors.New("config key must be 32 bytes, hex or base64 encoded")
+	ErrInvalidEncryptedValue = errors.New("malformed or undecryptable encrypted config value")
+	ErrP2PNotStarted         = errors.New("p2p networking not started")
+	ErrP2PRunning            = errors.New("p2p networking already running")
+	ErrP2PStopped            = errors.New("p2p networking stopped or restarted")
+	ErrNoConfigFile          = errors.New("node has no associated config file")
+	ErrFeatureFlagImmutable  = errors.New("feature flag cannot be changed at runtime")
+	ErrKeyStoreUnavailable   = errors.New("no local keystore configured")
+	ErrWSClientUnknown       = errors.New("unknown websocket client")
+	ErrMetricsDisabled       = errors.New("metrics collection is disabled")
+	ErrNoDefaultDataDir      = errors.New("cannot determine default datadir: set HOME, LOCALAPPDATA or USERPROFILE, or configure DataDir explicitly")
+	ErrNoCredentials         = errors.New("no credentials presented")
+	ErrInsecureUnlock        = errors.New("account unlock with HTTP access is forbidden")
+	ErrUnlockDuration        = errors.New("unlock duration too large")
+	ErrDialRestartRequired   = errors.New("dial settings saved, restart p2p networking to apply them")
+	errListenerClosed       = errors.New("listener closed")
+	errRequestTooLarge      = errors.New("request too large")
 	datadirInUseErrnos = map[uint]bool{11: true, 32: true, 35: true}
+	addrInUseErrnos    = map[uint]bool{48: true, 98: true, 10048: true}
 )
 func convertFileLockError(err error) error {
 	if errno, ok := err.(syscall.Errno); ok && datadirInUseErrnos[uint(errno)] {
@@ -18,16 +44,270 @@ func convertFileLockError(err error) error {
 	}
 	return err
 }
+type ErrPortInUse struct {
+	Endpoint string
+	Addr     string
+	Err      error
+}
+func (e *ErrPortInUse) Error() string {
+	return fmt.Sprintf("endpoint %s: address %s already in use", e.Endpoint, e.Addr)
+}
+func (e *ErrPortInUse) Unwrap() error {
+	return e.Err
+}
+type ErrDatadirIncompatible struct {
+	Path    string
+	Have    int
+	Release string
+	Err     error
+}
+func (e *ErrDatadirIncompatible) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("unreadable datadir version stamp %s: %v", e.Path, e.Err)
+	}
+	release := e.Release
+	if release == "" {
+		release = "unknown release"
+	}
+	return fmt.Sprintf("datadir format %d (written by %s) is newer than supported format %d, refusing to open", e.Have, release, DatadirFormatVersion)
+}
+func (e *ErrDatadirIncompatible) Unwrap() error {
+	return e.Err
+}
+type ErrSocketInUse struct {
+	Path string
+	Err  error
+}
+func (e *ErrSocketInUse) Error() string {
+	return fmt.Sprintf("unix socket %s is in use or not removable: %v", e.Path, e.Err)
+}
+func (e *ErrSocketInUse) Unwrap() error {
+	return e.Err
+}
+type ErrInvalidWhitelist struct {
+	Modules   []string
+	Available []string
+}
+func (e *ErrInvalidWhitelist) Error() string {
+	return fmt.Sprintf("unavailable modules %v in API whitelist, available: %v", e.Modules, e.Available)
+}
+type ErrTLSConfig struct {
+	Endpoint string
+	Err      error
+}
+func (e *ErrTLSConfig) Error() string {
+	return fmt.Sprintf("invalid TLS configuration for endpoint %s: %v", e.Endpoint, e.Err)
+}
+func (e *ErrTLSConfig) Unwrap() error {
+	return e.Err
+}
+func convertListenError(endpoint string, err error) error {
+	var errno syscall.Errno
+	if !errors.As(err, &errno) || !addrInUseErrnos[uint(errno)] {
+		return err
+	}
+	addr := endpoint
+	if operr, ok := err.(*net.OpError); ok && operr.Addr != nil {
+		addr = operr.Addr.String()
+	}
+	return &ErrPortInUse{Endpoint: endpoint, Addr: addr, Err: err}
+}
+type SubscriptionQuotaError struct {
+	Scope string
+	Limit int
+}
+func (e *SubscriptionQuotaError) Error() string {
+	return fmt.Sprintf("subscription quota exceeded: at most %d active subscriptions per %s", e.Limit, e.Scope)
+}
+func (e *SubscriptionQuotaError) ErrorCode() int {
+	return -32005
+}
+type RequestQuotaError struct {
+	Period string
+	Limit  uint64
+}
+func (e *RequestQuotaError) Error() string {
+	return fmt.Sprintf("%s request quota of %d exceeded", e.Period, e.Limit)
+}
+func (e *RequestQuotaError) ErrorCode() int {
+	return -32005
+}
+type WorkerPoolSaturatedError struct {
+	Namespace string
+}
+func (e *WorkerPoolSaturatedError) Error() string {
+	return "worker pool for namespace " + e.Namespace + " is saturated"
+}
+func (e *WorkerPoolSaturatedError) ErrorCode() int {
+	return -32005
+}
+type DatabaseKindError struct {
+	Name      string
+	Open      string
+	Requested string
+}
+func (e *DatabaseKindError) Error() string {
+	return fmt.Sprintf("database %s is already open as %s, cannot reopen as %s", e.Name, e.Open, e.Requested)
+}
 type DuplicateServiceError struct {
-	Kind reflect.Type
+	Kind     reflect.Type
+	Instance string
 }
 func (e *DuplicateServiceError) Error() string {
-	return fmt.Sprintf("duplicate service: %v", e.Kind)
+	if e.Instance == "" {
+		return fmt.Sprintf("duplicate service: %v (instance key \"\"), use RegisterInstance with distinct keys to run multiple instances", e.Kind)
+	}
+	return fmt.Sprintf("duplicate service: %v (instance key %q)", e.Kind, e.Instance)
+}
+type ServiceError struct {
+	Kind     reflect.Type
+	Instance string
+	Op       string
+	Err      error
+}
+func (e *ServiceError) Error() string {
+	name := "constructor"
+	if e.Kind != nil {
+		name = e.Kind.String()
+	}
+	if e.Instance != "" {
+		name += "#" + e.Instance
+	}
+	return fmt.Sprintf("service %s %s: %v", name, e.Op, e.Err)
+}
+func (e *ServiceError) Unwrap() error {
+	return e.Err
+}
+const (
+	ServiceStatusConstructed = "constructed"
+	ServiceStatusFailed      = "failed"
+	ServiceStatusRolledBack  = "rolled-back"
+)
+type ServiceStartResult struct {
+	Kind     reflect.Type
+	Instance string
+	Status   string
+	Err      error
+	StopErr  error
+}
+func (r *ServiceStartResult) name() string {
+	name := "constructor"
+	if r.Kind != nil {
+		name = r.Kind.String()
+	}
+	if r.Instance != "" {
+		name += "#" + r.Instance
+	}
+	return name
+}
+type StartError struct {
+	Stage    string
+	Err      error
+	Services []*ServiceStartResult
+}
+func (e *StartError) Error() string {
+	msg := fmt.Sprintf("node start failed during %s: %v", e.Stage, e.Err)
+	var rollback []string
+	for _, result := range e.Services {
+		if result.StopErr != nil {
+			rollback = append(rollback, fmt.Sprintf("service %s stop: %v", result.name(), result.StopErr))
+		}
+	}
+	if len(rollback) > 0 {
+		msg += " (rollback: " + strings.Join(rollback, "; ") + ")"
+	}
+	return msg
+}
+func (e *StartError) Unwrap() error {
+	return e.Err
+}
+func (e *StartError) Service(kind reflect.Type, instance string) *ServiceStartResult {
+	for _, result := range e.Services {
+		if result.Kind == kind && result.Instance == instance {
+			return result
+		}
+	}
+	return nil
+}
+type ServiceID struct {
+	Kind     reflect.Type
+	Instance string
+}
+func (id ServiceID) String() string {
+	return serviceKey{id.Kind, id.Instance}.String()
 }
 type StopError struct {
 	Server   error
-	Services map[reflect.Type]error
+	Services map[ServiceID]error
+	Stalled  []ServiceID
+	Failures []*ServiceError
 }
 func (e *StopError) Error() string {
-	return fmt.Sprintf("server: %v, services: %v", e.Server, e.Services)
+	msgs := make([]string, 0, len(e.Failures)+1)
+	if e.Server != nil {
+		msgs = append(msgs, fmt.Sprintf("server: %v", e.Server))
+	}
+	for _, failure := range e.Failures {
+		msgs = append(msgs, failure.Error())
+	}
+	return "node stop failed: " + strings.Join(msgs, "; ")
+}
+func (e *StopError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures)+1)
+	if e.Server != nil {
+		errs = append(errs, e.Server)
+	}
+	for _, failure := range e.Failures {
+		errs = append(errs, failure)
+	}
+	return errs
+}
+func (e *StopError) Is(target error) bool {
+	return anyErrorIs(e.Unwrap(), target)
+}
+func (e *StopError) As(target interface{}) bool {
+	return anyErrorAs(e.Unwrap(), target)
+}
+func (e *StopError) Service(kind reflect.Type, instance string) *ServiceError {
+	for _, failure := range e.Failures {
+		if failure.Kind == kind && failure.Instance == instance {
+			return failure
+		}
+	}
+	return nil
+}
+type CloseError struct {
+	Errors []error
+}
+func (e *CloseError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return "node close failed: " + strings.Join(msgs, "; ")
+}
+func (e *CloseError) Unwrap() []error {
+	return e.Errors
+}
+func (e *CloseError) Is(target error) bool {
+	return anyErrorIs(e.Errors, target)
+}
+func (e *CloseError) As(target interface{}) bool {
+	return anyErrorAs(e.Errors, target)
+}
+func anyErrorIs(errs []error, target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+func anyErrorAs(errs []error, target interface{}) bool {
+	for _, err := range errs {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
 }
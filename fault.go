@@ -0,0 +1,17 @@
+package node
+import (
+	"net/http"
+	"github.com/Cryptochain-VON/rpc"
+)
+type faultInjector interface {
+	apis() []rpc.API
+	serviceStart(service string) error
+	wrapHTTP(next http.Handler) http.Handler
+	wrapWS(next http.Handler) http.Handler
+}
+type noFaults struct{}
+func (noFaults) apis() []rpc.API                         { return nil }
+func (noFaults) serviceStart(service string) error       { return nil }
+func (noFaults) wrapHTTP(next http.Handler) http.Handler { return next }
+func (noFaults) wrapWS(next http.Handler) http.Handler   { return next }
+var faults faultInjector = noFaults{}
@@ -0,0 +1,139 @@
+// +build faultinject
+
+package node
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/log"
+	"github.com/Cryptochain-VON/rpc"
+)
+func init() {
+	faults = newFaultState()
+}
+type faultState struct {
+	lock      sync.Mutex
+	rpcDelay  time.Duration
+	failStart map[string]string
+	wsConns   map[net.Conn]struct{}
+}
+func newFaultState() *faultState {
+	return &faultState{
+		failStart: make(map[string]string),
+		wsConns:   make(map[net.Conn]struct{}),
+	}
+}
+func (f *faultState) apis() []rpc.API {
+	return []rpc.API{{Namespace: "fault", Version: "1.0", Service: &FaultAPI{f}}}
+}
+func (f *faultState) serviceStart(service string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if msg, ok := f.failStart[service]; ok {
+		return fmt.Errorf("injected fault: %s", msg)
+	}
+	return nil
+}
+func (f *faultState) wrapHTTP(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.lock.Lock()
+		delay := f.rpcDelay
+		f.lock.Unlock()
+		if delay > 0 && !isWebsocket(r) {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+func (f *faultState) wrapWS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(&faultHijackWriter{ResponseWriter: w, faults: f}, r)
+	})
+}
+func (f *faultState) track(conn net.Conn) net.Conn {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	tracked := &faultConn{Conn: conn, faults: f}
+	f.wsConns[tracked] = struct{}{}
+	return tracked
+}
+func (f *faultState) untrack(conn net.Conn) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	delete(f.wsConns, conn)
+}
+type faultHijackWriter struct {
+	http.ResponseWriter
+	faults *faultState
+}
+func (w *faultHijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	return w.faults.track(conn), rw, nil
+}
+type faultConn struct {
+	net.Conn
+	faults *faultState
+}
+func (c *faultConn) Close() error {
+	c.faults.untrack(c)
+	return c.Conn.Close()
+}
+type FaultAPI struct {
+	faults *faultState
+}
+func (api *FaultAPI) DelayRPC(delay string) error {
+	d, err := time.ParseDuration(delay)
+	if err != nil {
+		return err
+	}
+	api.faults.lock.Lock()
+	api.faults.rpcDelay = d
+	api.faults.lock.Unlock()
+	log.Warn("Fault injection: delaying HTTP RPC responses", "delay", d)
+	return nil
+}
+func (api *FaultAPI) FailServiceStart(service string, msg string) {
+	api.faults.lock.Lock()
+	api.faults.failStart[service] = msg
+	api.faults.lock.Unlock()
+	log.Warn("Fault injection: service start will fail", "service", service)
+}
+func (api *FaultAPI) ClearServiceStart(service string) {
+	api.faults.lock.Lock()
+	delete(api.faults.failStart, service)
+	api.faults.lock.Unlock()
+}
+func (api *FaultAPI) DropWSConnections() int {
+	api.faults.lock.Lock()
+	conns := make([]net.Conn, 0, len(api.faults.wsConns))
+	for conn := range api.faults.wsConns {
+		conns = append(conns, conn)
+	}
+	api.faults.lock.Unlock()
+	for _, conn := range conns {
+		conn.Close()
+	}
+	log.Warn("Fault injection: dropped WebSocket connections", "count", len(conns))
+	return len(conns)
+}
+func (api *FaultAPI) Reset() {
+	api.faults.lock.Lock()
+	api.faults.rpcDelay = 0
+	api.faults.failStart = make(map[string]string)
+	api.faults.lock.Unlock()
+}
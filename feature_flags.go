@@ -0,0 +1,111 @@
+package node
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+type FeatureFlag struct {
+	Name        string
+	Description string
+	Default     bool
+	Mutable     bool
+}
+type FeatureFlagState struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Enabled     bool   `json:"enabled"`
+	Mutable     bool   `json:"mutable"`
+	Declared    bool   `json:"declared"`
+}
+type FeatureFlagEvent struct {
+	Name    string
+	Enabled bool
+}
+var (
+	featureRegistryLock sync.RWMutex
+	featureRegistry     = make(map[string]FeatureFlag)
+)
+func RegisterFeatureFlag(flag FeatureFlag) error {
+	featureRegistryLock.Lock()
+	defer featureRegistryLock.Unlock()
+	if _, exists := featureRegistry[flag.Name]; exists {
+		return fmt.Errorf("feature flag %q already registered", flag.Name)
+	}
+	featureRegistry[flag.Name] = flag
+	return nil
+}
+func lookupFeatureFlag(name string) (FeatureFlag, bool) {
+	featureRegistryLock.RLock()
+	defer featureRegistryLock.RUnlock()
+	flag, ok := featureRegistry[name]
+	return flag, ok
+}
+type featureFlags struct {
+	lock   sync.RWMutex
+	values map[string]bool
+}
+func newFeatureFlags(values map[string]bool) *featureFlags {
+	f := &featureFlags{values: make(map[string]bool, len(values))}
+	for name, enabled := range values {
+		f.values[name] = enabled
+	}
+	return f
+}
+func (f *featureFlags) enabled(name string) bool {
+	f.lock.RLock()
+	enabled, ok := f.values[name]
+	f.lock.RUnlock()
+	if ok {
+		return enabled
+	}
+	flag, _ := lookupFeatureFlag(name)
+	return flag.Default
+}
+func (f *featureFlags) set(name string, enabled bool) error {
+	flag, declared := lookupFeatureFlag(name)
+	if !declared {
+		return fmt.Errorf("unknown feature flag %q", name)
+	}
+	if !flag.Mutable {
+		return ErrFeatureFlagImmutable
+	}
+	f.lock.Lock()
+	f.values[name] = enabled
+	f.lock.Unlock()
+	return nil
+}
+func (f *featureFlags) states() []FeatureFlagState {
+	featureRegistryLock.RLock()
+	states := make(map[string]FeatureFlagState, len(featureRegistry))
+	for name, flag := range featureRegistry {
+		states[name] = FeatureFlagState{Name: name, Description: flag.Description, Enabled: flag.Default, Mutable: flag.Mutable, Declared: true}
+	}
+	featureRegistryLock.RUnlock()
+	f.lock.RLock()
+	for name, enabled := range f.values {
+		state := states[name]
+		state.Name, state.Enabled = name, enabled
+		states[name] = state
+	}
+	f.lock.RUnlock()
+	result := make([]FeatureFlagState, 0, len(states))
+	for _, state := range states {
+		result = append(result, state)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+func (n *Node) FeatureEnabled(name string) bool {
+	return n.features.enabled(name)
+}
+func (n *Node) SetFeatureFlag(name string, enabled bool) error {
+	if err := n.features.set(name, enabled); err != nil {
+		return err
+	}
+	n.log.Info("Feature flag updated", "name", name, "enabled", enabled)
+	n.eventmux.Post(FeatureFlagEvent{Name: name, Enabled: enabled})
+	return nil
+}
+func (n *Node) FeatureFlags() []FeatureFlagState {
+	return n.features.states()
+}
@@ -0,0 +1,9 @@
+// +build go1.19
+
+package node
+import (
+	"runtime/debug"
+)
+func setMemoryLimit(limit int64) (int64, error) {
+	return debug.SetMemoryLimit(limit), nil
+}
@@ -0,0 +1,9 @@
+// +build !go1.19
+
+package node
+import (
+	"errors"
+)
+func setMemoryLimit(limit int64) (int64, error) {
+	return 0, errors.New("memory limit requires Go 1.19 or newer")
+}
@@ -0,0 +1,107 @@
+package node
+import (
+	"runtime/debug"
+)
+type GCSettings struct {
+	GCPercent   *int   `json:"gcPercent,omitempty"`
+	MemoryLimit *int64 `json:"memoryLimit,omitempty"`
+	BallastSize int64  `json:"ballastSize"`
+}
+func (s GCSettings) clone() GCSettings {
+	if s.GCPercent != nil {
+		percent := *s.GCPercent
+		s.GCPercent = &percent
+	}
+	if s.MemoryLimit != nil {
+		limit := *s.MemoryLimit
+		s.MemoryLimit = &limit
+	}
+	return s
+}
+func (s GCSettings) equal(o GCSettings) bool {
+	if (s.GCPercent == nil) != (o.GCPercent == nil) || (s.GCPercent != nil && *s.GCPercent != *o.GCPercent) {
+		return false
+	}
+	if (s.MemoryLimit == nil) != (o.MemoryLimit == nil) || (s.MemoryLimit != nil && *s.MemoryLimit != *o.MemoryLimit) {
+		return false
+	}
+	return s.BallastSize == o.BallastSize
+}
+type gcPrevious struct {
+	percent *int
+	limit   *int64
+}
+func (c *Config) gcSettings() GCSettings {
+	return GCSettings{GCPercent: c.GCPercent, MemoryLimit: c.GCMemoryLimit, BallastSize: c.GCBallastSize}.clone()
+}
+func (n *Node) applyGCSettings(s GCSettings) error {
+	if s.MemoryLimit != nil {
+		prev, err := setMemoryLimit(*s.MemoryLimit)
+		if err != nil {
+			return err
+		}
+		if n.gcPrevious.limit == nil {
+			n.gcPrevious.limit = &prev
+		}
+	} else {
+		n.restoreMemoryLimit()
+	}
+	if s.GCPercent != nil {
+		prev := debug.SetGCPercent(*s.GCPercent)
+		if n.gcPrevious.percent == nil {
+			n.gcPrevious.percent = &prev
+		}
+	} else {
+		n.restoreGCPercent()
+	}
+	if s.BallastSize > 0 {
+		if int64(len(n.ballast)) != s.BallastSize {
+			n.ballast = make([]byte, s.BallastSize)
+		}
+	} else {
+		n.ballast = nil
+	}
+	if s.equal(n.gcSettings) {
+		return nil
+	}
+	n.gcSettings = s.clone()
+	ctx := []interface{}{"ballast", s.BallastSize}
+	if s.GCPercent != nil {
+		ctx = append(ctx, "gcpercent", *s.GCPercent)
+	}
+	if s.MemoryLimit != nil {
+		ctx = append(ctx, "memlimit", *s.MemoryLimit)
+	}
+	n.log.Info("Applied GC tuning", ctx...)
+	return nil
+}
+func (n *Node) restoreGCPercent() {
+	if n.gcPrevious.percent != nil {
+		debug.SetGCPercent(*n.gcPrevious.percent)
+		n.gcPrevious.percent = nil
+	}
+}
+func (n *Node) restoreMemoryLimit() {
+	if n.gcPrevious.limit != nil {
+		if _, err := setMemoryLimit(*n.gcPrevious.limit); err != nil {
+			n.log.Warn("Failed to restore memory limit", "limit", *n.gcPrevious.limit, "err", err)
+		}
+		n.gcPrevious.limit = nil
+	}
+}
+func (n *Node) restoreGCSettings() {
+	n.restoreMemoryLimit()
+	n.restoreGCPercent()
+	n.ballast = nil
+	n.gcSettings = GCSettings{}
+}
+func (n *Node) SetGCSettings(s GCSettings) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.applyGCSettings(s)
+}
+func (n *Node) GCSettings() GCSettings {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.gcSettings.clone()
+}
@@ -0,0 +1,56 @@
+package node
+import (
+	"errors"
+	"net"
+	"net/http"
+)
+const httpGraphQLMetrics = "rpc/stack/graphql"
+func (n *Node) StartGraphQLEndpoint(handler http.Handler) (*http.Server, net.Addr, error) {
+	endpoint := n.config.GraphQLEndpoint()
+	if endpoint == "" {
+		return nil, nil, errors.New("GraphQL endpoint not configured")
+	}
+	n.graphqlLock.Lock()
+	defer n.graphqlLock.Unlock()
+	if n.graphqlServer != nil {
+		return nil, nil, errors.New("GraphQL endpoint already running")
+	}
+	tlsConfig, err := n.serverTLSConfig(endpoint, n.config.HTTPTLSCert, n.config.HTTPTLSKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	conf := n.config.httpStackConfig(n.config.GraphQLCors, n.config.GraphQLVirtualHosts)
+	conf.metrics, conf.usage, conf.auth = httpGraphQLMetrics, n.usage, n.auth
+	conf.pools, conf.pool = n.rpcPools, "graphql"
+	stack := newHTTPHandlerStack(handler, conf)
+	stack = newActivityHandler(faults.wrapHTTP(stack), n.touchActivity)
+	srv, addr, err := startHTTPEndpoint(endpoint, n.config.GraphQLTimeouts, tlsConfig, n.config.RPCMaxConnections, stack)
+	if err != nil {
+		return nil, nil, err
+	}
+	n.log.Info("GraphQL endpoint opened", "addr", addr, "tls", tlsConfig != nil)
+	n.graphqlServer, n.graphqlListenerAddr, n.graphqlTLS = srv, addr, tlsConfig != nil
+	return srv, addr, nil
+}
+func (n *Node) stopGraphQL() {
+	n.graphqlLock.Lock()
+	defer n.graphqlLock.Unlock()
+	if n.graphqlServer == nil {
+		return
+	}
+	n.graphqlServer.Close()
+	n.graphqlServer = nil
+	n.log.Info("GraphQL endpoint closed", "addr", n.graphqlListenerAddr)
+}
+func (n *Node) graphqlInfo() *EndpointInfo {
+	n.graphqlLock.Lock()
+	defer n.graphqlLock.Unlock()
+	if n.graphqlServer == nil {
+		return nil
+	}
+	scheme := "http://"
+	if n.graphqlTLS {
+		scheme = "https://"
+	}
+	return &EndpointInfo{URL: scheme + n.graphqlListenerAddr.String() + "/graphql", TLS: n.graphqlTLS, Auth: authDescription(n.auth)}
+}
@@ -0,0 +1,70 @@
+package node
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+	"github.com/Cryptochain-VON/common/hexutil"
+	"github.com/Cryptochain-VON/crypto"
+)
+type NodeIdentity struct {
+	Operator string `toml:",omitempty" json:"operator,omitempty"`
+	Contact  string `toml:",omitempty" json:"contact,omitempty"`
+	Region   string `toml:",omitempty" json:"region,omitempty"`
+}
+type IdentityAttestation struct {
+	NodeIdentity
+	NodeID    string        `json:"nodeId"`
+	Issued    uint64        `json:"issued"`
+	Signature hexutil.Bytes `json:"signature"`
+}
+func (id *NodeIdentity) clientTag() string {
+	tag := id.Operator
+	if id.Region != "" {
+		tag += "@" + id.Region
+	}
+	return clientNameSafe(tag)
+}
+func (a *IdentityAttestation) digest() []byte {
+	blob, _ := json.Marshal(struct {
+		NodeIdentity
+		NodeID string `json:"nodeId"`
+		Issued uint64 `json:"issued"`
+	}{a.NodeIdentity, a.NodeID, a.Issued})
+	return crypto.Keccak256(blob)
+}
+func signIdentity(id NodeIdentity, key *ecdsa.PrivateKey) (*IdentityAttestation, error) {
+	pub := crypto.FromECDSAPub(&key.PublicKey)
+	att := &IdentityAttestation{
+		NodeIdentity: id,
+		NodeID:       hex.EncodeToString(crypto.Keccak256(pub[1:])),
+		Issued:       uint64(time.Now().Unix()),
+	}
+	sig, err := crypto.Sign(att.digest(), key)
+	if err != nil {
+		return nil, err
+	}
+	att.Signature = sig
+	return att, nil
+}
+func VerifyIdentityAttestation(att *IdentityAttestation) error {
+	pub, err := crypto.SigToPub(att.digest(), att.Signature)
+	if err != nil {
+		return err
+	}
+	id, err := hex.DecodeString(att.NodeID)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(crypto.Keccak256(crypto.FromECDSAPub(pub)[1:]), id) {
+		return errors.New("identity attestation not signed by node key")
+	}
+	return nil
+}
+func (n *Node) IdentityAttestation() *IdentityAttestation {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.identity
+}
@@ -0,0 +1,101 @@
+package node
+import (
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+func newActivityHandler(next http.Handler, touch func()) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		touch()
+		next.ServeHTTP(w, r)
+	})
+}
+type activityListener struct {
+	net.Listener
+	open int64
+}
+func newActivityListener(l net.Listener) *activityListener {
+	return &activityListener{Listener: l}
+}
+func (l *activityListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&l.open, 1)
+	return &activityConn{Conn: conn, l: l}, nil
+}
+func (l *activityListener) active() int {
+	if l == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&l.open))
+}
+type activityConn struct {
+	net.Conn
+	l    *activityListener
+	once sync.Once
+}
+func (c *activityConn) Close() error {
+	c.once.Do(func() { atomic.AddInt64(&c.l.open, -1) })
+	return c.Conn.Close()
+}
+func (n *Node) activeClients() int {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	count := n.wsClients.active()
+	if l, ok := n.ipcListener.(*activityListener); ok {
+		count += l.active()
+	}
+	return count
+}
+func (n *Node) touchActivity() {
+	atomic.StoreInt64(&n.lastActivity, n.clock.Now().UnixNano())
+}
+func (n *Node) startIdleMonitor(timeout time.Duration) {
+	n.touchActivity()
+	quit := make(chan struct{})
+	n.idleQuit = quit
+	interval := timeout / 4
+	if interval > time.Minute {
+		interval = time.Minute
+	}
+	if interval < time.Second {
+		interval = time.Second
+	}
+	server := n.server
+	go func() {
+		ticker := n.clock.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				if !n.p2pPending() && server.PeerCount() > 0 {
+					n.touchActivity()
+					continue
+				}
+				if n.activeClients() > 0 {
+					n.touchActivity()
+					continue
+				}
+				idle := n.clock.Now().Sub(time.Unix(0, atomic.LoadInt64(&n.lastActivity)))
+				if idle < timeout {
+					continue
+				}
+				n.log.Info("Node idle, shutting down", "idle", idle, "timeout", timeout)
+				go n.Stop()
+				return
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+func (n *Node) stopIdleMonitor() {
+	if n.idleQuit != nil {
+		close(n.idleQuit)
+		n.idleQuit = nil
+	}
+}
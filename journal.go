@@ -0,0 +1,246 @@
+package node
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/log"
+	"github.com/Cryptochain-VON/rpc"
+)
+const DefaultRPCJournalMaxBytes = 64 * 1024 * 1024
+type JournalEntry struct {
+	Time       time.Time       `json:"time"`
+	Transport  string          `json:"transport"`
+	Method     string          `json:"method"`
+	ID         json.RawMessage `json:"id,omitempty"`
+	ParamsHash string          `json:"paramsHash,omitempty"`
+	Params     json.RawMessage `json:"params,omitempty"`
+}
+type requestJournal struct {
+	path  string
+	max   int64
+	full  map[string]bool
+	clock Clock
+	log   log.Logger
+	lock  sync.Mutex
+	file  *os.File
+	size  int64
+}
+func newRequestJournal(conf *Config, clock Clock, logger log.Logger) (*requestJournal, error) {
+	if conf.RPCJournal == "" {
+		return nil, nil
+	}
+	path := conf.ResolvePath(conf.RPCJournal)
+	if path == "" {
+		logger.Warn("RPC journal needs a datadir or absolute path, disabling", "path", conf.RPCJournal)
+		return nil, nil
+	}
+	j := &requestJournal{path: path, max: conf.RPCJournalMaxBytes, full: make(map[string]bool), clock: clock, log: logger}
+	if j.max <= 0 {
+		j.max = DefaultRPCJournalMaxBytes
+	}
+	for _, method := range conf.RPCJournalFullParams {
+		j.full[method] = true
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := j.open(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+func (j *requestJournal) open() error {
+	file, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	j.file, j.size = file, info.Size()
+	return nil
+}
+func (j *requestJournal) rotate() error {
+	j.file.Close()
+	j.file = nil
+	if err := os.Rename(j.path, j.path+".1"); err != nil {
+		return err
+	}
+	return j.open()
+}
+func (j *requestJournal) rotateNow() error {
+	if j == nil {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	return j.rotate()
+}
+func (j *requestJournal) record(transport string, body []byte) {
+	type call struct {
+		Method string          `json:"method"`
+		ID     json.RawMessage `json:"id"`
+		Params json.RawMessage `json:"params"`
+	}
+	if j == nil {
+		return
+	}
+	var calls []call
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if json.Unmarshal(trimmed, &calls) != nil {
+			return
+		}
+	} else {
+		calls = append(calls, call{})
+		if json.Unmarshal(trimmed, &calls[0]) != nil {
+			return
+		}
+	}
+	now := j.clock.Now()
+	var lines []byte
+	for _, c := range calls {
+		entry := JournalEntry{Time: now, Transport: transport, Method: c.Method, ID: c.ID}
+		switch {
+		case len(c.Params) == 0:
+		case j.full[c.Method]:
+			entry.Params = c.Params
+		default:
+			var compact bytes.Buffer
+			if json.Compact(&compact, c.Params) == nil {
+				sum := sha256.Sum256(compact.Bytes())
+				entry.ParamsHash = hex.EncodeToString(sum[:])
+			}
+		}
+		blob, err := json.Marshal(entry)
+		if err != nil {
+			continue
+		}
+		lines = append(append(lines, blob...), '\n')
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.file == nil {
+		return
+	}
+	if j.size+int64(len(lines)) > j.max {
+		if err := j.rotate(); err != nil {
+			j.log.Warn("Failed to rotate RPC journal, disabling", "path", j.path, "err", err)
+			return
+		}
+	}
+	n, err := j.file.Write(lines)
+	j.size += int64(n)
+	if err != nil {
+		j.log.Warn("Failed to write RPC journal", "path", j.path, "err", err)
+	}
+}
+func (j *requestJournal) close() error {
+	if j == nil {
+		return nil
+	}
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+func newJournalHandler(j *requestJournal, next http.Handler, writeErr HTTPErrorWriter) http.Handler {
+	if j == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || isWebsocket(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			writeErr(w, r, bodyReadStatus(err), err.Error())
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		j.record("http", body)
+		next.ServeHTTP(w, r)
+	})
+}
+type ReplayResult struct {
+	Entry   JournalEntry    `json:"entry"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   string          `json:"error,omitempty"`
+	Skipped bool            `json:"skipped,omitempty"`
+}
+func ReadRequestJournal(path string) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	for _, file := range []string{path + ".1", path} {
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(nil, 16*1024*1024)
+		for scanner.Scan() {
+			var entry JournalEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				f.Close()
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+func ReplayRequestJournal(ctx context.Context, client *rpc.Client, entries []JournalEntry) []ReplayResult {
+	results := make([]ReplayResult, len(entries))
+	for i, entry := range entries {
+		results[i].Entry = entry
+		if entry.ParamsHash != "" {
+			results[i].Skipped = true
+			continue
+		}
+		var args []interface{}
+		if len(entry.Params) > 0 {
+			var params []json.RawMessage
+			if err := json.Unmarshal(entry.Params, &params); err != nil {
+				results[i].Error = err.Error()
+				continue
+			}
+			for _, param := range params {
+				args = append(args, param)
+			}
+		}
+		if err := client.CallContext(ctx, &results[i].Result, entry.Method, args...); err != nil {
+			results[i].Error = err.Error()
+		}
+		if ctx.Err() != nil {
+			return results[:i+1]
+		}
+	}
+	return results
+}
@@ -0,0 +1,59 @@
+package node
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"github.com/Cryptochain-VON/rpc"
+)
+func TestRequestJournalTransports(t *testing.T) {
+	conf := testNodeConfig()
+	conf.DataDir = testDataDir(t)
+	conf.NoUSB = true
+	conf.IPCPath = "test.ipc"
+	conf.HTTPHost, conf.HTTPPort = "127.0.0.1", freeTCPAddr(t).Port
+	conf.WSHost, conf.WSPort = "127.0.0.1", freeTCPAddr(t).Port
+	conf.RPCJournal = "journal.log"
+	conf.RPCJournalFullParams = []string{"web3_sha3"}
+	stack := startTestNode(t, conf, NewAPIService(rpc.API{Namespace: "test", Version: "1.0", Service: new(testEchoAPI), Public: true}))
+	tests := []struct {
+		transport string
+		dial      func() (*rpc.Client, error)
+	}{
+		{"http", func() (*rpc.Client, error) { return rpc.Dial("http://" + stack.HTTPEndpoint()) }},
+		{"ws", func() (*rpc.Client, error) { return rpc.Dial("ws://" + stack.WSEndpoint()) }},
+		{"ipc", func() (*rpc.Client, error) { return rpc.DialIPC(context.Background(), stack.IPCEndpoint()) }},
+	}
+	for _, tt := range tests {
+		client, err := tt.dial()
+		if err != nil {
+			t.Fatalf("%s: failed to dial: %v", tt.transport, err)
+		}
+		var (
+			length int
+			hash   string
+		)
+		if err := client.Call(&length, "test_length", "hashed"); err != nil {
+			t.Fatalf("%s: test_length failed: %v", tt.transport, err)
+		}
+		if err := client.Call(&hash, "web3_sha3", "0x00"); err != nil {
+			t.Fatalf("%s: web3_sha3 failed: %v", tt.transport, err)
+		}
+		client.Close()
+	}
+	entries, err := ReadRequestJournal(filepath.Join(conf.DataDir, conf.Name, conf.RPCJournal))
+	if err != nil {
+		t.Fatalf("failed to read journal: %v", err)
+	}
+	if len(entries) != 2*len(tests) {
+		t.Fatalf("journal entry count mismatch: have %d, want %d", len(entries), 2*len(tests))
+	}
+	for i, tt := range tests {
+		hashed, full := entries[2*i], entries[2*i+1]
+		if hashed.Transport != tt.transport || hashed.Method != "test_length" || hashed.ParamsHash == "" || hashed.Params != nil {
+			t.Errorf("%s: hashed entry mismatch: %+v", tt.transport, hashed)
+		}
+		if full.Transport != tt.transport || full.Method != "web3_sha3" || string(full.Params) != `["0x00"]` || full.ParamsHash != "" {
+			t.Errorf("%s: full entry mismatch: %+v", tt.transport, full)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package node
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/common"
+	"github.com/Cryptochain-VON/log"
+)
+type keyIndexEntry struct {
+	Address common.Address `json:"address"`
+	Version int            `json:"version"`
+	ModTime time.Time      `json:"modtime"`
+	Size    int64          `json:"size"`
+}
+type keyIndexFile struct {
+	KeyDir     string                   `json:"keydir"`
+	DirModTime time.Time                `json:"dirmodtime"`
+	Files      map[string]keyIndexEntry `json:"files"`
+}
+const keyIndexSettle = 2 * time.Second
+type keystoreIndex struct {
+	path       string
+	keydir     string
+	log        log.Logger
+	lock       sync.Mutex
+	files      map[string]keyIndexEntry
+	byAddr     map[common.Address][]string
+	dirModTime time.Time
+	synced     bool
+}
+func newKeystoreIndex(path, keydir string, logger log.Logger) *keystoreIndex {
+	idx := &keystoreIndex{
+		path:   path,
+		keydir: keydir,
+		log:    logger,
+		files:  make(map[string]keyIndexEntry),
+		byAddr: make(map[common.Address][]string),
+	}
+	idx.load()
+	return idx
+}
+func (idx *keystoreIndex) load() {
+	if idx.path == "" {
+		return
+	}
+	blob, err := ioutil.ReadFile(idx.path)
+	if err != nil {
+		return
+	}
+	var stored keyIndexFile
+	if err := json.Unmarshal(blob, &stored); err != nil || stored.KeyDir != idx.keydir || stored.Files == nil {
+		idx.log.Warn("Discarding corrupt keystore index, rebuilding", "path", idx.path, "err", err)
+		return
+	}
+	for name, entry := range stored.Files {
+		idx.add(name, entry)
+	}
+	idx.dirModTime, idx.synced = stored.DirModTime, true
+}
+func (idx *keystoreIndex) add(name string, entry keyIndexEntry) {
+	idx.files[name] = entry
+	if entry.Version != 0 {
+		idx.byAddr[entry.Address] = append(idx.byAddr[entry.Address], name)
+	}
+}
+func (idx *keystoreIndex) remove(name string) {
+	entry, ok := idx.files[name]
+	if !ok {
+		return
+	}
+	delete(idx.files, name)
+	if entry.Version == 0 {
+		return
+	}
+	names := idx.byAddr[entry.Address]
+	for i, n := range names {
+		if n == name {
+			names = append(names[:i], names[i+1:]...)
+			break
+		}
+	}
+	if len(names) == 0 {
+		delete(idx.byAddr, entry.Address)
+	} else {
+		idx.byAddr[entry.Address] = names
+	}
+}
+func (idx *keystoreIndex) sync() error {
+	fi, err := os.Stat(idx.keydir)
+	if err != nil {
+		return err
+	}
+	if idx.synced && fi.ModTime().Equal(idx.dirModTime) && time.Since(fi.ModTime()) > keyIndexSettle {
+		return nil
+	}
+	return idx.refresh(fi.ModTime())
+}
+func (idx *keystoreIndex) refresh(dirModTime time.Time) error {
+	infos, err := ioutil.ReadDir(idx.keydir)
+	if err != nil {
+		return err
+	}
+	present := make(map[string]struct{}, len(infos))
+	changed := !dirModTime.Equal(idx.dirModTime)
+	for _, fi := range infos {
+		name := fi.Name()
+		if fi.IsDir() || strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") || strings.HasSuffix(name, ".tmp") {
+			continue
+		}
+		present[name] = struct{}{}
+		if entry, ok := idx.files[name]; ok && entry.ModTime.Equal(fi.ModTime()) && entry.Size == fi.Size() {
+			continue
+		}
+		if _, ok := idx.files[name]; ok {
+			idx.remove(name)
+			changed = true
+		}
+		addr, version, err := readKeyFileInfo(filepath.Join(idx.keydir, name))
+		if err != nil {
+			idx.log.Debug("Skipping unparsable key file", "file", name, "err", err)
+			addr, version = common.Address{}, 0
+		}
+		idx.add(name, keyIndexEntry{Address: addr, Version: version, ModTime: fi.ModTime(), Size: fi.Size()})
+		changed = true
+	}
+	for name := range idx.files {
+		if _, ok := present[name]; !ok {
+			idx.remove(name)
+			changed = true
+		}
+	}
+	idx.dirModTime, idx.synced = dirModTime, true
+	if !changed {
+		return nil
+	}
+	idx.log.Debug("Keystore index updated", "files", len(idx.files), "accounts", len(idx.byAddr))
+	return idx.save()
+}
+func (idx *keystoreIndex) put(path string) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	fi, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	addr, version, err := readKeyFileInfo(path)
+	if err != nil {
+		return
+	}
+	name := filepath.Base(path)
+	idx.remove(name)
+	idx.add(name, keyIndexEntry{Address: addr, Version: version, ModTime: fi.ModTime(), Size: fi.Size()})
+}
+func (idx *keystoreIndex) save() error {
+	if idx.path == "" {
+		return nil
+	}
+	blob, err := json.Marshal(&keyIndexFile{KeyDir: idx.keydir, DirModTime: idx.dirModTime, Files: idx.files})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0700); err != nil {
+		return err
+	}
+	tmp := idx.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, blob, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, idx.path)
+}
+func (idx *keystoreIndex) accounts() ([]common.Address, error) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if err := idx.sync(); err != nil {
+		return nil, err
+	}
+	addrs := make([]common.Address, 0, len(idx.byAddr))
+	for addr := range idx.byAddr {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Hex() < addrs[j].Hex() })
+	return addrs, nil
+}
+func (idx *keystoreIndex) lookup(addr common.Address) ([]string, error) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if err := idx.sync(); err != nil {
+		return nil, err
+	}
+	names := idx.byAddr[addr]
+	if len(names) == 0 {
+		return nil, ErrKeyFileUnknown
+	}
+	paths := make([]string, len(names))
+	for i, name := range names {
+		paths[i] = filepath.Join(idx.keydir, name)
+	}
+	return paths, nil
+}
+func (idx *keystoreIndex) entries(versions ...int) (map[string]keyIndexEntry, error) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if err := idx.sync(); err != nil {
+		return nil, err
+	}
+	entries := make(map[string]keyIndexEntry)
+	for name, entry := range idx.files {
+		for _, version := range versions {
+			if entry.Version == version {
+				entries[filepath.Join(idx.keydir, name)] = entry
+			}
+		}
+	}
+	return entries, nil
+}
+func readKeyFileInfo(path string) (common.Address, int, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return common.Address{}, 0, err
+	}
+	var key struct {
+		Address string `json:"address"`
+		Version int    `json:"version"`
+	}
+	if err := json.Unmarshal(blob, &key); err != nil {
+		return common.Address{}, 0, err
+	}
+	if key.Address == "" {
+		if _, addr, err := parseKeyFileV4(blob); err == nil {
+			return addr, keyStoreV4Version, nil
+		}
+	}
+	if !common.IsHexAddress(key.Address) {
+		return common.Address{}, 0, errors.New("invalid address in key file")
+	}
+	return common.HexToAddress(key.Address), key.Version, nil
+}
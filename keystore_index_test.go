@@ -0,0 +1,191 @@
+package node
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"github.com/Cryptochain-VON/accounts"
+	"github.com/Cryptochain-VON/accounts/keystore"
+	"github.com/Cryptochain-VON/common"
+	"github.com/Cryptochain-VON/log"
+)
+func newTestKeyDir(t *testing.T) (string, []accounts.Account) {
+	keydir := filepath.Join(testDataDir(t), "keystore")
+	var keys []accounts.Account
+	for i := 0; i < 2; i++ {
+		account, err := keystore.StoreKey(keydir, "pass", keystore.LightScryptN, keystore.LightScryptP)
+		if err != nil {
+			t.Fatalf("failed to store key: %v", err)
+		}
+		keys = append(keys, account)
+	}
+	if err := ioutil.WriteFile(filepath.Join(keydir, "garbage"), []byte("not a key"), 0600); err != nil {
+		t.Fatalf("failed to write garbage file: %v", err)
+	}
+	return keydir, keys
+}
+func setDirModTime(t *testing.T, dir string, mtime time.Time) {
+	if err := os.Chtimes(dir, mtime, mtime); err != nil {
+		t.Fatalf("failed to set directory modification time: %v", err)
+	}
+}
+func readTestIndex(t *testing.T, path string) keyIndexFile {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+	var stored keyIndexFile
+	if err := json.Unmarshal(blob, &stored); err != nil {
+		t.Fatalf("index not rewritten: %v", err)
+	}
+	return stored
+}
+func checkIndexAccounts(t *testing.T, idx *keystoreIndex, want ...accounts.Account) {
+	t.Helper()
+	have, err := idx.accounts()
+	if err != nil {
+		t.Fatalf("failed to list accounts: %v", err)
+	}
+	if len(have) != len(want) {
+		t.Fatalf("account count mismatch: have %d, want %d", len(have), len(want))
+	}
+	for _, account := range want {
+		paths, err := idx.lookup(account.Address)
+		if err != nil || len(paths) != 1 || paths[0] != account.URL.Path {
+			t.Fatalf("lookup of %x mismatch: have %v (%v), want %s", account.Address, paths, err, account.URL.Path)
+		}
+	}
+}
+func TestKeystoreIndexRebuildOnCorruption(t *testing.T) {
+	tests := []struct {
+		name  string
+		index func(keydir string, valid []byte) []byte
+	}{
+		{name: "missing", index: func(string, []byte) []byte { return nil }},
+		{name: "garbage", index: func(string, []byte) []byte { return []byte("{not json") }},
+		{name: "truncated", index: func(_ string, valid []byte) []byte { return valid[:len(valid)/2] }},
+		{name: "no files", index: func(keydir string, _ []byte) []byte { return []byte(`{"keydir":` + string(mustMarshalJSON(keydir)) + `}`) }},
+		{name: "other keydir", index: func(_ string, valid []byte) []byte {
+			var stored keyIndexFile
+			json.Unmarshal(valid, &stored)
+			stored.KeyDir = "/elsewhere"
+			return mustMarshalJSON(stored)
+		}},
+		{name: "stale entries", index: func(_ string, valid []byte) []byte {
+			var stored keyIndexFile
+			json.Unmarshal(valid, &stored)
+			stored.DirModTime = time.Time{}
+			stored.Files["UTC--stale"] = keyIndexEntry{Address: common.Address{1}, Version: 3}
+			return mustMarshalJSON(stored)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keydir, keys := newTestKeyDir(t)
+			path := filepath.Join(filepath.Dir(keydir), "index.json")
+			checkIndexAccounts(t, newKeystoreIndex(path, keydir, log.Root()), keys...)
+			valid, _ := ioutil.ReadFile(path)
+			os.Remove(path)
+			if blob := tt.index(keydir, valid); blob != nil {
+				if err := ioutil.WriteFile(path, blob, 0600); err != nil {
+					t.Fatalf("failed to write index: %v", err)
+				}
+			}
+			checkIndexAccounts(t, newKeystoreIndex(path, keydir, log.Root()), keys...)
+			stored := readTestIndex(t, path)
+			if stored.KeyDir != keydir || len(stored.Files) != 3 {
+				t.Fatalf("rebuilt index mismatch: keydir %q, %d files", stored.KeyDir, len(stored.Files))
+			}
+			if entry, ok := stored.Files["garbage"]; !ok || entry.Version != 0 {
+				t.Fatalf("unparsable file not recorded: %+v", entry)
+			}
+		})
+	}
+}
+func TestKeystoreIndexDirModTime(t *testing.T) {
+	keydir, keys := newTestKeyDir(t)
+	path := filepath.Join(filepath.Dir(keydir), "index.json")
+	synced := time.Now().Add(-time.Hour).Truncate(time.Second)
+	setDirModTime(t, keydir, synced)
+	idx := newKeystoreIndex(path, keydir, log.Root())
+	checkIndexAccounts(t, idx, keys...)
+	if stored := readTestIndex(t, path); !stored.DirModTime.Equal(synced) {
+		t.Fatalf("persisted directory time mismatch: have %v, want %v", stored.DirModTime, synced)
+	}
+	added, err := keystore.StoreKey(keydir, "pass", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatalf("failed to store key: %v", err)
+	}
+	setDirModTime(t, keydir, synced)
+	checkIndexAccounts(t, idx, keys...)
+	os.Remove(keys[0].URL.Path)
+	setDirModTime(t, keydir, synced)
+	checkIndexAccounts(t, newKeystoreIndex(path, keydir, log.Root()), keys...)
+	setDirModTime(t, keydir, synced.Add(time.Minute))
+	checkIndexAccounts(t, idx, keys[1], added)
+	checkIndexAccounts(t, newKeystoreIndex(path, keydir, log.Root()), keys[1], added)
+}
+func TestKeystoreIndexBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		version int
+	}{
+		{name: "v3 writes", format: KeyStoreFormatV3, version: keyStoreV3Version},
+		{name: "v4 writes", format: KeyStoreFormatV4, version: keyStoreV4Version},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := testNodeConfig()
+			conf.DataDir = testDataDir(t)
+			conf.KeyStoreIndex = true
+			conf.KeyStoreFormat = tt.format
+			conf.UseLightweightKDF = true
+			conf.NoUSB = true
+			keydir := filepath.Join(conf.DataDir, "keystore")
+			v3, err := keystore.StoreKey(keydir, "pass", keystore.LightScryptN, keystore.LightScryptP)
+			if err != nil {
+				t.Fatalf("failed to store v3 key: %v", err)
+			}
+			v4 := writeTestKeyV4(t, keydir, "pass")
+			stack, err := New(conf)
+			if err != nil {
+				t.Fatalf("failed to create protocol stack: %v", err)
+			}
+			defer stack.Close()
+			if backends := stack.AccountManager().Backends(keystore.KeyStoreType); len(backends) != 0 {
+				t.Fatalf("scanning keystore registered in index mode")
+			}
+			created, err := stack.NewKeyStoreAccount("pass")
+			if err != nil {
+				t.Fatalf("failed to create account: %v", err)
+			}
+			if _, version, err := readKeyFileInfo(created.URL.Path); err != nil || version != tt.version {
+				t.Fatalf("new account file version mismatch: have %d (%v), want %d", version, err, tt.version)
+			}
+			if paths, err := stack.KeyStoreFiles(created.Address); err != nil || len(paths) != 1 {
+				t.Fatalf("new account not indexed: %v (%v)", paths, err)
+			}
+			if err := stack.unlockKeyStoreAccount(created, "pass", 0); err != nil {
+				t.Fatalf("failed to unlock new account: %v", err)
+			}
+			for _, account := range []accounts.Account{v3, v4} {
+				if err := stack.unlockKeyStoreAccount(account, "wrong", 0); err == nil {
+					t.Fatalf("unlocked %x with wrong passphrase", account.Address)
+				}
+				if err := stack.unlockKeyStoreAccount(account, "pass", 0); err != nil {
+					t.Fatalf("failed to unlock %x: %v", account.Address, err)
+				}
+				wallet, err := stack.AccountManager().Find(account)
+				if err != nil {
+					t.Fatalf("account %x not found in account manager: %v", account.Address, err)
+				}
+				if _, err := wallet.SignData(account, accounts.MimetypeTypedData, []byte("data")); err != nil {
+					t.Fatalf("failed to sign with %x: %v", account.Address, err)
+				}
+			}
+		})
+	}
+}
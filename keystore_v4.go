@@ -0,0 +1,643 @@
+package node
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	ethereum "github.com/Cryptochain-VON"
+	"github.com/Cryptochain-VON/accounts"
+	"github.com/Cryptochain-VON/accounts/keystore"
+	"github.com/Cryptochain-VON/common"
+	"github.com/Cryptochain-VON/core/types"
+	"github.com/Cryptochain-VON/crypto"
+	"github.com/Cryptochain-VON/event"
+	"github.com/Cryptochain-VON/log"
+	"github.com/Cryptochain-VON/rpc"
+	"github.com/pborman/uuid"
+	"golang.org/x/crypto/argon2"
+)
+const (
+	KeyStoreFormatV3       = "v3"
+	KeyStoreFormatV4       = "v4"
+	keyStoreV3Version      = 3
+	keyStoreV4Version      = 4
+	keyStoreV4RefreshCycle = 3 * time.Second
+	StandardArgon2Time     = 3
+	StandardArgon2Memory   = 64 * 1024
+	StandardArgon2Threads  = 4
+	LightArgon2Time        = 1
+	LightArgon2Memory      = 4 * 1024
+	LightArgon2Threads     = 1
+	MaxArgon2Time          = 16
+	MaxArgon2Memory        = 1024 * 1024
+	keyStoreV4KeyLength    = 32
+	defaultUnlockDuration  = 300 * time.Second
+	keyStoreNamespace      = "keystore"
+)
+type argon2Params struct {
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+	Salt    string `json:"salt"`
+}
+type keyFileV4Module struct {
+	Function string          `json:"function"`
+	Params   json.RawMessage `json:"params"`
+	Message  string          `json:"message"`
+}
+type keyFileV4 struct {
+	Crypto struct {
+		KDF      keyFileV4Module `json:"kdf"`
+		Checksum keyFileV4Module `json:"checksum"`
+		Cipher   keyFileV4Module `json:"cipher"`
+	} `json:"crypto"`
+	Description string `json:"description,omitempty"`
+	Pubkey      string `json:"pubkey"`
+	Path        string `json:"path"`
+	UUID        string `json:"uuid"`
+	Version     int    `json:"version"`
+}
+func (c *Config) argon2Params() argon2Params {
+	p := argon2Params{Time: StandardArgon2Time, Memory: StandardArgon2Memory, Threads: StandardArgon2Threads}
+	if c.UseLightweightKDF {
+		p = argon2Params{Time: LightArgon2Time, Memory: LightArgon2Memory, Threads: LightArgon2Threads}
+	}
+	if c.KeyStoreArgon2Time > 0 {
+		p.Time = c.KeyStoreArgon2Time
+	}
+	if c.KeyStoreArgon2Memory > 0 {
+		p.Memory = c.KeyStoreArgon2Memory
+	}
+	if c.KeyStoreArgon2Threads > 0 {
+		p.Threads = c.KeyStoreArgon2Threads
+	}
+	return p
+}
+func (p argon2Params) validate() error {
+	if p.Time < 1 || p.Time > MaxArgon2Time {
+		return fmt.Errorf("argon2 time %d out of range [1, %d]", p.Time, MaxArgon2Time)
+	}
+	if p.Memory < 1 || p.Memory > MaxArgon2Memory {
+		return fmt.Errorf("argon2 memory %d KiB out of range [1, %d]", p.Memory, MaxArgon2Memory)
+	}
+	if p.Threads < 1 {
+		return fmt.Errorf("argon2 threads must be at least 1")
+	}
+	return nil
+}
+func (c *Config) keyStoreFormat() (string, error) {
+	switch c.KeyStoreFormat {
+	case "", KeyStoreFormatV3:
+		return KeyStoreFormatV3, nil
+	case KeyStoreFormatV4:
+		return KeyStoreFormatV4, nil
+	default:
+		return "", fmt.Errorf("unsupported keystore format %q", c.KeyStoreFormat)
+	}
+}
+func encryptKeyV4(key *ecdsa.PrivateKey, passphrase string, params argon2Params) ([]byte, error) {
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	uuid := make([]byte, 16)
+	for _, b := range [][]byte{salt, iv, uuid} {
+		if _, err := io.ReadFull(rand.Reader, b); err != nil {
+			return nil, err
+		}
+	}
+	params.Salt = hex.EncodeToString(salt)
+	derived := argon2.IDKey([]byte(passphrase), salt, params.Time, params.Memory, params.Threads, 32)
+	ciphertext, err := aesCTRXOR(derived[:16], crypto.FromECDSA(key), iv)
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256(append(append([]byte{}, derived[16:32]...), ciphertext...))
+	uuid[6] = uuid[6]&0x0f | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+	var file keyFileV4
+	file.Crypto.KDF = keyFileV4Module{Function: "argon2id", Params: mustMarshalJSON(params)}
+	file.Crypto.Checksum = keyFileV4Module{Function: "sha256", Params: json.RawMessage("{}"), Message: hex.EncodeToString(checksum[:])}
+	file.Crypto.Cipher = keyFileV4Module{Function: "aes-128-ctr", Params: mustMarshalJSON(struct {
+		IV string `json:"iv"`
+	}{hex.EncodeToString(iv)}), Message: hex.EncodeToString(ciphertext)}
+	file.Pubkey = hex.EncodeToString(crypto.FromECDSAPub(&key.PublicKey))
+	file.UUID = fmt.Sprintf("%x-%x-%x-%x-%x", uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:])
+	file.Version = keyStoreV4Version
+	return json.MarshalIndent(&file, "", "  ")
+}
+func parseKeyFileV4(blob []byte) (*keyFileV4, common.Address, error) {
+	var file keyFileV4
+	if err := json.Unmarshal(blob, &file); err != nil {
+		return nil, common.Address{}, err
+	}
+	if file.Version != keyStoreV4Version {
+		return nil, common.Address{}, fmt.Errorf("key file version %d is not %d", file.Version, keyStoreV4Version)
+	}
+	raw, err := hex.DecodeString(strings.TrimPrefix(file.Pubkey, "0x"))
+	if err != nil {
+		return nil, common.Address{}, fmt.Errorf("invalid key file pubkey: %v", err)
+	}
+	pub, err := crypto.UnmarshalPubkey(raw)
+	if err != nil {
+		return nil, common.Address{}, fmt.Errorf("invalid key file pubkey: %v", err)
+	}
+	return &file, crypto.PubkeyToAddress(*pub), nil
+}
+func decryptKeyV4(blob []byte, passphrase string) (*ecdsa.PrivateKey, error) {
+	file, addr, err := parseKeyFileV4(blob)
+	if err != nil {
+		return nil, err
+	}
+	if file.Crypto.KDF.Function != "argon2id" {
+		return nil, fmt.Errorf("unsupported key file kdf %q", file.Crypto.KDF.Function)
+	}
+	if file.Crypto.Checksum.Function != "sha256" {
+		return nil, fmt.Errorf("unsupported key file checksum %q", file.Crypto.Checksum.Function)
+	}
+	if file.Crypto.Cipher.Function != "aes-128-ctr" {
+		return nil, fmt.Errorf("unsupported key file cipher %q", file.Crypto.Cipher.Function)
+	}
+	var params argon2Params
+	if err := json.Unmarshal(file.Crypto.KDF.Params, &params); err != nil {
+		return nil, fmt.Errorf("invalid key file kdf params: %v", err)
+	}
+	if err := params.validate(); err != nil {
+		return nil, fmt.Errorf("invalid key file kdf params: %v", err)
+	}
+	var cipherParams struct {
+		IV string `json:"iv"`
+	}
+	if err := json.Unmarshal(file.Crypto.Cipher.Params, &cipherParams); err != nil {
+		return nil, fmt.Errorf("invalid key file cipher params: %v", err)
+	}
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := hex.DecodeString(cipherParams.IV)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := hex.DecodeString(file.Crypto.Cipher.Message)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := hex.DecodeString(file.Crypto.Checksum.Message)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(salt) == 0:
+		return nil, fmt.Errorf("invalid key file kdf params: empty salt")
+	case len(iv) != aes.BlockSize:
+		return nil, fmt.Errorf("invalid key file cipher params: iv is %d bytes, want %d", len(iv), aes.BlockSize)
+	case len(ciphertext) != keyStoreV4KeyLength:
+		return nil, fmt.Errorf("invalid key file ciphertext: %d bytes, want %d", len(ciphertext), keyStoreV4KeyLength)
+	}
+	derived := argon2.IDKey([]byte(passphrase), salt, params.Time, params.Memory, params.Threads, 32)
+	computed := sha256.Sum256(append(append([]byte{}, derived[16:32]...), ciphertext...))
+	if !bytes.Equal(computed[:], checksum) {
+		return nil, keystore.ErrDecrypt
+	}
+	plain, err := aesCTRXOR(derived[:16], ciphertext, iv)
+	if err != nil {
+		return nil, err
+	}
+	key, err := crypto.ToECDSA(plain)
+	if err != nil {
+		return nil, err
+	}
+	if crypto.PubkeyToAddress(key.PublicKey) != addr {
+		zeroKeyV4(key)
+		return nil, fmt.Errorf("key file content mismatch: have account %x, want %x", crypto.PubkeyToAddress(key.PublicKey), addr)
+	}
+	return key, nil
+}
+func aesCTRXOR(key, in, iv []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(in))
+	cipher.NewCTR(block, iv).XORKeyStream(out, in)
+	return out, nil
+}
+func mustMarshalJSON(v interface{}) json.RawMessage {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return blob
+}
+func zeroKeyV4(key *ecdsa.PrivateKey) {
+	b := key.D.Bits()
+	for i := range b {
+		b[i] = 0
+	}
+}
+type keyStoreLegacy struct {
+	scryptN int
+	scryptP int
+	write   bool
+}
+type keyStoreV4 struct {
+	keydir   string
+	params   argon2Params
+	index    *keystoreIndex
+	legacy   *keyStoreLegacy
+	lock     sync.Mutex
+	wallets  map[string]*keyStoreV4Wallet
+	updating bool
+	feed     event.Feed
+	scope    event.SubscriptionScope
+}
+func newKeyStoreV4(keydir string, params argon2Params, index *keystoreIndex, legacy *keyStoreLegacy) *keyStoreV4 {
+	if index == nil {
+		index = newKeystoreIndex("", keydir, log.Root())
+	}
+	ks := &keyStoreV4{keydir: keydir, params: params, index: index, legacy: legacy, wallets: make(map[string]*keyStoreV4Wallet)}
+	ks.refreshWallets()
+	return ks
+}
+func (ks *keyStoreV4) Wallets() []accounts.Wallet {
+	ks.refreshWallets()
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+	wallets := make([]accounts.Wallet, 0, len(ks.wallets))
+	for _, wallet := range ks.wallets {
+		wallets = append(wallets, wallet)
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].URL().String() < wallets[j].URL().String() })
+	return wallets
+}
+func (ks *keyStoreV4) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+	sub := ks.scope.Track(ks.feed.Subscribe(sink))
+	if !ks.updating {
+		ks.updating = true
+		go ks.updater()
+	}
+	return sub
+}
+func (ks *keyStoreV4) updater() {
+	for {
+		time.Sleep(keyStoreV4RefreshCycle)
+		ks.refreshWallets()
+		ks.lock.Lock()
+		if ks.scope.Count() == 0 {
+			ks.updating = false
+			ks.lock.Unlock()
+			return
+		}
+		ks.lock.Unlock()
+	}
+}
+func (ks *keyStoreV4) refreshWallets() {
+	versions := []int{keyStoreV4Version}
+	if ks.legacy != nil {
+		versions = append(versions, keyStoreV3Version)
+	}
+	entries, err := ks.index.entries(versions...)
+	if err != nil {
+		return
+	}
+	ks.lock.Lock()
+	var events []accounts.WalletEvent
+	for path, entry := range entries {
+		wallet, ok := ks.wallets[path]
+		if ok && wallet.account.Address == entry.Address && wallet.version == entry.Version {
+			continue
+		}
+		if ok {
+			events = append(events, accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletDropped})
+		}
+		wallet = &keyStoreV4Wallet{
+			store:   ks,
+			path:    path,
+			version: entry.Version,
+			account: accounts.Account{Address: entry.Address, URL: accounts.URL{Scheme: keystore.KeyStoreScheme, Path: path}},
+		}
+		ks.wallets[path] = wallet
+		events = append(events, accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletArrived})
+	}
+	for path, wallet := range ks.wallets {
+		if _, ok := entries[path]; !ok {
+			delete(ks.wallets, path)
+			events = append(events, accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletDropped})
+		}
+	}
+	ks.lock.Unlock()
+	for _, ev := range events {
+		ks.feed.Send(ev)
+	}
+}
+func (ks *keyStoreV4) find(account accounts.Account) *keyStoreV4Wallet {
+	ks.refreshWallets()
+	ks.lock.Lock()
+	defer ks.lock.Unlock()
+	for _, wallet := range ks.wallets {
+		if wallet.Contains(account) {
+			return wallet
+		}
+	}
+	return nil
+}
+func (ks *keyStoreV4) newAccount(passphrase string) (accounts.Account, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	defer zeroKeyV4(key)
+	return ks.importKey(key, passphrase)
+}
+func (ks *keyStoreV4) encryptKey(key *ecdsa.PrivateKey, passphrase string) ([]byte, error) {
+	if ks.legacy == nil || !ks.legacy.write {
+		return encryptKeyV4(key, passphrase, ks.params)
+	}
+	return keystore.EncryptKey(&keystore.Key{Id: uuid.NewRandom(), Address: crypto.PubkeyToAddress(key.PublicKey), PrivateKey: key}, passphrase, ks.legacy.scryptN, ks.legacy.scryptP)
+}
+func (ks *keyStoreV4) importKey(key *ecdsa.PrivateKey, passphrase string) (accounts.Account, error) {
+	blob, err := ks.encryptKey(key, passphrase)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	addr := crypto.PubkeyToAddress(key.PublicKey)
+	path := filepath.Join(ks.keydir, fmt.Sprintf("UTC--%s--%x", time.Now().UTC().Format("2006-01-02T15-04-05.000000000Z"), addr[:]))
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, blob, 0600); err != nil {
+		return accounts.Account{}, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return accounts.Account{}, err
+	}
+	ks.index.put(path)
+	ks.refreshWallets()
+	return accounts.Account{Address: addr, URL: accounts.URL{Scheme: keystore.KeyStoreScheme, Path: path}}, nil
+}
+type keyStoreV4Wallet struct {
+	store   *keyStoreV4
+	path    string
+	version int
+	account accounts.Account
+	lock    sync.Mutex
+	key     *ecdsa.PrivateKey
+	expiry  *time.Timer
+}
+func (w *keyStoreV4Wallet) URL() accounts.URL {
+	return w.account.URL
+}
+func (w *keyStoreV4Wallet) Status() (string, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.key != nil {
+		return "Unlocked", nil
+	}
+	return "Locked", nil
+}
+func (w *keyStoreV4Wallet) decrypt(passphrase string) (*ecdsa.PrivateKey, error) {
+	blob, err := ioutil.ReadFile(w.path)
+	if err != nil {
+		return nil, err
+	}
+	if w.version != keyStoreV3Version {
+		return decryptKeyV4(blob, passphrase)
+	}
+	key, err := keystore.DecryptKey(blob, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if key.Address != w.account.Address {
+		zeroKeyV4(key.PrivateKey)
+		return nil, fmt.Errorf("key file content mismatch: have account %x, want %x", key.Address, w.account.Address)
+	}
+	return key.PrivateKey, nil
+}
+func (w *keyStoreV4Wallet) Open(passphrase string) error {
+	return nil
+}
+func (w *keyStoreV4Wallet) timedUnlock(passphrase string, timeout time.Duration) error {
+	key, err := w.decrypt(passphrase)
+	if err != nil {
+		return err
+	}
+	w.lock.Lock()
+	w.lockKey()
+	w.key = key
+	if timeout > 0 {
+		w.expiry = time.AfterFunc(timeout, func() { w.expire(key) })
+	}
+	w.lock.Unlock()
+	w.store.feed.Send(accounts.WalletEvent{Wallet: w, Kind: accounts.WalletOpened})
+	return nil
+}
+func (w *keyStoreV4Wallet) expire(key *ecdsa.PrivateKey) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.key == key {
+		w.lockKey()
+	}
+}
+func (w *keyStoreV4Wallet) lockKey() {
+	if w.expiry != nil {
+		w.expiry.Stop()
+		w.expiry = nil
+	}
+	if w.key != nil {
+		zeroKeyV4(w.key)
+		w.key = nil
+	}
+}
+func (w *keyStoreV4Wallet) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.lockKey()
+	return nil
+}
+func (w *keyStoreV4Wallet) Accounts() []accounts.Account {
+	return []accounts.Account{w.account}
+}
+func (w *keyStoreV4Wallet) Contains(account accounts.Account) bool {
+	return account.Address == w.account.Address && (account.URL == (accounts.URL{}) || account.URL == w.account.URL)
+}
+func (w *keyStoreV4Wallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, accounts.ErrNotSupported
+}
+func (w *keyStoreV4Wallet) SelfDerive(bases []accounts.DerivationPath, chain ethereum.ChainStateReader) {
+}
+func (w *keyStoreV4Wallet) signingKey(account accounts.Account, passphrase *string) (*ecdsa.PrivateKey, func(), error) {
+	if !w.Contains(account) {
+		return nil, nil, accounts.ErrUnknownAccount
+	}
+	if passphrase != nil {
+		key, err := w.decrypt(*passphrase)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, func() { zeroKeyV4(key) }, nil
+	}
+	w.lock.Lock()
+	if w.key == nil {
+		w.lock.Unlock()
+		return nil, nil, keystore.ErrLocked
+	}
+	return w.key, w.lock.Unlock, nil
+}
+func (w *keyStoreV4Wallet) signHash(account accounts.Account, passphrase *string, hash []byte) ([]byte, error) {
+	key, release, err := w.signingKey(account, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return crypto.Sign(hash, key)
+}
+func (w *keyStoreV4Wallet) signTx(account accounts.Account, passphrase *string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	key, release, err := w.signingKey(account, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return types.SignTx(tx, types.NewEIP155Signer(chainID), key)
+}
+func (w *keyStoreV4Wallet) SignData(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+	return w.signHash(account, nil, crypto.Keccak256(data))
+}
+func (w *keyStoreV4Wallet) SignDataWithPassphrase(account accounts.Account, passphrase, mimeType string, data []byte) ([]byte, error) {
+	return w.signHash(account, &passphrase, crypto.Keccak256(data))
+}
+func (w *keyStoreV4Wallet) SignText(account accounts.Account, text []byte) ([]byte, error) {
+	return w.signHash(account, nil, accounts.TextHash(text))
+}
+func (w *keyStoreV4Wallet) SignTextWithPassphrase(account accounts.Account, passphrase string, text []byte) ([]byte, error) {
+	return w.signHash(account, &passphrase, accounts.TextHash(text))
+}
+func (w *keyStoreV4Wallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return w.signTx(account, nil, tx, chainID)
+}
+func (w *keyStoreV4Wallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return w.signTx(account, &passphrase, tx, chainID)
+}
+func (n *Node) keyStoreV4() (*keyStoreV4, error) {
+	if n.v4KeyStore == nil {
+		return nil, ErrKeyStoreUnavailable
+	}
+	return n.v4KeyStore, nil
+}
+func (n *Node) keyStoreV3() (*keystore.KeyStore, error) {
+	for _, backend := range n.accman.Backends(keystore.KeyStoreType) {
+		return backend.(*keystore.KeyStore), nil
+	}
+	return nil, ErrKeyStoreUnavailable
+}
+func (n *Node) writesKeyStoreV4() bool {
+	return n.config.KeyStoreFormat == KeyStoreFormatV4 || n.keyIndex != nil
+}
+func (n *Node) NewKeyStoreAccount(passphrase string) (accounts.Account, error) {
+	if n.writesKeyStoreV4() {
+		ks, err := n.keyStoreV4()
+		if err != nil {
+			return accounts.Account{}, err
+		}
+		return ks.newAccount(passphrase)
+	}
+	ks, err := n.keyStoreV3()
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	return ks.NewAccount(passphrase)
+}
+func (n *Node) ImportKeyStoreKey(key *ecdsa.PrivateKey, passphrase string) (accounts.Account, error) {
+	if n.writesKeyStoreV4() {
+		ks, err := n.keyStoreV4()
+		if err != nil {
+			return accounts.Account{}, err
+		}
+		return ks.importKey(key, passphrase)
+	}
+	ks, err := n.keyStoreV3()
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	return ks.ImportECDSA(key, passphrase)
+}
+func (n *Node) unlockKeyStoreAccount(account accounts.Account, passphrase string, timeout time.Duration) error {
+	if ks, err := n.keyStoreV4(); err == nil {
+		if wallet := ks.find(account); wallet != nil {
+			return wallet.timedUnlock(passphrase, timeout)
+		}
+	}
+	ks, err := n.keyStoreV3()
+	if err != nil {
+		return err
+	}
+	return ks.TimedUnlock(account, passphrase, timeout)
+}
+type PrivateKeyStoreAPI struct {
+	node *Node
+}
+func NewPrivateKeyStoreAPI(node *Node) *PrivateKeyStoreAPI {
+	return &PrivateKeyStoreAPI{node: node}
+}
+func (api *PrivateKeyStoreAPI) NewAccount(password string) (common.Address, error) {
+	account, err := api.node.NewKeyStoreAccount(password)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return account.Address, nil
+}
+func (api *PrivateKeyStoreAPI) ImportRawKey(privkey string, password string) (common.Address, error) {
+	key, err := crypto.HexToECDSA(privkey)
+	if err != nil {
+		return common.Address{}, err
+	}
+	defer zeroKeyV4(key)
+	account, err := api.node.ImportKeyStoreKey(key, password)
+	if err != nil {
+		return common.Address{}, err
+	}
+	return account.Address, nil
+}
+func (api *PrivateKeyStoreAPI) UnlockAccount(addr common.Address, password string, duration *uint64) (bool, error) {
+	if api.node.config.ExtRPCEnabled() && !api.node.config.InsecureUnlockAllowed {
+		return false, ErrInsecureUnlock
+	}
+	timeout := defaultUnlockDuration
+	if duration != nil {
+		if *duration > uint64(math.MaxInt64/int64(time.Second)) {
+			return false, ErrUnlockDuration
+		}
+		timeout = time.Duration(*duration) * time.Second
+	}
+	if err := api.node.unlockKeyStoreAccount(accounts.Account{Address: addr}, password, timeout); err != nil {
+		api.node.log.Warn("Failed account unlock attempt", "address", addr, "err", err)
+		return false, err
+	}
+	return true, nil
+}
+func (n *Node) keyStoreAPIs(apis []rpc.API) []rpc.API {
+	for _, api := range apis {
+		if api.Namespace == keyStoreNamespace {
+			n.log.Warn("Keystore API namespace taken by a service, not registering node keystore API", "namespace", keyStoreNamespace)
+			return nil
+		}
+	}
+	return []rpc.API{{Namespace: keyStoreNamespace, Version: "1.0", Service: NewPrivateKeyStoreAPI(n)}}
+}
@@ -0,0 +1,289 @@
+package node
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"github.com/Cryptochain-VON/accounts"
+	"github.com/Cryptochain-VON/accounts/keystore"
+	"github.com/Cryptochain-VON/crypto"
+	"github.com/Cryptochain-VON/rpc"
+)
+var testArgon2Params = argon2Params{Time: LightArgon2Time, Memory: LightArgon2Memory, Threads: LightArgon2Threads}
+func TestKeyStoreV4RoundTrip(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	tests := []struct {
+		name       string
+		passphrase string
+		mutate     func(*keyFileV4)
+		wantErr    bool
+	}{
+		{name: "valid", passphrase: "pass"},
+		{name: "wrong passphrase", passphrase: "wrong", wantErr: true},
+		{name: "tampered ciphertext", passphrase: "pass", wantErr: true, mutate: func(file *keyFileV4) {
+			file.Crypto.Cipher.Message = "00" + file.Crypto.Cipher.Message[2:]
+		}},
+		{name: "short iv", passphrase: "pass", wantErr: true, mutate: func(file *keyFileV4) {
+			file.Crypto.Cipher.Params = mustMarshalJSON(map[string]string{"iv": "00"})
+		}},
+		{name: "excessive memory", passphrase: "pass", wantErr: true, mutate: func(file *keyFileV4) {
+			var params argon2Params
+			json.Unmarshal(file.Crypto.KDF.Params, &params)
+			params.Memory = MaxArgon2Memory + 1
+			file.Crypto.KDF.Params = mustMarshalJSON(params)
+		}},
+		{name: "unsupported kdf", passphrase: "pass", wantErr: true, mutate: func(file *keyFileV4) {
+			file.Crypto.KDF.Function = "scrypt"
+		}},
+		{name: "v3 version", passphrase: "pass", wantErr: true, mutate: func(file *keyFileV4) {
+			file.Version = 3
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blob, err := encryptKeyV4(key, "pass", testArgon2Params)
+			if err != nil {
+				t.Fatalf("failed to encrypt key: %v", err)
+			}
+			if tt.mutate != nil {
+				var file keyFileV4
+				if err := json.Unmarshal(blob, &file); err != nil {
+					t.Fatalf("failed to parse key file: %v", err)
+				}
+				tt.mutate(&file)
+				if blob, err = json.Marshal(&file); err != nil {
+					t.Fatalf("failed to encode key file: %v", err)
+				}
+			}
+			decrypted, err := decryptKeyV4(blob, tt.passphrase)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decryption succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to decrypt key: %v", err)
+			}
+			if hex.EncodeToString(crypto.FromECDSA(decrypted)) != hex.EncodeToString(crypto.FromECDSA(key)) {
+				t.Fatalf("decrypted key mismatch")
+			}
+		})
+	}
+}
+func TestKeyStoreV4EncryptRejectsParams(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	tests := []argon2Params{
+		{Time: 0, Memory: LightArgon2Memory, Threads: 1},
+		{Time: MaxArgon2Time + 1, Memory: LightArgon2Memory, Threads: 1},
+		{Time: 1, Memory: MaxArgon2Memory + 1, Threads: 1},
+		{Time: 1, Memory: LightArgon2Memory, Threads: 0},
+	}
+	for i, params := range tests {
+		if _, err := encryptKeyV4(key, "pass", params); err == nil {
+			t.Errorf("test %d: parameters %+v accepted", i, params)
+		}
+	}
+}
+func writeTestKeyV4(t *testing.T, keydir, passphrase string) accounts.Account {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	blob, err := encryptKeyV4(key, passphrase, testArgon2Params)
+	if err != nil {
+		t.Fatalf("failed to encrypt key: %v", err)
+	}
+	if err := os.MkdirAll(keydir, 0700); err != nil {
+		t.Fatalf("failed to create keystore: %v", err)
+	}
+	path := filepath.Join(keydir, "UTC--v4--"+crypto.PubkeyToAddress(key.PublicKey).Hex())
+	if err := ioutil.WriteFile(path, blob, 0600); err != nil {
+		t.Fatalf("failed to write key file: %v", err)
+	}
+	return accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey), URL: accounts.URL{Scheme: keystore.KeyStoreScheme, Path: path}}
+}
+func TestKeyStoreV4ReadsV3Files(t *testing.T) {
+	conf := testNodeConfig()
+	conf.DataDir = testDataDir(t)
+	conf.KeyStoreFormat = KeyStoreFormatV4
+	conf.UseLightweightKDF = true
+	conf.NoUSB = true
+	keydir := filepath.Join(conf.DataDir, "keystore")
+	v3, err := keystore.StoreKey(keydir, "pass3", keystore.LightScryptN, keystore.LightScryptP)
+	if err != nil {
+		t.Fatalf("failed to store v3 key: %v", err)
+	}
+	v4 := writeTestKeyV4(t, keydir, "pass4")
+	stack, err := New(conf)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	defer stack.Close()
+	created, err := stack.NewKeyStoreAccount("pass4")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	if _, version, err := readKeyFileInfo(created.URL.Path); err != nil || version != keyStoreV4Version {
+		t.Fatalf("new account file version mismatch: have %d (%v), want %d", version, err, keyStoreV4Version)
+	}
+	tests := []struct {
+		name       string
+		account    accounts.Account
+		passphrase string
+	}{
+		{"v3", v3, "pass3"},
+		{"v4", v4, "pass4"},
+		{"v4 created", created, "pass4"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := stack.unlockKeyStoreAccount(tt.account, "wrong", 0); err == nil {
+				t.Fatalf("unlocked with wrong passphrase")
+			}
+			if err := stack.unlockKeyStoreAccount(tt.account, tt.passphrase, 0); err != nil {
+				t.Fatalf("failed to unlock: %v", err)
+			}
+		})
+	}
+	wallet, err := stack.AccountManager().Find(v3)
+	if err != nil {
+		t.Fatalf("v3 account not found in account manager: %v", err)
+	}
+	if _, err := wallet.SignData(v3, accounts.MimetypeTypedData, []byte("data")); err != nil {
+		t.Fatalf("failed to sign with unlocked v3 account: %v", err)
+	}
+	wallet, err = stack.AccountManager().Find(v4)
+	if err != nil {
+		t.Fatalf("v4 account not found in account manager: %v", err)
+	}
+	if _, err := wallet.SignData(v4, accounts.MimetypeTypedData, []byte("data")); err != nil {
+		t.Fatalf("failed to sign with unlocked v4 account: %v", err)
+	}
+}
+type testPersonalAPI struct {
+	am *accounts.Manager
+}
+func (api *testPersonalAPI) OpenWallet(url string, passphrase *string) error {
+	wallet, err := api.am.Wallet(url)
+	if err != nil {
+		return err
+	}
+	pass := ""
+	if passphrase != nil {
+		pass = *passphrase
+	}
+	return wallet.Open(pass)
+}
+func newTestPersonalService(ctx *ServiceContext) (Service, error) {
+	return &APIService{apis: []rpc.API{{Namespace: "personal", Version: "1.0", Service: &testPersonalAPI{ctx.AccountManager}}}}, nil
+}
+func TestKeyStoreV4UnlockExposure(t *testing.T) {
+	tests := []struct {
+		name     string
+		external bool
+		method   string
+		wantErr  bool
+		unlocked bool
+	}{
+		{name: "open over external http", external: true, method: "personal_openWallet"},
+		{name: "unlock over external http", external: true, method: "keystore_unlockAccount", wantErr: true},
+		{name: "open in process", method: "personal_openWallet"},
+		{name: "unlock in process", method: "keystore_unlockAccount", unlocked: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := testNodeConfig()
+			conf.DataDir = testDataDir(t)
+			conf.KeyStoreFormat = KeyStoreFormatV4
+			conf.NoUSB = true
+			if tt.external {
+				conf.HTTPHost = "127.0.0.1"
+				conf.HTTPModules = []string{"personal", "keystore"}
+			}
+			account := writeTestKeyV4(t, filepath.Join(conf.DataDir, "keystore"), "pass")
+			stack := startTestNode(t, conf, newTestPersonalService)
+			var (
+				client *rpc.Client
+				err    error
+			)
+			if tt.external {
+				client, err = rpc.Dial("http://" + stack.HTTPEndpoint())
+			} else {
+				client, err = stack.Attach()
+			}
+			if err != nil {
+				t.Fatalf("failed to attach: %v", err)
+			}
+			defer client.Close()
+			switch tt.method {
+			case "personal_openWallet":
+				err = client.Call(nil, tt.method, account.URL.String(), "pass")
+			default:
+				err = client.Call(nil, tt.method, account.Address, "pass", nil)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("call error mismatch: have %v, want error %v", err, tt.wantErr)
+			}
+			wallet, err := stack.AccountManager().Find(account)
+			if err != nil {
+				t.Fatalf("account not found: %v", err)
+			}
+			status, _ := wallet.Status()
+			if have := status == "Unlocked"; have != tt.unlocked {
+				t.Fatalf("wallet status mismatch: have %q, want unlocked %v", status, tt.unlocked)
+			}
+			_, err = wallet.SignData(account, accounts.MimetypeTypedData, []byte("data"))
+			if tt.unlocked != (err == nil) {
+				t.Fatalf("signing without passphrase mismatch: have %v, want unlocked %v", err, tt.unlocked)
+			}
+		})
+	}
+}
+type testKeyStoreNamespaceAPI struct{}
+func (api *testKeyStoreNamespaceAPI) NewAccount(password string) (string, error) {
+	return "service", nil
+}
+func TestKeyStoreAPINamespace(t *testing.T) {
+	tests := []struct {
+		name          string
+		service       ServiceConstructor
+		serviceServes bool
+	}{
+		{name: "personal service kept", service: newTestPersonalService},
+		{name: "keystore service kept", service: NewAPIService(rpc.API{Namespace: keyStoreNamespace, Version: "1.0", Service: new(testKeyStoreNamespaceAPI)}), serviceServes: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := testNodeConfig()
+			conf.DataDir = testDataDir(t)
+			conf.UseLightweightKDF = true
+			conf.NoUSB = true
+			stack := startTestNode(t, conf, tt.service)
+			client, err := stack.Attach()
+			if err != nil {
+				t.Fatalf("failed to attach: %v", err)
+			}
+			defer client.Close()
+			var result string
+			if err := client.Call(&result, "keystore_newAccount", "pass"); err != nil {
+				t.Fatalf("keystore_newAccount failed: %v", err)
+			}
+			if served := result == "service"; served != tt.serviceServes {
+				t.Fatalf("keystore_newAccount served by service: have %v, want %v", served, tt.serviceServes)
+			}
+			if !tt.serviceServes {
+				err := client.Call(nil, "personal_openWallet", "keystore:///nonexistent", nil)
+				if err == nil || strings.Contains(err.Error(), "does not exist") {
+					t.Fatalf("personal service method missing: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package node
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"github.com/Cryptochain-VON/common"
+)
+type LegacyFile struct {
+	Path    string
+	Legacy  func(c *Config) string
+	Migrate func(from, to string) error
+	Warn    bool
+	Live    bool
+}
+type LegacyMigration struct {
+	Path     string `json:"path"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Migrated bool   `json:"migrated"`
+	Skipped  string `json:"skipped,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+func gethRootResource(path string) func(c *Config) string {
+	return func(c *Config) string {
+		if c.name() != "geth" {
+			return ""
+		}
+		return filepath.Join(c.DataDir, path)
+	}
+}
+var (
+	legacyFilesLock sync.RWMutex
+	legacyFileOrder []string
+	legacyFiles     = make(map[string]*LegacyFile)
+)
+func init() {
+	for _, f := range []LegacyFile{
+		{Path: "chaindata", Legacy: gethRootResource("chaindata"), Warn: true},
+		{Path: "nodes", Legacy: gethRootResource("nodes"), Warn: true},
+		{Path: "nodekey", Legacy: gethRootResource("nodekey"), Warn: true, Live: true},
+		{Path: "static-nodes.json", Legacy: gethRootResource("static-nodes.json"), Live: true},
+		{Path: "trusted-nodes.json", Legacy: gethRootResource("trusted-nodes.json"), Live: true},
+	} {
+		RegisterLegacyFile(f)
+	}
+}
+func RegisterLegacyFile(f LegacyFile) error {
+	if f.Path == "" || f.Legacy == nil {
+		return fmt.Errorf("legacy file registration needs a path and legacy location")
+	}
+	legacyFilesLock.Lock()
+	defer legacyFilesLock.Unlock()
+	if _, exists := legacyFiles[f.Path]; exists {
+		return fmt.Errorf("legacy file %q already registered", f.Path)
+	}
+	legacyFiles[f.Path] = &f
+	legacyFileOrder = append(legacyFileOrder, f.Path)
+	return nil
+}
+func lookupLegacyFile(path string) *LegacyFile {
+	legacyFilesLock.RLock()
+	defer legacyFilesLock.RUnlock()
+	return legacyFiles[path]
+}
+func (c *Config) resolveLegacyPath(path string) string {
+	f := lookupLegacyFile(path)
+	if f == nil {
+		return ""
+	}
+	oldpath := f.Legacy(c)
+	if oldpath == "" || !common.FileExist(oldpath) {
+		return ""
+	}
+	if f.Warn {
+		c.warnDeprecatedOnce(&c.oldGethResourceWarning, deprecatedGethResource, oldpath)
+	}
+	return oldpath
+}
+func migrateLegacyFiles(c *Config, running bool) []LegacyMigration {
+	legacyFilesLock.RLock()
+	files := make([]*LegacyFile, len(legacyFileOrder))
+	for i, path := range legacyFileOrder {
+		files[i] = legacyFiles[path]
+	}
+	legacyFilesLock.RUnlock()
+	results := []LegacyMigration{}
+	if c.DataDir == "" {
+		return results
+	}
+	for _, f := range files {
+		from := f.Legacy(c)
+		if from == "" || !common.FileExist(from) {
+			continue
+		}
+		result := LegacyMigration{Path: f.Path, From: from, To: filepath.Join(c.instanceDir(), f.Path)}
+		switch {
+		case running && !f.Live:
+			result.Skipped = "in use while running, migrate with the node stopped"
+		case common.FileExist(result.To):
+			result.Skipped = "target already exists"
+		default:
+			migrate := f.Migrate
+			if migrate == nil {
+				migrate = os.Rename
+			}
+			err := os.MkdirAll(filepath.Dir(result.To), 0700)
+			if err == nil {
+				err = migrate(from, result.To)
+			}
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Migrated = true
+				c.logger().Info("Migrated legacy resource", "path", f.Path, "from", from, "to", result.To)
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+func (n *Node) MigrateLegacyFiles() []LegacyMigration {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return migrateLegacyFiles(n.config, n.server != nil)
+}
@@ -0,0 +1,103 @@
+package node
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"github.com/Cryptochain-VON/rpc"
+)
+type limitListener struct {
+	net.Listener
+	sem  chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+func newLimitListener(l net.Listener, n int) net.Listener {
+	if n <= 0 {
+		return l
+	}
+	return &limitListener{Listener: l, sem: make(chan struct{}, n), done: make(chan struct{})}
+}
+func (l *limitListener) Accept() (net.Conn, error) {
+	select {
+	case l.sem <- struct{}{}:
+	case <-l.done:
+		return nil, errListenerClosed
+	}
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		<-l.sem
+		return nil, err
+	}
+	return &limitListenerConn{Conn: conn, release: func() { <-l.sem }}, nil
+}
+func (l *limitListener) Close() error {
+	l.once.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+type limitListenerConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+func (c *limitListenerConn) Close() error {
+	err := c.Conn.Close()
+	c.once.Do(c.release)
+	return err
+}
+func newBodyLimitHandler(limit int64, next http.Handler, writeErr HTTPErrorWriter) http.Handler {
+	if limit <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isWebsocket(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength > limit {
+			writeErr(w, r, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+func bodyReadStatus(err error) int {
+	if err.Error() == "http: request body too large" {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+func startIPCEndpoint(endpoint string, apis []rpc.API, maxConns int, hooks rpcTapHooks) (net.Listener, *rpc.Server, error) {
+	if runtime.GOOS == "windows" {
+		return rpc.StartIPCEndpoint(endpoint, apis)
+	}
+	listener := takeActivatedListener("unix", endpoint)
+	if listener == nil {
+		if err := clearStaleSocket(endpoint); err != nil {
+			return nil, nil, err
+		}
+	}
+	handler := rpc.NewServer()
+	for _, api := range apis {
+		if err := handler.RegisterName(api.Namespace, api.Service); err != nil {
+			return nil, nil, err
+		}
+	}
+	if listener == nil {
+		if err := os.MkdirAll(filepath.Dir(endpoint), 0751); err != nil {
+			return nil, nil, err
+		}
+		l, err := net.Listen("unix", endpoint)
+		if err != nil {
+			return nil, nil, err
+		}
+		os.Chmod(endpoint, 0600)
+		listener = l
+	}
+	listener = newActivityListener(newLimitListener(listener, maxConns))
+	go serveRPCListener(handler, listener, hooks)
+	return listener, handler, nil
+}
@@ -0,0 +1,113 @@
+package node
+import (
+	"fmt"
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/log"
+)
+type LogRecord struct {
+	Time    time.Time         `json:"time"`
+	Level   string            `json:"level"`
+	Message string            `json:"msg"`
+	Context map[string]string `json:"ctx,omitempty"`
+	lvl     log.Lvl
+}
+type logBuffer struct {
+	maxLvl  log.Lvl
+	lock    sync.Mutex
+	records []LogRecord
+	next    int
+	full    bool
+	last    *log.Record
+}
+func newLogBuffer(size int, level string) (*logBuffer, error) {
+	if size <= 0 {
+		return nil, nil
+	}
+	maxLvl := log.LvlInfo
+	if level != "" {
+		lvl, err := log.LvlFromString(level)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log buffer level %q: %v", level, err)
+		}
+		maxLvl = lvl
+	}
+	return &logBuffer{maxLvl: maxLvl, records: make([]LogRecord, size)}, nil
+}
+func (b *logBuffer) Log(r *log.Record) error {
+	if r.Lvl > b.maxLvl {
+		return nil
+	}
+	b.lock.Lock()
+	if b.last == r {
+		b.lock.Unlock()
+		return nil
+	}
+	b.last = r
+	b.lock.Unlock()
+	rec := LogRecord{Time: r.Time, Level: r.Lvl.String(), Message: r.Msg, lvl: r.Lvl}
+	if len(r.Ctx) > 0 {
+		rec.Context = make(map[string]string, len(r.Ctx)/2)
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			rec.Context[fmt.Sprint(r.Ctx[i])] = fmt.Sprint(r.Ctx[i+1])
+		}
+	}
+	b.lock.Lock()
+	b.records[b.next] = rec
+	b.next = (b.next + 1) % len(b.records)
+	if b.next == 0 {
+		b.full = true
+	}
+	b.lock.Unlock()
+	return nil
+}
+type logBufferHook struct {
+	next log.Handler
+	buf  *logBuffer
+}
+func (h *logBufferHook) Log(r *log.Record) error {
+	h.buf.Log(r)
+	return h.next.Log(r)
+}
+func (b *logBuffer) hook(logger log.Logger) func() {
+	hook := &logBufferHook{next: logger.GetHandler(), buf: b}
+	logger.SetHandler(hook)
+	return func() {
+		if logger.GetHandler() == log.Handler(hook) {
+			logger.SetHandler(hook.next)
+		}
+	}
+}
+func (b *logBuffer) recent(maxLvl log.Lvl, limit int) []LogRecord {
+	result := []LogRecord{}
+	if b == nil {
+		return result
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	count := b.next
+	if b.full {
+		count = len(b.records)
+	}
+	for i := 1; i <= count && (limit <= 0 || len(result) < limit); i++ {
+		rec := b.records[(b.next-i+len(b.records))%len(b.records)]
+		if rec.lvl <= maxLvl {
+			result = append(result, rec)
+		}
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+func (n *Node) RecentLogs(level string, limit int) ([]LogRecord, error) {
+	maxLvl := log.LvlTrace
+	if level != "" {
+		lvl, err := log.LvlFromString(level)
+		if err != nil {
+			return nil, err
+		}
+		maxLvl = lvl
+	}
+	return n.logs.recent(maxLvl, limit), nil
+}
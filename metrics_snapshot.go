@@ -0,0 +1,21 @@
+package node
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"github.com/Cryptochain-VON/metrics"
+	"github.com/Cryptochain-VON/metrics/prometheus"
+)
+func (n *Node) MetricsSnapshot() (string, error) {
+	if !metrics.Enabled {
+		return "", ErrMetricsDisabled
+	}
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/debug/metrics/prometheus", nil)
+	prometheus.Handler(metrics.DefaultRegistry).ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		return "", fmt.Errorf("metrics export failed: %s", strings.TrimSpace(rec.Body.String()))
+	}
+	return rec.Body.String(), nil
+}
@@ -0,0 +1,105 @@
+package node
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"github.com/Cryptochain-VON/rpc"
+)
+type memAddr struct{}
+func (memAddr) Network() string { return "mem" }
+func (memAddr) String() string  { return "mem" }
+type memListener struct {
+	conns  chan net.Conn
+	closed chan struct{}
+	once   sync.Once
+}
+func newMemListener() *memListener {
+	return &memListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+func (l *memListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, errListenerClosed
+	}
+}
+func (l *memListener) Close() error {
+	l.once.Do(func() { close(l.closed) })
+	return nil
+}
+func (l *memListener) Addr() net.Addr {
+	return memAddr{}
+}
+func (l *memListener) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, server := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.closed:
+		client.Close()
+		server.Close()
+		return nil, errListenerClosed
+	case <-ctx.Done():
+		client.Close()
+		server.Close()
+		return nil, ctx.Err()
+	}
+}
+type MockTransport struct {
+	Handler  http.Handler
+	RPC      *rpc.Server
+	listener *memListener
+	server   *http.Server
+}
+func NewMockHTTPTransport(conf *Config, apis []rpc.API) (*MockTransport, error) {
+	srv := rpc.NewServer()
+	if err := RegisterApisFromWhitelist(apis, conf.HTTPModules, srv, false); err != nil {
+		return nil, err
+	}
+	auth, _, err := conf.authProvider()
+	if err != nil {
+		return nil, err
+	}
+	stack := conf.httpStackConfig(conf.HTTPCors, conf.HTTPVirtualHosts)
+	stack.pools = newRPCWorkerPools(conf.RPCWorkerPools, conf.RPCWorkerQueue)
+	stack.auth = auth
+	handler := newHTTPHandlerStack(srv, stack)
+	handler = NewWebsocketUpgradeHandler(handler, srv.WebsocketHandler(conf.WSOrigins))
+	return newMockTransport(srv, handler), nil
+}
+func NewMockAdminTransport(conf *Config, apis []rpc.API) (*MockTransport, error) {
+	srv := rpc.NewServer()
+	if err := RegisterApisFromWhitelist(apis, conf.adminModules(), srv, false); err != nil {
+		return nil, err
+	}
+	pools := newRPCWorkerPools(conf.RPCWorkerPools, conf.RPCWorkerQueue)
+	return newMockTransport(srv, newAdminHandlerStack(srv, conf, pools)), nil
+}
+func newMockTransport(srv *rpc.Server, handler http.Handler) *MockTransport {
+	m := &MockTransport{Handler: handler, RPC: srv, listener: newMemListener()}
+	m.server = &http.Server{Handler: handler}
+	go m.server.Serve(m.listener)
+	return m
+}
+func (m *MockTransport) Do(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	m.Handler.ServeHTTP(rec, req)
+	return rec
+}
+func (m *MockTransport) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	return m.listener.DialContext(ctx, network, addr)
+}
+func (m *MockTransport) Client() *http.Client {
+	return &http.Client{Transport: &http.Transport{DialContext: m.DialContext}}
+}
+func (m *MockTransport) URL() string {
+	return "http://" + DefaultHTTPHost
+}
+func (m *MockTransport) Close() {
+	m.server.Close()
+	m.listener.Close()
+	m.RPC.Stop()
+}
@@ -1,6 +1,8 @@
 package node
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"net"
@@ -8,49 +10,127 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"runtime/pprof"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 	"github.com/Cryptochain-VON/accounts"
-	"github.com/Cryptochain-VON/core/rawdb"
-	"github.com/Cryptochain-VON/ethdb"
+	"github.com/Cryptochain-VON/common"
 	"github.com/Cryptochain-VON/event"
 	"github.com/Cryptochain-VON/internal/debug"
 	"github.com/Cryptochain-VON/log"
 	"github.com/Cryptochain-VON/p2p"
+	"github.com/Cryptochain-VON/p2p/enode"
 	"github.com/Cryptochain-VON/rpc"
 	"github.com/prometheus/tsdb/fileutil"
 )
 type Node struct {
+	lastActivity int64
+	subCounters  subscriptionCounters
 	eventmux *event.TypeMux 
 	config   *Config
 	accman   *accounts.Manager
+	accountBackends *hotBackend
+	v4KeyStore      *keyStoreV4
+	accountAudit    *accountAuditor
 	ephemeralKeystore string            
+	keyIndex          *keystoreIndex    
 	instanceDirLock   fileutil.Releaser 
 	serverConfig p2p.Config
+	dial         dialSettings
 	server       *p2p.Server 
-	serviceFuncs []ServiceConstructor     
-	services     map[reflect.Type]Service 
+	p2pDeferred    int32
+	deferredStatic []*enode.Node
+	serviceFuncs []serviceFunc            
+	services     map[serviceKey]Service   
+	serviceOrder []serviceKey             
+	serviceTimes map[serviceKey]time.Time 
 	rpcAPIs       []rpc.API   
+	rpcAPIOrigins []string
 	inprocHandler *rpc.Server 
 	ipcEndpoint string       
 	ipcListener net.Listener 
 	ipcHandler  *rpc.Server  
 	httpEndpoint     string       
 	httpWhitelist    []string     
+	httpCors         []string     
+	httpCorsHandler  *liveCorsHandler
+	httpVhosts       []string     
+	httpTLS          bool         
 	httpListenerAddr net.Addr     
 	httpServer       *http.Server 
 	httpHandler      *rpc.Server  
+	httpUnixServer   *http.Server 
+	httpRoot         http.Handler
 	wsEndpoint     string       
+	wsWhitelist    []string     
+	wsOrigins      []string     
+	wsExposeAll    bool         
+	wsQuota        *wsSubscriptionQuota
+	wsClients      *wsClientRegistry
+	auth           AuthProvider
+	clientCAs      *x509.CertPool
+	rpcPools       *rpcWorkerPools
+	rpcSubs        *rpcSubscriptionConns
+	standby        *standbyStatus
+	prebound       map[string]*preboundEndpoint
+	usage          *usageTracker
+	logs           *logBuffer
+	unhookLogs     func()
+	journal        *requestJournal
+	features       *featureFlags
+	gcSettings     GCSettings
+	gcPrevious     gcPrevious
+	webhooks       *webhookDispatcher
+	ballast        []byte
 	wsListenerAddr net.Addr     
 	wsHTTPServer   *http.Server 
 	wsHandler      *rpc.Server  
+	wsTLSCert      string
+	wsTLSKey       string
+	wsRoot         http.Handler
+	graphqlListenerAddr net.Addr
+	graphqlServer       *http.Server
+	graphqlTLS          bool
+	graphqlLock         sync.Mutex
+	adminListenerAddr net.Addr     
+	adminServer       *http.Server 
+	adminHandler      *rpc.Server  
+	startupBegin  time.Time
+	startupReport []StartupEvent
+	startupNotify *startupNotifier
+	clockMon *clockMonitor
+	scheduler *taskScheduler
+	idleQuit chan struct{}
+	staticDialer *staticDialer
+	peerScores   *peerScoring
+	peerDemand   peerDemand
+	p2pStop      chan struct{}
+	scoreLock    sync.RWMutex
+	identity     *IdentityAttestation
+	peerNotes    *peerAnnotations
+	peerHistory  *peerHistory
+	databases map[*closeTrackingDB]struct{}
+	sharedDBs map[string]*sharedDatabase
+	dbOpenLock sync.Mutex
+	dbHooks   []DatabaseHooks
+	dbLock    sync.Mutex
 	stop chan struct{} 
 	lock sync.RWMutex
 	log log.Logger
+	clock Clock
 }
 func New(conf *Config) (*Node, error) {
 	confCopy := *conf
 	conf = &confCopy
+	if conf.DefaultDataDirOverride != nil && conf.usesDefaultDataDir() {
+		datadir, err := conf.DefaultDataDir()
+		if err != nil {
+			return nil, err
+		}
+		conf.DataDir = datadir
+	}
 	if conf.DataDir != "" {
 		absdatadir, err := filepath.Abs(conf.DataDir)
 		if err != nil {
@@ -67,49 +147,137 @@ func New(conf *Config) (*Node, error) {
 	if strings.HasSuffix(conf.Name, ".ipc") {
 		return nil, errors.New(`Config.Name cannot end in ".ipc"`)
 	}
-	am, ephemeralKeystore, err := makeAccountManager(conf)
+	if err := conf.DecryptValues(); err != nil {
+		return nil, err
+	}
+	if _, err := conf.nodeNameTemplate(); err != nil {
+		return nil, err
+	}
+	if _, err := conf.scheduledTasks(); err != nil {
+		return nil, err
+	}
+	auth, clientCAs, err := conf.authProvider()
+	if err != nil {
+		return nil, err
+	}
+	logs, err := newLogBuffer(conf.LogBufferSize, conf.LogBufferLevel)
 	if err != nil {
 		return nil, err
 	}
 	if conf.Logger == nil {
 		conf.Logger = log.New()
+	} else if logs != nil {
+		conf.Logger = conf.Logger.New()
+		logs.hook(conf.Logger)
+	}
+	clock := conf.clock()
+	journal, err := newRequestJournal(conf, clock, conf.Logger)
+	if err != nil {
+		return nil, err
 	}
-	return &Node{
+	mux := new(event.TypeMux)
+	audit, err := newAccountAuditor(conf, mux)
+	if err != nil {
+		journal.close()
+		return nil, err
+	}
+	var keyIndex *keystoreIndex
+	if _, _, keydir, err := conf.AccountConfig(); err == nil && keydir != "" && conf.KeyStoreIndex && conf.DataDir != "" {
+		keyIndex = newKeystoreIndex(conf.ResolvePath(datadirKeyStoreIndex), keydir, conf.Logger)
+	}
+	am, hot, v4, ephemeralKeystore, err := makeAccountManager(conf, audit, keyIndex)
+	if err != nil {
+		audit.close()
+		journal.close()
+		return nil, err
+	}
+	conf.CheckDeprecations()
+	n := &Node{
+		keyIndex:          keyIndex,
 		accman:            am,
+		accountBackends:   hot,
+		v4KeyStore:        v4,
 		ephemeralKeystore: ephemeralKeystore,
 		config:            conf,
-		serviceFuncs:      []ServiceConstructor{},
+		serviceFuncs:      []serviceFunc{},
 		ipcEndpoint:       conf.IPCEndpoint(),
 		httpEndpoint:      conf.HTTPEndpoint(),
 		wsEndpoint:        conf.WSEndpoint(),
-		eventmux:          new(event.TypeMux),
+		eventmux:          mux,
+		accountAudit:      audit,
+		databases:         make(map[*closeTrackingDB]struct{}),
+		sharedDBs:         make(map[string]*sharedDatabase),
+		dbHooks:           append([]DatabaseHooks(nil), conf.DatabaseHooks...),
+		peerHistory:       newPeerHistory(conf.PeerHistorySize),
+		startupNotify:     newStartupNotifier(conf.StartupProgress),
+		peerNotes:         newPeerAnnotations(conf.ResolvePath(datadirPeerAnnotations), conf.Logger),
+		rpcPools:          newRPCWorkerPools(conf.RPCWorkerPools, conf.RPCWorkerQueue),
+		rpcSubs:           newRPCSubscriptionConns(),
+		wsQuota:           newWSSubscriptionQuota(conf.WSMaxSubscriptionsPerConn, conf.WSMaxSubscriptionsPerClient, conf.WSClientIdentityHeader),
+		wsClients:         newWSClientRegistry(clock, conf.WSClientIdentityHeader),
+		auth:              auth,
+		clientCAs:         clientCAs,
 		log:               conf.Logger,
-	}, nil
+		clock:             clock,
+		dial:              conf.dialSettings(),
+		usage:             newUsageTracker(conf, clock, conf.Logger),
+		logs:              logs,
+		journal:           journal,
+		features:          newFeatureFlags(conf.FeatureFlags),
+	}
+	if logs != nil {
+		n.unhookLogs = logs.hook(log.Root())
+	}
+	return n, nil
 }
 func (n *Node) Close() error {
+	return n.close(context.Background())
+}
+func (n *Node) CloseWithTimeout(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return n.close(ctx)
+}
+func (n *Node) close(ctx context.Context) error {
 	var errs []error
-	if err := n.Stop(); err != nil && err != ErrNodeStopped {
+	n.lock.Lock()
+	err := n.stopContext(ctx)
+	n.lock.Unlock()
+	if err != nil && err != ErrNodeStopped {
 		errs = append(errs, err)
 	}
 	if err := n.accman.Close(); err != nil {
 		errs = append(errs, err)
 	}
+	n.accountBackends.close()
+	if n.unhookLogs != nil {
+		n.unhookLogs()
+	}
+	if err := n.accountAudit.close(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := n.journal.close(); err != nil {
+		errs = append(errs, err)
+	}
 	switch len(errs) {
 	case 0:
 		return nil
 	case 1:
 		return errs[0]
 	default:
-		return fmt.Errorf("%v", errs)
+		return &CloseError{Errors: errs}
 	}
 }
 func (n *Node) Register(constructor ServiceConstructor) error {
+	return n.RegisterInstance("", constructor)
+}
+func (n *Node) RegisterInstance(instance string, constructor ServiceConstructor) error {
 	n.lock.Lock()
 	defer n.lock.Unlock()
 	if n.server != nil {
 		return ErrNodeRunning
 	}
-	n.serviceFuncs = append(n.serviceFuncs, constructor)
+	n.serviceFuncs = append(n.serviceFuncs, serviceFunc{instance: instance, constructor: constructor})
 	return nil
 }
 func (n *Node) Start() error {
@@ -118,74 +286,174 @@ func (n *Node) Start() error {
 	if n.server != nil {
 		return ErrNodeRunning
 	}
+	n.resetStartupReport()
+	var (
+		dbs         = n.openDatabases()
+		running     *p2p.Server
+		staticNodes []*enode.Node
+		services    = make(map[serviceKey]Service)
+		order       []serviceKey
+		started     []serviceKey
+	)
+	fail := func(stage string, err error) error {
+		return n.rollbackStart(&StartError{Stage: stage, Err: err}, dbs, running, order, started, services)
+	}
 	if err := n.openDataDir(); err != nil {
-		return err
+		return fail("datadir", err)
 	}
-	n.serverConfig = n.config.P2P
-	n.serverConfig.PrivateKey = n.config.NodeKey()
-	n.serverConfig.Name = n.config.NodeName()
-	n.serverConfig.Logger = n.log
-	if n.serverConfig.StaticNodes == nil {
-		n.serverConfig.StaticNodes = n.config.StaticNodes()
+	n.reportStartup(StartupDatadirOpened, n.config.instanceDir())
+	if err := n.applyGCSettings(n.config.gcSettings()); err != nil {
+		return fail("gc", err)
 	}
-	if n.serverConfig.TrustedNodes == nil {
-		n.serverConfig.TrustedNodes = n.config.TrustedNodes()
+	defer n.releasePrebound()
+	if err := n.prebindEndpoints(); err != nil {
+		return fail("prebind", err)
 	}
-	if n.serverConfig.NodeDatabase == "" {
-		n.serverConfig.NodeDatabase = n.config.NodeDB()
+	n.serverConfig = n.makeServerConfig()
+	if n.config.Identity != nil {
+		identity, err := signIdentity(*n.config.Identity, n.serverConfig.PrivateKey)
+		if err != nil {
+			return fail("identity", err)
+		}
+		n.identity = identity
 	}
-	running := &p2p.Server{Config: n.serverConfig}
+	running, staticNodes = n.newServer(n.serverConfig)
 	n.log.Info("Starting peer-to-peer node", "instance", n.serverConfig.Name)
-	services := make(map[reflect.Type]Service)
-	for _, constructor := range n.serviceFuncs {
+	for _, sf := range n.serviceFuncs {
 		ctx := &ServiceContext{
 			Config:         *n.config,
-			services:       make(map[reflect.Type]Service),
+			node:           n,
+			owner:          new(serviceKey),
+			services:       make(map[serviceKey]Service),
 			EventMux:       n.eventmux,
 			AccountManager: n.accman,
 		}
 		for kind, s := range services { 
 			ctx.services[kind] = s
 		}
-		service, err := constructor(ctx)
+		service, err := sf.constructor(ctx)
 		if err != nil {
-			return err
+			return fail("construct", &ServiceError{Instance: sf.instance, Op: "construct", Err: err})
 		}
-		kind := reflect.TypeOf(service)
+		kind := serviceKey{reflect.TypeOf(service), sf.instance}
+		*ctx.owner = kind
 		if _, exists := services[kind]; exists {
-			return &DuplicateServiceError{Kind: kind}
+			return fail("construct", &DuplicateServiceError{Kind: kind.kind, Instance: kind.instance})
 		}
 		services[kind] = service
+		order = append(order, kind)
+		n.reportStartup(StartupServiceCreated, kind.String())
 	}
-	for _, service := range services {
-		running.Protocols = append(running.Protocols, service.Protocols()...)
+	for _, kind := range order {
+		running.Protocols = append(running.Protocols, services[kind].Protocols()...)
 	}
-	if err := running.Start(); err != nil {
-		return convertFileLockError(err)
+	if n.config.DeferP2P {
+		n.log.Info("Deferring peer-to-peer networking until explicitly started")
+	} else {
+		if err := running.Start(); err != nil {
+			return fail("p2p", convertFileLockError(err))
+		}
+		n.reportStartup(StartupP2PListening, running.ListenAddr)
 	}
-	var started []reflect.Type
-	for kind, service := range services {
-		if err := service.Start(running); err != nil {
-			for _, kind := range started {
-				services[kind].Stop()
-			}
-			running.Stop()
-			return err
+	startTimes := make(map[serviceKey]time.Time)
+	serviceServer := running
+	if n.config.DeferP2P {
+		serviceServer = nil
+	}
+	for _, kind := range order {
+		err := faults.serviceStart(kind.String())
+		if err == nil {
+			err = services[kind].Start(serviceServer)
+		}
+		if err != nil {
+			return fail("start", &ServiceError{Kind: kind.kind, Instance: kind.instance, Op: "start", Err: err})
 		}
+		n.reportStartup(StartupServiceStarted, kind.String())
+		startTimes[kind] = n.clock.Now()
 		started = append(started, kind)
 	}
-	if err := n.startRPC(services); err != nil {
-		for _, service := range services {
-			service.Stop()
-		}
-		running.Stop()
-		return err
+	if err := n.startRPC(services, order); err != nil {
+		return fail("rpc", err)
 	}
 	n.services = services
+	n.serviceOrder = started
+	n.serviceTimes = startTimes
 	n.server = running
+	n.p2pStop = make(chan struct{})
 	n.stop = make(chan struct{})
+	n.peerHistory.start(running, n.clock)
+	n.webhooks = newWebhookDispatcher(n.config.Webhooks, running.Self().ID().String(), n.clock, n.log)
+	if n.webhooks != nil {
+		n.webhooks.start(running)
+	}
+	n.usage.start()
+	if n.config.DeferP2P {
+		atomic.StoreInt32(&n.p2pDeferred, 1)
+		n.deferredStatic = staticNodes
+		if n.config.P2PReadyCheck != nil {
+			go n.waitP2PReady(n.config.P2PReadyCheck, n.stop)
+		}
+	} else {
+		n.startPeerManagement(running, staticNodes)
+	}
+	if len(n.config.NTPServers) > 0 {
+		threshold, interval := n.config.ntpSettings()
+		n.clockMon = newClockMonitor(n.config.NTPServers, threshold, interval, n.clock, n.log)
+		n.clockMon.start()
+	}
+	if n.config.IdleTimeout > 0 {
+		n.startIdleMonitor(n.config.IdleTimeout)
+	}
+	tasks, _ := n.config.scheduledTasks()
+	n.scheduler = newTaskScheduler(n, tasks)
+	n.scheduler.start()
+	n.updateEndpointsFile()
+	n.reportStartup(StartupComplete, "")
+	n.webhooks.emit(WebhookNodeStarted, n.endpointsInfo())
 	return nil
 }
+func (n *Node) makeServerConfig() p2p.Config {
+	cfg := n.config.P2P
+	cfg.PrivateKey = n.config.NodeKey()
+	cfg.Name = n.config.NodeName()
+	cfg.Logger = n.log
+	if cfg.StaticNodes == nil {
+		cfg.StaticNodes = n.config.StaticNodes()
+	}
+	if cfg.TrustedNodes == nil {
+		cfg.TrustedNodes = n.config.TrustedNodes()
+	}
+	if cfg.NodeDatabase == "" && !n.config.NoP2P {
+		cfg.NodeDatabase = n.config.NodeDB()
+	}
+	if n.config.NoP2P {
+		cfg.ListenAddr = ""
+		cfg.NAT = nil
+		cfg.NoDiscovery = true
+		cfg.DiscoveryV5 = false
+		cfg.NoDial = true
+		cfg.MaxPeers = 0
+		cfg.StaticNodes = nil
+		cfg.BootstrapNodes = nil
+	}
+	if n.config.PeerScoring || n.config.PeerScorer != nil {
+		cfg.EnableMsgEvents = true
+		cfg.Logger = n.peerDemand.hook(n.log)
+	}
+	n.dial.apply(&cfg)
+	return cfg
+}
+func (n *Node) newServer(cfg p2p.Config) (*p2p.Server, []*enode.Node) {
+	running := &p2p.Server{Config: cfg}
+	var staticNodes []*enode.Node
+	if n.dial.backoff > 0 {
+		staticNodes, running.StaticNodes = running.StaticNodes, nil
+	}
+	return running, staticNodes
+}
+func (n *Node) Clock() Clock {
+	return n.clock
+}
 func (n *Node) Config() *Config {
 	return n.config
 }
@@ -201,13 +469,37 @@ func (n *Node) openDataDir() error {
 	if err != nil {
 		return convertFileLockError(err)
 	}
+	if _, err := checkDatadirStamp(instdir, n.config.Version, n.clock.Now()); err != nil {
+		release.Release()
+		return err
+	}
 	n.instanceDirLock = release
 	return nil
 }
-func (n *Node) startRPC(services map[reflect.Type]Service) error {
+func (n *Node) releaseDataDir() {
+	if n.instanceDirLock == nil {
+		return
+	}
+	if err := n.instanceDirLock.Release(); err != nil {
+		n.log.Error("Can't release datadir lock", "err", err)
+	}
+	n.instanceDirLock = nil
+}
+func (n *Node) startRPC(services map[serviceKey]Service, order []serviceKey) error {
 	apis := n.apis()
-	for _, service := range services {
-		apis = append(apis, service.APIs()...)
+	origins := make([]string, len(apis))
+	for i := range origins {
+		origins[i] = nodeAPIOrigin
+	}
+	for _, kind := range order {
+		for _, api := range services[kind].APIs() {
+			apis = append(apis, api)
+			origins = append(origins, kind.String())
+		}
+	}
+	for _, api := range n.keyStoreAPIs(apis) {
+		apis = append(apis, api)
+		origins = append(origins, nodeAPIOrigin)
 	}
 	if err := n.startInProc(apis); err != nil {
 		return err
@@ -216,22 +508,88 @@ func (n *Node) startRPC(services map[reflect.Type]Service) error {
 		n.stopInProc()
 		return err
 	}
+	if n.ipcListener != nil {
+		n.reportStartup(StartupEndpointBound, "ipc "+n.ipcEndpoint)
+	}
 	if err := n.startHTTP(n.httpEndpoint, apis, n.config.HTTPModules, n.config.HTTPCors, n.config.HTTPVirtualHosts, n.config.HTTPTimeouts, n.config.WSOrigins); err != nil {
 		n.stopIPC()
 		n.stopInProc()
 		return err
 	}
-	if n.httpEndpoint != n.wsEndpoint {
+	if n.httpListenerAddr != nil {
+		n.reportStartup(StartupEndpointBound, "http "+n.httpListenerAddr.String())
+	}
+	if !n.wsSharesHTTP() {
 		if err := n.startWS(n.wsEndpoint, apis, n.config.WSModules, n.config.WSOrigins, n.config.WSExposeAll); err != nil {
 			n.stopHTTP()
 			n.stopIPC()
 			n.stopInProc()
 			return err
 		}
+		if n.wsListenerAddr != nil {
+			n.reportStartup(StartupEndpointBound, "ws "+n.wsListenerAddr.String())
+		}
+	}
+	if err := n.startAdmin(apis); err != nil {
+		n.stopWS()
+		n.stopHTTP()
+		n.stopIPC()
+		n.stopInProc()
+		return err
 	}
 	n.rpcAPIs = apis
+	n.rpcAPIOrigins = origins
 	return nil
 }
+func (n *Node) publicAPIs(apis []rpc.API) []rpc.API {
+	if n.config.AdminEndpoint() == "" {
+		return apis
+	}
+	privileged := make(map[string]bool)
+	for _, module := range n.config.adminModules() {
+		privileged[module] = true
+	}
+	var public []rpc.API
+	for _, api := range apis {
+		if !privileged[api.Namespace] {
+			public = append(public, api)
+		}
+	}
+	return public
+}
+func (n *Node) startAdmin(apis []rpc.API) error {
+	endpoint := n.config.AdminEndpoint()
+	if endpoint == "" {
+		return nil
+	}
+	srv := rpc.NewServer()
+	if err := RegisterApisFromWhitelist(apis, n.config.adminModules(), srv, false); err != nil {
+		return err
+	}
+	handler := newAdminHandlerStack(srv, n.config, n.rpcPools)
+	httpServer, addr, err := startHTTPEndpoint(endpoint, n.config.HTTPTimeouts, nil, 0, handler)
+	if err != nil {
+		srv.Stop()
+		return err
+	}
+	n.log.Info("Admin endpoint opened", "addr", addr, "modules", strings.Join(n.config.adminModules(), ","), "auth", n.config.AdminAuthToken != "")
+	n.reportStartup(StartupEndpointBound, "admin "+addr.String())
+	n.adminListenerAddr = addr
+	n.adminServer = httpServer
+	n.adminHandler = srv
+	return nil
+}
+func (n *Node) stopAdmin(ctx context.Context) {
+	if n.adminServer != nil {
+		n.shutdownServer(ctx, n.adminServer, "admin")
+		n.adminServer = nil
+		n.log.Info("Admin endpoint closed", "addr", n.adminListenerAddr)
+	}
+	if n.adminHandler != nil {
+		n.adminHandler.Stop()
+		n.adminHandler = nil
+	}
+}
 func (n *Node) startInProc(apis []rpc.API) error {
 	handler := rpc.NewServer()
 	for _, api := range apis {
@@ -253,9 +611,15 @@ func (n *Node) startIPC(apis []rpc.API) error {
 	if n.ipcEndpoint == "" {
 		return nil 
 	}
-	listener, handler, err := rpc.StartIPCEndpoint(n.ipcEndpoint, apis)
+	if len(n.config.IPCModules) > 0 {
+		if err := checkModules(n.config.IPCModules, apis); err != nil {
+			return err
+		}
+		apis = filterAPIs(apis, n.config.IPCModules)
+	}
+	listener, handler, err := startIPCEndpoint(n.ipcEndpoint, apis, n.config.IPCMaxConnections, rpcTapHooks{pools: n.rpcPools, usage: n.usage, subs: n.rpcSubs, journal: n.journal, limit: n.config.IPCMaxRequestBytes})
 	if err != nil {
-		return err
+		return convertListenError(n.ipcEndpoint, err)
 	}
 	n.ipcListener = listener
 	n.ipcHandler = handler
@@ -278,98 +642,377 @@ func (n *Node) startHTTP(endpoint string, apis []rpc.API, modules []string, cors
 		return nil
 	}
 	srv := rpc.NewServer()
-	err := RegisterApisFromWhitelist(apis, modules, srv, false)
+	err := RegisterApisFromWhitelist(n.publicAPIs(apis), modules, srv, false)
 	if err != nil {
 		return err
 	}
-	handler := NewHTTPHandlerStack(srv, cors, vhosts)
-	if n.httpEndpoint == n.wsEndpoint {
-		handler = NewWebsocketUpgradeHandler(handler, srv.WebsocketHandler(wsOrigins))
-	}
-	httpServer, addr, err := StartHTTPEndpoint(endpoint, timeouts, handler)
+	tlsConfig, err := n.serverTLSConfig(endpoint, n.config.HTTPTLSCert, n.config.HTTPTLSKey)
 	if err != nil {
 		return err
 	}
+	liveCors := newLiveCorsHandler(cors)
+	stack := n.config.httpStackConfig(cors, vhosts)
+	stack.liveCors, stack.pools, stack.usage, stack.journal, stack.auth = liveCors, n.rpcPools, n.usage, n.journal, n.auth
+	handler := newActivityHandler(faults.wrapHTTP(n.httpWebsocketHandler(srv, stack, wsOrigins)), n.touchActivity)
+	var (
+		httpServer *http.Server
+		addr       net.Addr
+	)
+	if pb := n.takePrebound("http", endpoint); pb != nil {
+		pb.handler.activate(handler)
+		httpServer, addr = pb.server, pb.addr
+	} else if httpServer, addr, err = startHTTPEndpoint(endpoint, timeouts, tlsConfig, n.config.RPCMaxConnections, handler); err != nil {
+		return err
+	}
 	n.log.Info("HTTP endpoint opened", "url", fmt.Sprintf("http:
 		"cors", strings.Join(cors, ","),
 		"vhosts", strings.Join(vhosts, ","))
-	if n.httpEndpoint == n.wsEndpoint {
+	if n.wsSharesHTTP() {
 		n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws:
 	}
+	if path := n.config.HTTPUnixSocketEndpoint(); path != "" {
+		unixStack := n.config.httpStackConfig(nil, []string{"*"})
+		unixStack.metrics, unixStack.pools, unixStack.usage, unixStack.journal, unixStack.auth = httpUnixMetrics, n.rpcPools, n.usage, n.journal, n.auth
+		unixHandler := newActivityHandler(faults.wrapHTTP(n.httpWebsocketHandler(srv, unixStack, wsOrigins)), n.touchActivity)
+		unixServer, err := startHTTPUnixEndpoint(path, timeouts, unixHandler)
+		if err != nil {
+			httpServer.Shutdown(context.Background())
+			srv.Stop()
+			return err
+		}
+		n.log.Info("HTTP unix socket opened", "path", path)
+		n.httpUnixServer = unixServer
+	}
 	n.httpEndpoint = endpoint
+	n.httpWhitelist = modules
+	n.httpCors = cors
+	n.httpCorsHandler = liveCors
+	n.httpVhosts = vhosts
+	n.httpTLS = tlsConfig != nil
 	n.httpListenerAddr = addr
 	n.httpServer = httpServer
 	n.httpHandler = srv
+	n.httpRoot = handler
 	return nil
 }
+func (n *Node) httpWebsocketHandler(srv *rpc.Server, stack httpStackConfig, wsOrigins []string) http.Handler {
+	handler := newHTTPHandlerStack(srv, stack)
+	if !n.wsSharesHTTP() {
+		return handler
+	}
+	wsHandler := newStackTimingHandler(stack.metrics, "", newAuthHandler(n.auth, n.websocketHandler(srv, wsOrigins), n.config.httpErrorWriter(), false))
+	return newStackTimingHandler(stack.metrics, "ws-upgrade", NewWebsocketUpgradeHandler(handler, wsHandler))
+}
+func (n *Node) wsSharesHTTP() bool {
+	if n.httpEndpoint != n.wsEndpoint {
+		return false
+	}
+	_, port, err := net.SplitHostPort(n.wsEndpoint)
+	return err != nil || port != "0"
+}
 func (n *Node) stopHTTP() {
+	n.stopHTTPContext(context.Background())
+}
+func (n *Node) stopHTTPContext(ctx context.Context) {
+	if n.httpUnixServer != nil {
+		n.shutdownServer(ctx, n.httpUnixServer, "HTTP unix socket")
+		n.httpUnixServer = nil
+		n.log.Info("HTTP unix socket closed", "path", n.config.HTTPUnixSocketEndpoint())
+	}
 	if n.httpServer != nil {
-		n.httpServer.Shutdown(context.Background())
+		n.shutdownServer(ctx, n.httpServer, "HTTP")
 		n.log.Info("HTTP endpoint closed", "url", fmt.Sprintf("http:
 	}
 	if n.httpHandler != nil {
 		n.httpHandler.Stop()
 		n.httpHandler = nil
 	}
+	n.httpRoot = nil
+	n.httpCorsHandler = nil
+}
+func (n *Node) shutdownServer(ctx context.Context, srv *http.Server, name string) {
+	if err := srv.Shutdown(ctx); err != nil {
+		n.log.Warn("Endpoint shutdown stalled, forcing close", "endpoint", name, "err", err)
+		srv.Close()
+	}
 }
 func (n *Node) startWS(endpoint string, apis []rpc.API, modules []string, wsOrigins []string, exposeAll bool) error {
 	if endpoint == "" {
 		return nil
 	}
 	srv := rpc.NewServer()
-	handler := srv.WebsocketHandler(wsOrigins)
-	err := RegisterApisFromWhitelist(apis, modules, srv, exposeAll)
+	handler := newAuthHandler(n.auth, n.websocketHandler(srv, wsOrigins), n.config.httpErrorWriter(), false)
+	err := RegisterApisFromWhitelist(n.publicAPIs(apis), modules, srv, exposeAll)
 	if err != nil {
 		return err
 	}
-	httpServer, addr, err := startWSEndpoint(endpoint, handler)
-	if err != nil {
+	var (
+		httpServer *http.Server
+		addr       net.Addr
+	)
+	handler = newActivityHandler(handler, n.touchActivity)
+	if pb := n.takePrebound("ws", endpoint); pb != nil {
+		pb.handler.activate(handler)
+		httpServer, addr = pb.server, pb.addr
+	} else if httpServer, addr, err = startWSEndpoint(endpoint, n.config.WSTimeouts, n.config.RPCMaxConnections, handler); err != nil {
 		return err
 	}
 	n.log.Info("WebSocket endpoint opened", "url", fmt.Sprintf("ws:
 	n.wsEndpoint = endpoint
+	n.wsWhitelist = modules
+	n.wsOrigins = wsOrigins
+	n.wsExposeAll = exposeAll
 	n.wsListenerAddr = addr
 	n.wsHTTPServer = httpServer
 	n.wsHandler = srv
+	n.wsRoot = handler
+	return nil
+}
+func (n *Node) websocketHandler(srv *rpc.Server, origins []string) http.Handler {
+	handler := faults.wrapWS(n.wsClients.wrap(newWSRPCHandler(srv, rpcTapHooks{quota: n.wsQuota, pools: n.rpcPools, usage: n.usage, subs: n.rpcSubs, journal: n.journal, limit: n.config.RPCMaxRequestBytes})))
+	return newWSOriginHandler(handler, origins, n.config.WSOriginChecker, n.config.httpErrorWriter())
+}
+type HTTPConfig struct {
+	Host         string
+	Port         int
+	Cors         []string
+	VirtualHosts []string
+	Modules      []string
+	Timeouts     *rpc.HTTPTimeouts
+}
+type WSConfig struct {
+	Host      string
+	Port      int
+	Origins   []string
+	Modules   []string
+	ExposeAll bool
+}
+func (n *Node) StartHTTP(cfg HTTPConfig) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.server == nil {
+		return ErrNodeStopped
+	}
+	return n.startHTTPConfig(cfg)
+}
+func (n *Node) startHTTPConfig(cfg HTTPConfig) error {
+	if n.httpHandler != nil {
+		return fmt.Errorf("HTTP RPC already running on %s", n.httpEndpoint)
+	}
+	if cfg.Host == "" {
+		cfg.Host = DefaultHTTPHost
+		if n.config.HTTPHost != "" {
+			cfg.Host = n.config.HTTPHost
+		}
+	}
+	timeouts := n.config.HTTPTimeouts
+	if cfg.Timeouts != nil {
+		timeouts = *cfg.Timeouts
+	}
+	if err := n.startHTTP(fmt.Sprintf("%s:%d", cfg.Host, cfg.Port), n.rpcAPIs, cfg.Modules, cfg.Cors, cfg.VirtualHosts, timeouts, n.config.WSOrigins); err != nil {
+		return err
+	}
+	n.updateEndpointsFile()
+	return nil
+}
+func (n *Node) StopHTTP() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.stopHTTPChecked()
+}
+func (n *Node) stopHTTPChecked() error {
+	if n.httpHandler == nil {
+		return fmt.Errorf("HTTP RPC not running")
+	}
+	n.stopHTTP()
+	n.updateEndpointsFile()
+	return nil
+}
+func (n *Node) StartWS(cfg WSConfig) error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.server == nil {
+		return ErrNodeStopped
+	}
+	return n.startWSConfig(cfg)
+}
+func (n *Node) startWSConfig(cfg WSConfig) error {
+	if n.wsHandler != nil {
+		return fmt.Errorf("WebSocket RPC already running on %s", n.wsEndpoint)
+	}
+	if cfg.Host == "" {
+		cfg.Host = DefaultWSHost
+		if n.config.WSHost != "" {
+			cfg.Host = n.config.WSHost
+		}
+	}
+	if err := n.startWS(fmt.Sprintf("%s:%d", cfg.Host, cfg.Port), n.rpcAPIs, cfg.Modules, cfg.Origins, cfg.ExposeAll); err != nil {
+		return err
+	}
+	n.updateEndpointsFile()
+	return nil
+}
+func (n *Node) StopWS() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	return n.stopWSChecked()
+}
+func (n *Node) stopWSChecked() error {
+	if n.wsHandler == nil {
+		return fmt.Errorf("WebSocket RPC not running")
+	}
+	n.stopWS()
+	n.updateEndpointsFile()
 	return nil
 }
+func (n *Node) AddAllowedOrigin(origin string) ([]string, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.httpCorsHandler == nil {
+		return nil, fmt.Errorf("HTTP RPC not running")
+	}
+	origin = strings.TrimSpace(origin)
+	for _, o := range n.httpCors {
+		if strings.EqualFold(o, origin) {
+			return n.httpCors, nil
+		}
+	}
+	return n.setAllowedOrigins(append(append([]string{}, n.httpCors...), origin)), nil
+}
+func (n *Node) RemoveAllowedOrigin(origin string) ([]string, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.httpCorsHandler == nil {
+		return nil, fmt.Errorf("HTTP RPC not running")
+	}
+	var origins []string
+	for _, o := range n.httpCors {
+		if !strings.EqualFold(o, strings.TrimSpace(origin)) {
+			origins = append(origins, o)
+		}
+	}
+	if len(origins) == len(n.httpCors) {
+		return nil, fmt.Errorf("origin %q not allowed", origin)
+	}
+	return n.setAllowedOrigins(origins), nil
+}
+func (n *Node) setAllowedOrigins(origins []string) []string {
+	n.httpCorsHandler.setOrigins(origins)
+	n.httpCors = origins
+	n.log.Info("HTTP CORS origins updated", "cors", strings.Join(origins, ","))
+	return origins
+}
+func (n *Node) restartEndpoint(endpoint string, restore func()) error {
+	var start func() error
+	switch {
+	case endpoint == "http" && n.httpHandler != nil:
+		addr := boundEndpoint(n.httpEndpoint, n.httpListenerAddr)
+		whitelist, cors, vhosts := n.httpWhitelist, n.httpCors, n.httpVhosts
+		n.stopHTTP()
+		n.log.Info("Restarting HTTP endpoint with new timeouts", "addr", addr)
+		start = func() error {
+			return n.startHTTP(addr, n.rpcAPIs, whitelist, cors, vhosts, n.config.HTTPTimeouts, n.config.WSOrigins)
+		}
+	case endpoint == "ws" && n.wsHandler != nil:
+		addr := boundEndpoint(n.wsEndpoint, n.wsListenerAddr)
+		whitelist, origins, exposeAll := n.wsWhitelist, n.wsOrigins, n.wsExposeAll
+		n.stopWS()
+		n.log.Info("Restarting WebSocket endpoint with new timeouts", "addr", addr)
+		start = func() error {
+			return n.startWS(addr, n.rpcAPIs, whitelist, origins, exposeAll)
+		}
+	default:
+		return nil
+	}
+	err := start()
+	if err != nil {
+		restore()
+		if rerr := start(); rerr != nil {
+			n.log.Error("Failed to restore endpoint", "endpoint", endpoint, "err", rerr)
+		}
+	}
+	n.updateEndpointsFile()
+	return err
+}
 func (n *Node) stopWS() {
+	n.stopWSContext(context.Background())
+}
+func (n *Node) stopWSContext(ctx context.Context) {
 	if n.wsHTTPServer != nil {
-		n.wsHTTPServer.Shutdown(context.Background())
+		n.shutdownServer(ctx, n.wsHTTPServer, "WebSocket")
 		n.log.Info("WebSocket endpoint closed", "url", fmt.Sprintf("ws:
 	}
 	if n.wsHandler != nil {
 		n.wsHandler.Stop()
 		n.wsHandler = nil
 	}
+	n.wsRoot = nil
+	n.wsTLSCert, n.wsTLSKey = "", ""
 }
 func (n *Node) Stop() error {
 	n.lock.Lock()
 	defer n.lock.Unlock()
+	return n.stopContext(context.Background())
+}
+func (n *Node) stopContext(ctx context.Context) error {
 	if n.server == nil {
 		return ErrNodeStopped
 	}
-	n.stopWS()
-	n.stopHTTP()
+	if n.clockMon != nil {
+		n.clockMon.stop()
+		n.clockMon = nil
+	}
+	n.stopIdleMonitor()
+	n.scheduler.stop()
+	n.scheduler = nil
+	n.webhooks.emit(WebhookNodeStopping, nil)
+	n.webhooks.stop()
+	n.webhooks = nil
+	n.peerHistory.stop()
+	n.usage.stop()
+	n.restoreGCSettings()
+	n.stopPeerManagement()
+	n.drainServices(ctx)
+	n.checkpointDatabases()
+	n.stopAdmin(ctx)
+	n.stopWSContext(ctx)
+	n.stopHTTPContext(ctx)
+	n.stopGraphQL()
 	n.stopIPC()
+	n.removeEndpointsFile()
 	n.rpcAPIs = nil
+	n.rpcAPIOrigins = nil
 	failure := &StopError{
-		Services: make(map[reflect.Type]error),
-	}
-	for kind, service := range n.services {
-		if err := service.Stop(); err != nil {
-			failure.Services[kind] = err
+		Services: make(map[ServiceID]error),
+	}
+	stopErrs := n.stopServicesContext(ctx, n.serviceOrder, n.services)
+	stalled := make(map[serviceKey]bool)
+	for i := len(n.serviceOrder) - 1; i >= 0; i-- {
+		kind := n.serviceOrder[i]
+		err, ok := stopErrs[kind]
+		if !ok {
+			continue
 		}
+		failure.Services[ServiceID{kind.kind, kind.instance}] = err
+		failure.Failures = append(failure.Failures, &ServiceError{Kind: kind.kind, Instance: kind.instance, Op: "stop", Err: err})
+		if err == ErrServiceStopTimeout {
+			failure.Stalled = append(failure.Stalled, ServiceID{kind.kind, kind.instance})
+			stalled[kind] = true
+		}
+	}
+	if ctx.Err() != nil {
+		n.log.Warn("Shutdown deadline exceeded, force-closing databases")
+		n.closeDatabases(stalled)
 	}
 	n.server.Stop()
+	close(n.p2pStop)
+	atomic.StoreInt32(&n.p2pDeferred, 0)
+	n.deferredStatic = nil
 	n.services = nil
+	n.serviceOrder = nil
+	n.serviceTimes = nil
 	n.server = nil
-	if n.instanceDirLock != nil {
-		if err := n.instanceDirLock.Release(); err != nil {
-			n.log.Error("Can't release datadir lock", "err", err)
-		}
-		n.instanceDirLock = nil
-	}
+	n.releaseDataDir()
 	close(n.stop)
 	var keystoreErr error
 	if n.ephemeralKeystore != "" {
@@ -383,6 +1026,76 @@ func (n *Node) Stop() error {
 	}
 	return nil
 }
+func (n *Node) drainServices(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, n.config.drainTimeout())
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	n.eventmux.Post(NodeDrainingEvent{Deadline: deadline})
+	for i := len(n.serviceOrder) - 1; i >= 0; i-- {
+		kind := n.serviceOrder[i]
+		drainer, ok := n.services[kind].(Drainer)
+		if !ok {
+			continue
+		}
+		n.log.Debug("Draining service", "service", kind)
+		if err := drainer.Drain(ctx); err != nil {
+			n.log.Warn("Service failed to drain", "service", kind, "err", err)
+		}
+	}
+}
+func (n *Node) stopServices(order []serviceKey, services map[serviceKey]Service) map[serviceKey]error {
+	return n.stopServicesContext(context.Background(), order, services)
+}
+func (n *Node) stopServicesContext(ctx context.Context, order []serviceKey, services map[serviceKey]Service) map[serviceKey]error {
+	failures := make(map[serviceKey]error)
+	for i := len(order) - 1; i >= 0; i-- {
+		kind := order[i]
+		n.log.Debug("Stopping service", "service", kind, "remaining", i)
+		if err := stopService(ctx, services[kind], n.config.serviceStopTimeout(), n.clock); err != nil {
+			n.log.Warn("Service failed to stop", "service", kind, "err", err)
+			if err == ErrServiceStopTimeout {
+				n.logServiceStacks(kind)
+			}
+			failures[kind] = err
+			continue
+		}
+		n.log.Debug("Service stopped", "service", kind)
+	}
+	return failures
+}
+func stopService(ctx context.Context, service Service, timeout time.Duration, clock Clock) error {
+	errc := make(chan error, 1)
+	go func() { errc <- service.Stop() }()
+	timer := clock.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case err := <-errc:
+		return err
+	case <-timer.C():
+		return ErrServiceStopTimeout
+	case <-ctx.Done():
+		return ErrServiceStopTimeout
+	}
+}
+func (n *Node) logServiceStacks(kind serviceKey) {
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 2)
+	pkg := kind.kind.PkgPath()
+	if kind.kind.Kind() == reflect.Ptr {
+		pkg = kind.kind.Elem().PkgPath()
+	}
+	var stacks []string
+	for _, stack := range strings.Split(buf.String(), "\n\n") {
+		if pkg != "" && strings.Contains(stack, pkg+".") {
+			stacks = append(stacks, stack)
+		}
+	}
+	if len(stacks) == 0 {
+		n.log.Warn("Stalled service has no identifiable goroutines, dumping all", "service", kind, "stacks", buf.String())
+		return
+	}
+	n.log.Warn("Goroutines of stalled service", "service", kind, "count", len(stacks), "stacks", strings.Join(stacks, "\n\n"))
+}
 func (n *Node) Wait() {
 	n.lock.RLock()
 	if n.server == nil {
@@ -421,21 +1134,66 @@ func (n *Node) RPCHandler() (*rpc.Server, error) {
 func (n *Node) Server() *p2p.Server {
 	n.lock.RLock()
 	defer n.lock.RUnlock()
+	if n.p2pPending() {
+		return nil
+	}
 	return n.server
 }
 func (n *Node) Service(service interface{}) error {
+	return n.ServiceInstance("", service)
+}
+func (n *Node) ServiceInstance(instance string, service interface{}) error {
 	n.lock.RLock()
 	defer n.lock.RUnlock()
 	if n.server == nil {
 		return ErrNodeStopped
 	}
 	element := reflect.ValueOf(service).Elem()
-	if running, ok := n.services[element.Type()]; ok {
+	if running, ok := n.services[serviceKey{element.Type(), instance}]; ok {
 		element.Set(reflect.ValueOf(running))
 		return nil
 	}
 	return ErrServiceUnknown
 }
+func (n *Node) Services() ([]ServiceInfo, error) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	if n.server == nil {
+		return nil, ErrNodeStopped
+	}
+	infos := make([]ServiceInfo, 0, len(n.serviceOrder))
+	for _, kind := range n.serviceOrder {
+		infos = append(infos, newServiceInfo(kind, n.services[kind], n.serviceTimes[kind]))
+	}
+	return infos, nil
+}
+type HealthReport struct {
+	Healthy  bool          `json:"healthy"`
+	Services []ServiceInfo `json:"services"`
+	Clock    *ClockStatus  `json:"clock,omitempty"`
+}
+func (n *Node) Health() (*HealthReport, error) {
+	services, err := n.Services()
+	if err != nil {
+		return nil, err
+	}
+	report := &HealthReport{Healthy: true, Services: services}
+	for _, service := range services {
+		if service.Health == ServiceUnhealthy {
+			report.Healthy = false
+		}
+	}
+	n.lock.RLock()
+	if n.clockMon != nil {
+		status := n.clockMon.Status()
+		report.Clock = &status
+		if status.State == ClockSkewed {
+			report.Healthy = false
+		}
+	}
+	n.lock.RUnlock()
+	return report, nil
+}
 func (n *Node) DataDir() string {
 	return n.config.DataDir
 }
@@ -445,6 +1203,18 @@ func (n *Node) InstanceDir() string {
 func (n *Node) AccountManager() *accounts.Manager {
 	return n.accman
 }
+func (n *Node) KeyStoreAccounts() ([]common.Address, error) {
+	if n.keyIndex == nil {
+		return nil, ErrKeyStoreIndexOff
+	}
+	return n.keyIndex.accounts()
+}
+func (n *Node) KeyStoreFiles(addr common.Address) ([]string, error) {
+	if n.keyIndex == nil {
+		return nil, ErrKeyStoreIndexOff
+	}
+	return n.keyIndex.lookup(addr)
+}
 func (n *Node) IPCEndpoint() string {
 	return n.ipcEndpoint
 }
@@ -467,30 +1237,11 @@ func (n *Node) WSEndpoint() string {
 func (n *Node) EventMux() *event.TypeMux {
 	return n.eventmux
 }
-func (n *Node) OpenDatabase(name string, cache, handles int, namespace string) (ethdb.Database, error) {
-	if n.config.DataDir == "" {
-		return rawdb.NewMemoryDatabase(), nil
-	}
-	return rawdb.NewLevelDBDatabase(n.config.ResolvePath(name), cache, handles, namespace)
-}
-func (n *Node) OpenDatabaseWithFreezer(name string, cache, handles int, freezer, namespace string) (ethdb.Database, error) {
-	if n.config.DataDir == "" {
-		return rawdb.NewMemoryDatabase(), nil
-	}
-	root := n.config.ResolvePath(name)
-	switch {
-	case freezer == "":
-		freezer = filepath.Join(root, "ancient")
-	case !filepath.IsAbs(freezer):
-		freezer = n.config.ResolvePath(freezer)
-	}
-	return rawdb.NewLevelDBDatabaseWithFreezer(root, cache, handles, freezer, namespace)
-}
 func (n *Node) ResolvePath(x string) string {
 	return n.config.ResolvePath(x)
 }
 func (n *Node) apis() []rpc.API {
-	return []rpc.API{
+	return append([]rpc.API{
 		{
 			Namespace: "admin",
 			Version:   "1.0",
@@ -510,11 +1261,11 @@ func (n *Node) apis() []rpc.API {
 			Service:   NewPublicWeb3API(n),
 			Public:    true,
 		},
-	}
+	}, faults.apis()...)
 }
 func RegisterApisFromWhitelist(apis []rpc.API, modules []string, srv *rpc.Server, exposeAll bool) error {
-	if bad, available := checkModuleAvailability(modules, apis); len(bad) > 0 {
-		log.Error("Unavailable modules in HTTP API list", "unavailable", bad, "available", available)
+	if err := checkModules(modules, apis); err != nil {
+		return err
 	}
 	whitelist := make(map[string]bool)
 	for _, module := range modules {
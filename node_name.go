@@ -0,0 +1,73 @@
+package node
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"text/template"
+)
+type NodeNameFields struct {
+	Name      string
+	UserIdent string
+	Identity  string
+	Version   string
+	OS        string
+	Arch      string
+	GoVersion string
+	Labels    map[string]string
+}
+func clientNameSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r < '!' || r > '~' {
+			return '-'
+		}
+		return r
+	}, s)
+}
+func (c *Config) nodeNameTemplate() (*template.Template, error) {
+	if c.NodeNameTemplate == "" {
+		return nil, nil
+	}
+	tmpl, err := template.New("nodename").Option("missingkey=zero").Parse(c.NodeNameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NodeNameTemplate: %v", err)
+	}
+	return tmpl, nil
+}
+func (c *Config) nodeNameFields(name string) NodeNameFields {
+	fields := NodeNameFields{
+		Name:      clientNameSafe(name),
+		UserIdent: clientNameSafe(c.UserIdent),
+		Version:   clientNameSafe(c.Version),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+		Labels:    make(map[string]string, len(c.NodeNameLabels)),
+	}
+	if c.Identity != nil && c.Identity.Operator != "" {
+		fields.Identity = c.Identity.clientTag()
+	}
+	for key, value := range c.NodeNameLabels {
+		fields.Labels[key] = clientNameSafe(value)
+	}
+	return fields
+}
+func (c *Config) templatedNodeName(name string) (string, bool) {
+	tmpl, err := c.nodeNameTemplate()
+	if tmpl == nil {
+		if err != nil {
+			c.logger().Warn("Ignoring node name template", "err", err)
+		}
+		return "", false
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, c.nodeNameFields(name)); err != nil {
+		c.logger().Warn("Failed to render node name template", "err", err)
+		return "", false
+	}
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r > '~' {
+			return '-'
+		}
+		return r
+	}, out.String()), true
+}
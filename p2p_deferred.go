@@ -0,0 +1,112 @@
+package node
+import (
+	"sync/atomic"
+	"time"
+	"github.com/Cryptochain-VON/p2p"
+	"github.com/Cryptochain-VON/p2p/enode"
+)
+const p2pReadyPollInterval = time.Second
+type P2PReadyEvent struct {
+	Server *p2p.Server
+}
+func (n *Node) p2pPending() bool {
+	return atomic.LoadInt32(&n.p2pDeferred) == 1
+}
+func (n *Node) p2pServer() (*p2p.Server, error) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	if n.server == nil {
+		return nil, ErrNodeStopped
+	}
+	if n.p2pPending() {
+		return nil, ErrP2PNotStarted
+	}
+	return n.server, nil
+}
+func (n *Node) p2pSession() (*p2p.Server, <-chan struct{}, error) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	if n.server == nil {
+		return nil, nil, ErrNodeStopped
+	}
+	if n.p2pPending() {
+		return nil, nil, ErrP2PNotStarted
+	}
+	return n.server, n.p2pStop, nil
+}
+func (n *Node) P2PStarted() bool {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.server != nil && !n.p2pPending()
+}
+func (n *Node) StartP2P() error {
+	server, err := n.startDeferredP2P()
+	if err != nil {
+		return err
+	}
+	n.eventmux.Post(P2PReadyEvent{Server: server})
+	return nil
+}
+func (n *Node) startDeferredP2P() (*p2p.Server, error) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.server == nil {
+		return nil, ErrNodeStopped
+	}
+	if !n.p2pPending() {
+		return nil, ErrP2PRunning
+	}
+	if err := n.server.Start(); err != nil {
+		return nil, convertFileLockError(err)
+	}
+	atomic.StoreInt32(&n.p2pDeferred, 0)
+	n.log.Info("Deferred peer-to-peer networking started", "listen", n.server.ListenAddr)
+	n.startPeerManagement(n.server, n.deferredStatic)
+	n.deferredStatic = nil
+	n.updateEndpointsFile()
+	return n.server, nil
+}
+func (n *Node) startPeerManagement(server *p2p.Server, nodes []*enode.Node) {
+	if scoring := newPeerScoring(n.config, server, &n.peerDemand, n.clock, n.log); scoring != nil {
+		scoring.start()
+		n.scoreLock.Lock()
+		n.peerScores = scoring
+		n.scoreLock.Unlock()
+	}
+	if len(nodes) == 0 {
+		return
+	}
+	n.staticDialer = newStaticDialer(server, nodes, n.dial.backoff, n.dial.maxBackoff, n.clock, n.log)
+	n.staticDialer.start()
+}
+func (n *Node) stopPeerManagement() {
+	if n.staticDialer != nil {
+		n.staticDialer.stop()
+		n.staticDialer = nil
+	}
+	n.scoreLock.Lock()
+	scoring := n.peerScores
+	n.peerScores = nil
+	n.scoreLock.Unlock()
+	if scoring != nil {
+		scoring.stop()
+	}
+}
+func (n *Node) waitP2PReady(ready func() bool, stop chan struct{}) {
+	ticker := n.clock.NewTicker(p2pReadyPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			if !ready() {
+				continue
+			}
+			if err := n.StartP2P(); err != nil && err != ErrP2PRunning {
+				n.log.Error("Failed to start deferred peer-to-peer networking", "err", err)
+			}
+			return
+		case <-stop:
+			return
+		}
+	}
+}
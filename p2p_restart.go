@@ -0,0 +1,60 @@
+package node
+import (
+	"sync/atomic"
+	"github.com/Cryptochain-VON/p2p"
+)
+type P2PRestartHandler interface {
+	P2PRestarted(server *p2p.Server)
+}
+type P2PRestartedEvent struct {
+	Server *p2p.Server
+}
+func (n *Node) RestartP2P() error {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+	if n.server == nil {
+		return ErrNodeStopped
+	}
+	if n.p2pPending() {
+		return ErrP2PNotStarted
+	}
+	n.log.Info("Restarting peer-to-peer networking")
+	n.stopIdleMonitor()
+	n.stopPeerManagement()
+	n.peerHistory.stop()
+	n.webhooks.stop()
+	n.webhooks = nil
+	n.server.Stop()
+	close(n.p2pStop)
+	n.p2pStop = make(chan struct{})
+	n.serverConfig = n.makeServerConfig()
+	running, staticNodes := n.newServer(n.serverConfig)
+	for _, kind := range n.serviceOrder {
+		running.Protocols = append(running.Protocols, n.services[kind].Protocols()...)
+	}
+	n.server = running
+	n.peerHistory.start(running, n.clock)
+	n.webhooks = newWebhookDispatcher(n.config.Webhooks, running.Self().ID().String(), n.clock, n.log)
+	if n.webhooks != nil {
+		n.webhooks.start(running)
+	}
+	if n.config.IdleTimeout > 0 {
+		defer n.startIdleMonitor(n.config.IdleTimeout)
+	}
+	if err := running.Start(); err != nil {
+		atomic.StoreInt32(&n.p2pDeferred, 1)
+		n.deferredStatic = staticNodes
+		n.log.Error("Failed to restart peer-to-peer networking, retry with admin_startP2P", "err", err)
+		return convertFileLockError(err)
+	}
+	n.startPeerManagement(running, staticNodes)
+	for _, kind := range n.serviceOrder {
+		if handler, ok := n.services[kind].(P2PRestartHandler); ok {
+			handler.P2PRestarted(running)
+		}
+	}
+	n.eventmux.Post(P2PRestartedEvent{Server: running})
+	n.updateEndpointsFile()
+	n.log.Info("Peer-to-peer networking restarted", "listen", running.ListenAddr, "static", len(running.StaticNodes)+len(staticNodes), "trusted", len(running.TrustedNodes))
+	return nil
+}
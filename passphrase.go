@@ -0,0 +1,61 @@
+package node
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"github.com/Cryptochain-VON/accounts"
+)
+type PassphraseProvider interface {
+	Passphrase(account accounts.Account) (string, error)
+}
+type PassphraseFunc func(account accounts.Account) (string, error)
+func (f PassphraseFunc) Passphrase(account accounts.Account) (string, error) {
+	return f(account)
+}
+type FilePassphraseProvider struct {
+	Path string
+}
+func (p *FilePassphraseProvider) Passphrase(account accounts.Account) (string, error) {
+	blob, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read passphrase file: %v", err)
+	}
+	return strings.TrimRight(string(blob), "\r\n"), nil
+}
+type EnvPassphraseProvider struct {
+	Var string
+}
+func (p *EnvPassphraseProvider) Passphrase(account accounts.Account) (string, error) {
+	v, ok := os.LookupEnv(p.Var)
+	if !ok {
+		return "", fmt.Errorf("passphrase environment variable %s not set", p.Var)
+	}
+	return v, nil
+}
+func (c *Config) passphraseProvider() PassphraseProvider {
+	switch {
+	case c.PassphraseProvider != nil:
+		return c.PassphraseProvider
+	case c.PassphraseFile != "":
+		return &FilePassphraseProvider{Path: c.PassphraseFile}
+	case c.PassphraseEnv != "":
+		return &EnvPassphraseProvider{Var: c.PassphraseEnv}
+	default:
+		return nil
+	}
+}
+func (n *Node) Passphrase(account accounts.Account) (string, error) {
+	provider := n.config.passphraseProvider()
+	if provider == nil {
+		return "", ErrNoPassphraseProvider
+	}
+	return provider.Passphrase(account)
+}
+func (n *Node) UnlockAccount(account accounts.Account) error {
+	passphrase, err := n.Passphrase(account)
+	if err != nil {
+		return err
+	}
+	return n.unlockKeyStoreAccount(account, passphrase, 0)
+}
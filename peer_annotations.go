@@ -0,0 +1,96 @@
+package node
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/log"
+	"github.com/Cryptochain-VON/p2p"
+	"github.com/Cryptochain-VON/p2p/enode"
+)
+type PeerAnnotation struct {
+	Labels  []string  `json:"labels,omitempty"`
+	Note    string    `json:"note,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+type PeerInfo struct {
+	*p2p.PeerInfo
+	Annotation *PeerAnnotation `json:"annotation,omitempty"`
+	Score      *float64        `json:"score,omitempty"`
+}
+type peerAnnotations struct {
+	path    string
+	log     log.Logger
+	lock    sync.Mutex
+	entries map[enode.ID]*PeerAnnotation
+}
+func newPeerAnnotations(path string, logger log.Logger) *peerAnnotations {
+	pa := &peerAnnotations{path: path, log: logger, entries: make(map[enode.ID]*PeerAnnotation)}
+	if path == "" {
+		return pa
+	}
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return pa
+	}
+	if err := json.Unmarshal(blob, &pa.entries); err != nil {
+		logger.Warn("Discarding corrupt peer annotations", "path", path, "err", err)
+		pa.entries = make(map[enode.ID]*PeerAnnotation)
+	}
+	return pa
+}
+func (pa *peerAnnotations) get(id enode.ID) *PeerAnnotation {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+	if a, ok := pa.entries[id]; ok {
+		ann := *a
+		return &ann
+	}
+	return nil
+}
+func (pa *peerAnnotations) set(id enode.ID, labels []string, note string) (*PeerAnnotation, error) {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+	if len(labels) == 0 && note == "" {
+		delete(pa.entries, id)
+		return nil, pa.save()
+	}
+	a := &PeerAnnotation{Labels: labels, Note: note, Updated: time.Now().UTC()}
+	pa.entries[id] = a
+	ann := *a
+	return &ann, pa.save()
+}
+func (pa *peerAnnotations) all() map[enode.ID]PeerAnnotation {
+	pa.lock.Lock()
+	defer pa.lock.Unlock()
+	all := make(map[enode.ID]PeerAnnotation, len(pa.entries))
+	for id, a := range pa.entries {
+		all[id] = *a
+	}
+	return all
+}
+func (pa *peerAnnotations) save() error {
+	if pa.path == "" {
+		return nil
+	}
+	blob, err := json.MarshalIndent(pa.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(pa.path), 0700); err != nil {
+		return err
+	}
+	tmp := pa.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, blob, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, pa.path)
+}
+func (n *Node) AnnotatePeer(id enode.ID, labels []string, note string) (*PeerAnnotation, error) {
+	return n.peerNotes.set(id, labels, note)
+}
+func (n *Node) PeerAnnotations() map[enode.ID]PeerAnnotation {
+	return n.peerNotes.all()
+}
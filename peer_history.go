@@ -0,0 +1,86 @@
+package node
+import (
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/p2p"
+	"github.com/Cryptochain-VON/p2p/enode"
+)
+const defaultPeerHistorySize = 1024
+type PeerHistoryEvent struct {
+	Time   time.Time         `json:"time"`
+	Type   p2p.PeerEventType `json:"type"`
+	Peer   enode.ID          `json:"peer"`
+	Remote string            `json:"remote,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+type peerHistory struct {
+	lock   sync.Mutex
+	events []PeerHistoryEvent
+	next   int
+	full   bool
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+func newPeerHistory(size int) *peerHistory {
+	if size <= 0 {
+		size = defaultPeerHistorySize
+	}
+	return &peerHistory{events: make([]PeerHistoryEvent, size)}
+}
+func (h *peerHistory) start(server *p2p.Server, clock Clock) {
+	events := make(chan *p2p.PeerEvent, 64)
+	sub := server.SubscribeEvents(events)
+	h.quit = make(chan struct{})
+	h.wg.Add(1)
+	go func() {
+		defer h.wg.Done()
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case ev := <-events:
+				if ev.Type != p2p.PeerEventTypeAdd && ev.Type != p2p.PeerEventTypeDrop {
+					continue
+				}
+				h.record(PeerHistoryEvent{Time: clock.Now(), Type: ev.Type, Peer: ev.Peer, Remote: ev.RemoteAddress, Error: ev.Error})
+			case <-sub.Err():
+				return
+			case <-h.quit:
+				return
+			}
+		}
+	}()
+}
+func (h *peerHistory) stop() {
+	if h.quit != nil {
+		close(h.quit)
+		h.wg.Wait()
+		h.quit = nil
+	}
+}
+func (h *peerHistory) record(ev PeerHistoryEvent) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.events[h.next] = ev
+	h.next = (h.next + 1) % len(h.events)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+func (h *peerHistory) since(t time.Time) []PeerHistoryEvent {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	ordered := h.events[:h.next]
+	if h.full {
+		ordered = append(append([]PeerHistoryEvent{}, h.events[h.next:]...), h.events[:h.next]...)
+	}
+	result := []PeerHistoryEvent{}
+	for _, ev := range ordered {
+		if !ev.Time.Before(t) {
+			result = append(result, ev)
+		}
+	}
+	return result
+}
+func (n *Node) PeerHistory(since time.Time) []PeerHistoryEvent {
+	return n.peerHistory.since(since)
+}
@@ -0,0 +1,177 @@
+package node
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+	"github.com/Cryptochain-VON/log"
+	"github.com/Cryptochain-VON/p2p"
+	"github.com/Cryptochain-VON/p2p/enode"
+)
+const (
+	peerScoreInterval = 30 * time.Second
+	peerMsgRecvScore  = 0.001
+	peerRejectedMsg   = "Rejected peer"
+)
+type PeerScorer interface {
+	PeerEvent(ev *p2p.PeerEvent)
+	Report(id enode.ID, metric string, value float64)
+	Score(id enode.ID) float64
+}
+type defaultPeerScorer struct {
+	lock   sync.Mutex
+	scores map[enode.ID]float64
+}
+func newDefaultPeerScorer() *defaultPeerScorer {
+	return &defaultPeerScorer{scores: make(map[enode.ID]float64)}
+}
+func (s *defaultPeerScorer) PeerEvent(ev *p2p.PeerEvent) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch ev.Type {
+	case p2p.PeerEventTypeAdd:
+		s.scores[ev.Peer] = 0
+	case p2p.PeerEventTypeDrop:
+		delete(s.scores, ev.Peer)
+	case p2p.PeerEventTypeMsgRecv:
+		if _, ok := s.scores[ev.Peer]; ok {
+			s.scores[ev.Peer] += peerMsgRecvScore
+		}
+	}
+}
+func (s *defaultPeerScorer) Report(id enode.ID, metric string, value float64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, ok := s.scores[id]; ok {
+		s.scores[id] += value
+	}
+}
+func (s *defaultPeerScorer) Score(id enode.ID) float64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.scores[id]
+}
+type peerDemand struct {
+	rejected int32
+}
+func (d *peerDemand) hook(logger log.Logger) log.Logger {
+	child := logger.New()
+	child.SetHandler(&peerDemandHook{next: logger.GetHandler(), demand: d})
+	return child
+}
+func (d *peerDemand) take() bool {
+	return atomic.SwapInt32(&d.rejected, 0) == 1
+}
+type peerDemandHook struct {
+	next   log.Handler
+	demand *peerDemand
+}
+func (h *peerDemandHook) Log(r *log.Record) error {
+	if r.Msg == peerRejectedMsg {
+		for i := 0; i+1 < len(r.Ctx); i += 2 {
+			if r.Ctx[i] == "err" && r.Ctx[i+1] == error(p2p.DiscTooManyPeers) {
+				atomic.StoreInt32(&h.demand.rejected, 1)
+			}
+		}
+	}
+	return h.next.Log(r)
+}
+type peerScoring struct {
+	server   *p2p.Server
+	scorer   PeerScorer
+	demand   *peerDemand
+	evict    float64
+	protect  float64
+	maxPeers int
+	clock    Clock
+	log      log.Logger
+	quit     chan struct{}
+	wg       sync.WaitGroup
+}
+func newPeerScoring(conf *Config, server *p2p.Server, demand *peerDemand, clock Clock, logger log.Logger) *peerScoring {
+	scorer := conf.PeerScorer
+	if scorer == nil {
+		if !conf.PeerScoring {
+			return nil
+		}
+		scorer = newDefaultPeerScorer()
+	}
+	return &peerScoring{
+		server:   server,
+		scorer:   scorer,
+		demand:   demand,
+		evict:    conf.PeerEvictScore,
+		protect:  conf.PeerProtectScore,
+		maxPeers: server.MaxPeers,
+		clock:    clock,
+		log:      logger,
+		quit:     make(chan struct{}),
+	}
+}
+func (s *peerScoring) start() {
+	events := make(chan *p2p.PeerEvent, 64)
+	sub := s.server.SubscribeEvents(events)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer sub.Unsubscribe()
+		ticker := s.clock.NewTicker(peerScoreInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case ev := <-events:
+				s.scorer.PeerEvent(ev)
+			case <-ticker.C():
+				s.evaluate()
+			case <-sub.Err():
+				return
+			case <-s.quit:
+				return
+			}
+		}
+	}()
+}
+func (s *peerScoring) stop() {
+	close(s.quit)
+	s.wg.Wait()
+}
+func (s *peerScoring) evaluate() {
+	var (
+		victim   *p2p.Peer
+		lowest   float64
+		retained int
+	)
+	for _, peer := range s.server.Peers() {
+		score := s.scorer.Score(peer.ID())
+		if score < s.evict {
+			s.log.Info("Disconnecting low-scoring peer", "id", peer.ID(), "score", score, "threshold", s.evict)
+			peer.Disconnect(p2p.DiscUselessPeer)
+			continue
+		}
+		retained++
+		if score < s.protect && (victim == nil || score < lowest) {
+			victim, lowest = peer, score
+		}
+	}
+	if !s.demand.take() {
+		return
+	}
+	if victim != nil && s.maxPeers > 0 && retained >= s.maxPeers {
+		s.log.Debug("Peer slots full with peers waiting, evicting lowest-scoring peer", "id", victim.ID(), "score", lowest)
+		victim.Disconnect(p2p.DiscTooManyPeers)
+	}
+}
+func (n *Node) ReportPeer(id enode.ID, metric string, value float64) {
+	n.scoreLock.RLock()
+	defer n.scoreLock.RUnlock()
+	if n.peerScores != nil {
+		n.peerScores.scorer.Report(id, metric, value)
+	}
+}
+func (n *Node) PeerScore(id enode.ID) (float64, bool) {
+	n.scoreLock.RLock()
+	defer n.scoreLock.RUnlock()
+	if n.peerScores == nil {
+		return 0, false
+	}
+	return n.peerScores.scorer.Score(id), true
+}
@@ -0,0 +1,89 @@
+package node
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+const (
+	datadirProfiles       = "profiles"
+	defaultCPUProfileTime = 10 * time.Second
+)
+func (n *Node) WriteProfiles(types []string, dir string, cpuDuration time.Duration) ([]string, error) {
+	return n.writeProfiles(context.Background(), types, dir, cpuDuration)
+}
+func (n *Node) writeProfiles(ctx context.Context, types []string, dir string, cpuDuration time.Duration) ([]string, error) {
+	if len(types) == 0 {
+		types = []string{"heap", "goroutine", "mutex", "cpu"}
+	}
+	if dir == "" {
+		dir = datadirProfiles
+	}
+	if !filepath.IsAbs(dir) {
+		if n.config.DataDir == "" {
+			return nil, fmt.Errorf("relative profile directory %q requires a datadir", dir)
+		}
+		dir = filepath.Join(n.config.instanceDir(), dir)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if cpuDuration <= 0 {
+		cpuDuration = defaultCPUProfileTime
+	}
+	stamp := n.clock.Now().UTC().Format("20060102T150405Z")
+	var paths []string
+	for _, kind := range types {
+		if err := ctx.Err(); err != nil {
+			return paths, err
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s-%s.pprof", kind, stamp))
+		if err := writeProfile(ctx, kind, path, cpuDuration); err != nil {
+			return paths, fmt.Errorf("%s profile: %v", kind, err)
+		}
+		n.log.Info("Wrote runtime profile", "type", kind, "path", path)
+		paths = append(paths, path)
+	}
+	return paths, nil
+}
+func writeProfile(ctx context.Context, kind, path string, cpuDuration time.Duration) error {
+	var profile *pprof.Profile
+	if kind != "cpu" {
+		if profile = pprof.Lookup(kind); profile == nil {
+			return fmt.Errorf("unknown profile type")
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if kind == "mutex" {
+		if prev := runtime.SetMutexProfileFraction(1); prev == 0 {
+			sleepContext(ctx, cpuDuration)
+			defer runtime.SetMutexProfileFraction(0)
+		} else {
+			runtime.SetMutexProfileFraction(prev)
+		}
+	}
+	if profile != nil {
+		return profile.WriteTo(f, 0)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		return err
+	}
+	sleepContext(ctx, cpuDuration)
+	pprof.StopCPUProfile()
+	return nil
+}
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,117 @@
+package node
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+const reconfigureDrainTimeout = 10 * time.Second
+type EndpointConfig struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	TLSCert    string `json:"tlsCert"`
+	TLSKey     string `json:"tlsKey"`
+	DisableTLS bool   `json:"disableTLS"`
+}
+type EndpointMove struct {
+	Endpoint string `json:"endpoint"`
+	From     string `json:"from"`
+	To       string `json:"to"`
+	TLS      bool   `json:"tls"`
+}
+func (n *Node) ReconfigureEndpoint(kind string, cfg EndpointConfig) (*EndpointMove, error) {
+	n.lock.Lock()
+	move, old, err := n.reconfigureEndpoint(kind, cfg)
+	n.lock.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), reconfigureDrainTimeout)
+	defer cancel()
+	n.shutdownServer(ctx, old, kind)
+	return move, nil
+}
+func (n *Node) reconfigureEndpoint(kind string, cfg EndpointConfig) (*EndpointMove, *http.Server, error) {
+	if n.server == nil {
+		return nil, nil, ErrNodeStopped
+	}
+	var (
+		current  string
+		addr     net.Addr
+		root     http.Handler
+		timeouts = n.config.HTTPTimeouts
+		cert     = n.config.HTTPTLSCert
+		key      = n.config.HTTPTLSKey
+	)
+	switch kind {
+	case "http":
+		if n.httpHandler == nil || n.httpRoot == nil {
+			return nil, nil, fmt.Errorf("HTTP RPC not running")
+		}
+		current, addr, root = n.httpEndpoint, n.httpListenerAddr, n.httpRoot
+	case "ws":
+		if n.wsSharesHTTP() {
+			return nil, nil, fmt.Errorf("WebSocket RPC shares the HTTP endpoint, reconfigure http instead")
+		}
+		if n.wsHandler == nil || n.wsRoot == nil {
+			return nil, nil, fmt.Errorf("WebSocket RPC not running")
+		}
+		current, addr, root, timeouts = n.wsEndpoint, n.wsListenerAddr, n.wsRoot, n.config.WSTimeouts
+		cert, key = n.wsTLSCert, n.wsTLSKey
+	default:
+		return nil, nil, fmt.Errorf("unknown endpoint %q, want http or ws", kind)
+	}
+	host := cfg.Host
+	if host == "" {
+		if host, _, _ = net.SplitHostPort(current); host == "" {
+			host = DefaultHTTPHost
+		}
+	}
+	endpoint := net.JoinHostPort(host, strconv.Itoa(cfg.Port))
+	switch {
+	case cfg.DisableTLS:
+		cert, key = "", ""
+	case cfg.TLSCert != "" || cfg.TLSKey != "":
+		cert, key = cfg.TLSCert, cfg.TLSKey
+	}
+	tlsConfig, err := n.serverTLSConfig(endpoint, cert, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		server *http.Server
+		bound  net.Addr
+	)
+	if kind == "ws" && tlsConfig == nil {
+		server, bound, err = startWSEndpoint(endpoint, timeouts, n.config.RPCMaxConnections, root)
+	} else {
+		server, bound, err = startHTTPEndpoint(endpoint, timeouts, tlsConfig, n.config.RPCMaxConnections, root)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	move := &EndpointMove{Endpoint: kind, From: addr.String(), To: bound.String(), TLS: tlsConfig != nil}
+	var old *http.Server
+	switch kind {
+	case "http":
+		shared := n.wsSharesHTTP()
+		old, n.httpServer = n.httpServer, server
+		n.httpEndpoint, n.httpListenerAddr, n.httpTLS = endpoint, bound, tlsConfig != nil
+		n.config.HTTPHost, n.config.HTTPPort = host, cfg.Port
+		n.config.HTTPTLSCert, n.config.HTTPTLSKey = cert, key
+		if shared {
+			n.wsEndpoint = endpoint
+			n.config.WSHost, n.config.WSPort = host, cfg.Port
+		}
+	case "ws":
+		old, n.wsHTTPServer = n.wsHTTPServer, server
+		n.wsEndpoint, n.wsListenerAddr = endpoint, bound
+		n.wsTLSCert, n.wsTLSKey = cert, key
+		n.config.WSHost, n.config.WSPort = host, cfg.Port
+	}
+	n.log.Info("Endpoint moved, draining old listener", "endpoint", kind, "from", move.From, "to", move.To, "tls", move.TLS)
+	n.updateEndpointsFile()
+	return move, old, nil
+}
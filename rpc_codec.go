@@ -0,0 +1,442 @@
+package node
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/log"
+	"github.com/Cryptochain-VON/rpc"
+	"github.com/gorilla/websocket"
+)
+const (
+	wsReadBuffer     = 1024
+	wsWriteBuffer    = 1024
+	wsReadLimit      = 5 * 1024 * 1024
+	usageIPCIdentity = "ipc"
+)
+type rpcMessage struct {
+	Version string          `json:"jsonrpc,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   json.RawMessage `json:"error,omitempty"`
+}
+type rpcErrorObject struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+type rpcErrorResponse struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   rpcErrorObject  `json:"error"`
+}
+func newRPCErrorResponse(id json.RawMessage, err error) *rpcErrorResponse {
+	code := -32000
+	if coded, ok := err.(rpc.Error); ok {
+		code = coded.ErrorCode()
+	}
+	return &rpcErrorResponse{Version: "2.0", ID: id, Error: rpcErrorObject{Code: code, Message: err.Error()}}
+}
+func parseRPCMessages(raw json.RawMessage) ([]json.RawMessage, []*rpcMessage, bool) {
+	var elems []json.RawMessage
+	trimmed := bytes.TrimSpace(raw)
+	batch := len(trimmed) > 0 && trimmed[0] == '['
+	if batch {
+		if json.Unmarshal(trimmed, &elems) != nil {
+			return nil, nil, false
+		}
+	} else {
+		elems = []json.RawMessage{trimmed}
+	}
+	msgs := make([]*rpcMessage, len(elems))
+	for i, elem := range elems {
+		msgs[i] = new(rpcMessage)
+		if json.Unmarshal(elem, msgs[i]) != nil {
+			return nil, nil, false
+		}
+	}
+	return elems, msgs, batch
+}
+type rpcPendingCall struct {
+	subscribe bool
+	sub       string
+}
+type rpcTapHooks struct {
+	quota *wsSubscriptionQuota
+	pools *rpcWorkerPools
+	usage *usageTracker
+	subs    *rpcSubscriptionConns
+	journal *requestJournal
+	limit   int64
+}
+type rpcSubscriptionConns struct {
+	lock sync.Mutex
+	taps map[string]*rpcCodecTap
+}
+func newRPCSubscriptionConns() *rpcSubscriptionConns {
+	return &rpcSubscriptionConns{taps: make(map[string]*rpcCodecTap)}
+}
+func (s *rpcSubscriptionConns) add(id string, t *rpcCodecTap) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.taps[id] = t
+}
+func (s *rpcSubscriptionConns) remove(id string, t *rpcCodecTap) {
+	if s == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.taps[id] == t {
+		delete(s.taps, id)
+	}
+}
+func (s *rpcSubscriptionConns) drop(id string) bool {
+	if s == nil {
+		return false
+	}
+	s.lock.Lock()
+	t := s.taps[id]
+	delete(s.taps, id)
+	s.lock.Unlock()
+	if t == nil || t.conn == nil {
+		return false
+	}
+	t.conn.Close()
+	return true
+}
+type rpcCodecTap struct {
+	encode    func(v interface{}) error
+	decode    func(v interface{}) error
+	quota     *wsSubscriptionQuota
+	pools     *rpcWorkerPools
+	usage     *usageTracker
+	conns     *rpcSubscriptionConns
+	journal   *requestJournal
+	transport string
+	conn      *rpcTapConn
+	stats     *wsClientConn
+	client    string
+	usageID   string
+	quit      chan struct{}
+	writeLock sync.Mutex
+	lock      sync.Mutex
+	pending   map[string]rpcPendingCall
+	holds     map[string]func()
+	subs      map[string]bool
+	reserved  int
+	closed    bool
+}
+func newRPCCodecTap(encode, decode func(v interface{}) error, hooks rpcTapHooks, client, usageID string) *rpcCodecTap {
+	return &rpcCodecTap{
+		encode:  encode,
+		decode:  decode,
+		quota:   hooks.quota,
+		pools:   hooks.pools,
+		usage:   hooks.usage,
+		conns:   hooks.subs,
+		journal: hooks.journal,
+		client:  client,
+		usageID: usageID,
+		quit:    make(chan struct{}),
+		pending: make(map[string]rpcPendingCall),
+		holds:   make(map[string]func()),
+		subs:    make(map[string]bool),
+	}
+}
+func (t *rpcCodecTap) codec(conn rpcCodecConn, remote string) rpc.ServerCodec {
+	t.conn = &rpcTapConn{rpcCodecConn: conn, tap: t, remote: remote}
+	return rpc.NewFuncCodec(t.conn, t.write, t.read)
+}
+func (t *rpcCodecTap) read(v interface{}) error {
+	for {
+		var raw json.RawMessage
+		if err := t.decode(&raw); err != nil {
+			return err
+		}
+		t.stats.messageIn()
+		t.journal.record(t.transport, raw)
+		elems, msgs, batch := parseRPCMessages(raw)
+		var (
+			pass     []json.RawMessage
+			ids      []string
+			rejected []interface{}
+			held     = make(map[string]func())
+		)
+		for i, msg := range msgs {
+			if err := t.admit(msg, held); err != nil {
+				if len(msg.ID) > 0 {
+					rejected = append(rejected, newRPCErrorResponse(msg.ID, err))
+				}
+				continue
+			}
+			pass = append(pass, elems[i])
+			if len(msg.ID) > 0 {
+				ids = append(ids, string(msg.ID))
+			}
+		}
+		t.hold(ids, held)
+		if len(rejected) > 0 {
+			var reply interface{} = rejected
+			if !batch {
+				reply = rejected[0]
+			}
+			if err := t.write(reply); err != nil {
+				return err
+			}
+			if len(pass) == 0 {
+				continue
+			}
+			if raw = pass[0]; batch {
+				blob, err := json.Marshal(pass)
+				if err != nil {
+					return err
+				}
+				raw = blob
+			}
+		}
+		if out, ok := v.(*json.RawMessage); ok {
+			*out = raw
+			return nil
+		}
+		return json.Unmarshal(raw, v)
+	}
+}
+func (t *rpcCodecTap) write(v interface{}) error {
+	blob, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if _, msgs, _ := parseRPCMessages(blob); msgs != nil {
+		for _, msg := range msgs {
+			t.observe(msg)
+		}
+	}
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	if err := t.encode(json.RawMessage(blob)); err != nil {
+		return err
+	}
+	t.stats.messageOut()
+	return nil
+}
+func (t *rpcCodecTap) admit(msg *rpcMessage, held map[string]func()) error {
+	if t.usage != nil && msg.Method != "" {
+		if err := t.usage.admit(t.usageID, 1); err != nil {
+			return err
+		}
+	}
+	if len(msg.ID) == 0 {
+		return nil
+	}
+	if err := t.admitSubscription(msg); err != nil {
+		return err
+	}
+	if namespace, ok := t.pools.pooled(msg.Method); ok && held[namespace] == nil {
+		release, ok := t.pools.acquire(namespace, t.quit)
+		if !ok {
+			return &WorkerPoolSaturatedError{Namespace: namespace}
+		}
+		held[namespace] = release
+	}
+	return nil
+}
+func (t *rpcCodecTap) hold(ids []string, held map[string]func()) {
+	if len(held) == 0 {
+		return
+	}
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			for _, fn := range held {
+				fn()
+			}
+		})
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed || len(ids) == 0 {
+		release()
+		return
+	}
+	for _, id := range ids {
+		t.holds[id] = release
+	}
+}
+func (t *rpcCodecTap) admitSubscription(msg *rpcMessage) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		return nil
+	}
+	switch {
+	case strings.HasSuffix(msg.Method, "_unsubscribe"):
+		var params []string
+		if json.Unmarshal(msg.Params, &params) == nil && len(params) > 0 {
+			t.pending[string(msg.ID)] = rpcPendingCall{sub: params[0]}
+		}
+	case strings.HasSuffix(msg.Method, "_subscribe"):
+		if t.quota != nil {
+			if err := t.quota.acquire(t.client, len(t.subs)+t.reserved); err != nil {
+				return err
+			}
+		}
+		t.reserved++
+		t.pending[string(msg.ID)] = rpcPendingCall{subscribe: true}
+	}
+	return nil
+}
+func (t *rpcCodecTap) observe(msg *rpcMessage) {
+	if len(msg.ID) == 0 || msg.Method != "" {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if release, ok := t.holds[string(msg.ID)]; ok {
+		delete(t.holds, string(msg.ID))
+		release()
+	}
+	call, ok := t.pending[string(msg.ID)]
+	if !ok || t.closed {
+		return
+	}
+	delete(t.pending, string(msg.ID))
+	if call.subscribe {
+		t.reserved--
+		var sub string
+		if msg.Error == nil && json.Unmarshal(msg.Result, &sub) == nil && sub != "" {
+			t.subs[sub] = true
+			t.conns.add(sub, t)
+			t.stats.setSubscriptions(len(t.subs))
+			return
+		}
+		t.releaseQuota(1)
+		return
+	}
+	var removed bool
+	if msg.Error == nil && json.Unmarshal(msg.Result, &removed) == nil && removed && t.subs[call.sub] {
+		delete(t.subs, call.sub)
+		t.conns.remove(call.sub, t)
+		t.stats.setSubscriptions(len(t.subs))
+		t.releaseQuota(1)
+	}
+}
+func (t *rpcCodecTap) releaseQuota(n int) {
+	if t.quota != nil && n > 0 {
+		t.quota.release(t.client, n)
+	}
+}
+func (t *rpcCodecTap) close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.closed {
+		return
+	}
+	t.releaseQuota(len(t.subs) + t.reserved)
+	for sub := range t.subs {
+		t.conns.remove(sub, t)
+	}
+	t.stats.setSubscriptions(0)
+	for _, release := range t.holds {
+		release()
+	}
+	close(t.quit)
+	t.closed, t.subs, t.pending, t.holds, t.reserved = true, nil, nil, nil, 0
+}
+type rpcCodecConn interface {
+	Close() error
+	SetWriteDeadline(time.Time) error
+}
+type rpcTapConn struct {
+	rpcCodecConn
+	tap    *rpcCodecTap
+	remote string
+	once   sync.Once
+}
+func (c *rpcTapConn) Close() error {
+	c.once.Do(c.tap.close)
+	return c.rpcCodecConn.Close()
+}
+func (c *rpcTapConn) RemoteAddr() string {
+	return c.remote
+}
+type messageLimitReader struct {
+	r     io.Reader
+	limit int64
+	start int64
+	read  int64
+}
+func (l *messageLimitReader) Read(p []byte) (int, error) {
+	remaining := l.start + l.limit - l.read
+	if remaining <= 0 {
+		return 0, errRequestTooLarge
+	}
+	if int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	return n, err
+}
+func newLimitedDecoder(r io.Reader, limit int64) func(v interface{}) error {
+	if limit <= 0 {
+		return json.NewDecoder(r).Decode
+	}
+	lr := &messageLimitReader{r: r, limit: limit}
+	dec := json.NewDecoder(lr)
+	return func(v interface{}) error {
+		lr.start = dec.InputOffset()
+		return dec.Decode(v)
+	}
+}
+func newWSRPCHandler(srv *rpc.Server, hooks rpcTapHooks) http.Handler {
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  wsReadBuffer,
+		WriteBufferSize: wsWriteBuffer,
+		CheckOrigin:     func(*http.Request) bool { return true },
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Debug("WebSocket upgrade failed", "err", err)
+			return
+		}
+		limit := hooks.limit
+		if limit <= 0 {
+			limit = wsReadLimit
+		}
+		conn.SetReadLimit(limit)
+		var usageID string
+		if hooks.usage != nil {
+			usageID = hooks.usage.identity(r)
+		}
+		tap := newRPCCodecTap(conn.WriteJSON, conn.ReadJSON, hooks, hooks.quota.identity(r), usageID)
+		tap.stats, tap.transport = wsClientFromRequest(r), "ws"
+		srv.ServeCodec(tap.codec(conn, r.RemoteAddr), rpc.OptionMethodInvocation|rpc.OptionSubscriptions)
+	})
+}
+func serveRPCListener(srv *rpc.Server, l net.Listener, hooks rpcTapHooks) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				log.Warn("RPC accept error", "err", err)
+				continue
+			}
+			return
+		}
+		go func(conn net.Conn) {
+			tap := newRPCCodecTap(json.NewEncoder(conn).Encode, newLimitedDecoder(conn, hooks.limit), hooks, "", usageIPCIdentity)
+			tap.transport = "ipc"
+			srv.ServeCodec(tap.codec(conn, conn.RemoteAddr().String()), rpc.OptionMethodInvocation|rpc.OptionSubscriptions)
+		}(conn)
+	}
+}
@@ -0,0 +1,107 @@
+package node
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"github.com/Cryptochain-VON/rpc"
+)
+type endlessReader struct {
+	read int64
+}
+func (r *endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	r.read += int64(len(p))
+	return len(p), nil
+}
+func TestLimitedDecoder(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		limit int64
+		want  []string
+		err   error
+	}{
+		{name: "unlimited", input: `"` + strings.Repeat("a", 4096) + `"`, want: []string{strings.Repeat("a", 4096)}},
+		{name: "exact limit", input: `"aaaa"`, limit: 6, want: []string{"aaaa"}},
+		{name: "over limit", input: `"aaaaa"`, limit: 6, err: errRequestTooLarge},
+		{name: "pipelined within limit", input: `"aaaa""aaaa""aaaa""aaaa"`, limit: 7, want: []string{"aaaa", "aaaa", "aaaa", "aaaa"}},
+		{name: "oversized after small", input: `"aa""aaaaaaaa"`, limit: 6, want: []string{"aa"}, err: errRequestTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decode := newLimitedDecoder(strings.NewReader(tt.input), tt.limit)
+			for i, want := range tt.want {
+				var have string
+				if err := decode(&have); err != nil {
+					t.Fatalf("message %d: decode failed: %v", i, err)
+				}
+				if have != want {
+					t.Fatalf("message %d mismatch: have %q, want %q", i, have, want)
+				}
+			}
+			var rest string
+			err := decode(&rest)
+			if tt.err == nil && err != io.EOF {
+				t.Fatalf("trailing decode error mismatch: have %v, want EOF", err)
+			}
+			if tt.err != nil && err != tt.err {
+				t.Fatalf("decode error mismatch: have %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+func TestLimitedDecoderStopsReading(t *testing.T) {
+	body := new(endlessReader)
+	decode := newLimitedDecoder(io.MultiReader(strings.NewReader(`"`), body), 1024)
+	var v json.RawMessage
+	if err := decode(&v); err != errRequestTooLarge {
+		t.Fatalf("decode error mismatch: have %v, want %v", err, errRequestTooLarge)
+	}
+	if body.read > 1024 {
+		t.Fatalf("read past limit: %d bytes", body.read)
+	}
+}
+type testEchoAPI struct{}
+func (api *testEchoAPI) Length(s string) int {
+	return len(s)
+}
+func TestIPCRequestLimit(t *testing.T) {
+	payload := strings.Repeat("a", 1024*1024)
+	tests := []struct {
+		name    string
+		limit   int64
+		wantErr bool
+	}{
+		{name: "unlimited by default"},
+		{name: "above ipc limit", limit: 64 * 1024, wantErr: true},
+		{name: "within ipc limit", limit: 2 * 1024 * 1024},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := testNodeConfig()
+			conf.DataDir = testDataDir(t)
+			conf.NoUSB = true
+			conf.IPCPath = "test.ipc"
+			conf.RPCMaxRequestBytes = 1024
+			conf.IPCMaxRequestBytes = tt.limit
+			stack := startTestNode(t, conf, NewAPIService(rpc.API{Namespace: "test", Version: "1.0", Service: new(testEchoAPI), Public: true}))
+			client, err := rpc.DialIPC(context.Background(), stack.IPCEndpoint())
+			if err != nil {
+				t.Fatalf("failed to dial ipc: %v", err)
+			}
+			defer client.Close()
+			var length int
+			err = client.Call(&length, "test_length", payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("call error mismatch: have %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && length != len(payload) {
+				t.Fatalf("payload length mismatch: have %d, want %d", length, len(payload))
+			}
+		})
+	}
+}
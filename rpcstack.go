@@ -1,19 +1,98 @@
 package node
 import (
 	"compress/gzip"
+	"context"
+	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"os"
 	"strings"
 	"sync"
+	"time"
 	"github.com/Cryptochain-VON/log"
+	"github.com/Cryptochain-VON/metrics"
 	"github.com/rs/cors"
 )
+type HTTPErrorWriter func(w http.ResponseWriter, r *http.Request, status int, msg string)
+func PlainHTTPErrorWriter(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	http.Error(w, msg, status)
+}
+func JSONHTTPErrorWriter(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	type errorBody struct {
+		Code    int    `json:"code"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct {
+		Error errorBody `json:"error"`
+	}{errorBody{Code: status, Status: http.StatusText(status), Message: msg}})
+}
+type httpStackConfig struct {
+	cors        []string
+	vhosts      []string
+	errorWriter HTTPErrorWriter
+	passthrough []string
+	maxBody     int64
+	metrics     string
+	liveCors    *liveCorsHandler
+	pools       *rpcWorkerPools
+	pool        string
+	usage       *usageTracker
+	headers     map[string]string
+	journal     *requestJournal
+	auth        AuthProvider
+}
 func NewHTTPHandlerStack(srv http.Handler, cors []string, vhosts []string) http.Handler {
-	handler := newCorsHandler(srv, cors)
-	handler = newVHostHandler(vhosts, handler)
-	return newGzipHandler(handler)
+	return newHTTPHandlerStack(srv, httpStackConfig{cors: cors, vhosts: vhosts})
+}
+func newHTTPHandlerStack(srv http.Handler, conf httpStackConfig) http.Handler {
+	if conf.errorWriter == nil {
+		conf.errorWriter = PlainHTTPErrorWriter
+	}
+	handler := newStackTimingHandler(conf.metrics, "rpc", srv)
+	if conf.pool != "" {
+		handler = newStackTimingHandler(conf.metrics, "pools", newNamespacePoolHandler(conf.pools, conf.pool, handler, conf.errorWriter))
+	} else {
+		handler = newStackTimingHandler(conf.metrics, "pools", newWorkerPoolHandler(conf.pools, handler, conf.errorWriter))
+	}
+	handler = newStackTimingHandler(conf.metrics, "journal", newJournalHandler(conf.journal, handler, conf.errorWriter))
+	handler = newStackTimingHandler(conf.metrics, "passthrough", newHeaderPassthroughHandler(conf.passthrough, handler))
+	handler = newStackTimingHandler(conf.metrics, "quota", newQuotaHandler(conf.usage, handler, conf.errorWriter))
+	handler = newStackTimingHandler(conf.metrics, "limit", newBodyLimitHandler(conf.maxBody, handler, conf.errorWriter))
+	handler = newStackTimingHandler(conf.metrics, "auth", newAuthHandler(conf.auth, handler, conf.errorWriter, true))
+	if conf.liveCors != nil {
+		conf.liveCors.setNext(handler)
+		handler = newStackTimingHandler(conf.metrics, "cors", conf.liveCors)
+	} else {
+		handler = newStackTimingHandler(conf.metrics, "cors", newCorsHandler(handler, conf.cors))
+	}
+	handler = newStackTimingHandler(conf.metrics, "vhost", newVHostHandler(conf.vhosts, handler, conf.errorWriter))
+	handler = newStackTimingHandler(conf.metrics, "gzip", newGzipHandler(handler))
+	return newStackTimingHandler(conf.metrics, "headers", newExtraHeadersHandler(conf.headers, handler))
+}
+func newAdminHandlerStack(srv http.Handler, conf *Config, pools *rpcWorkerPools) http.Handler {
+	writeErr := conf.httpErrorWriter()
+	handler := newStackTimingHandler(httpAdminMetrics, "rpc", srv)
+	handler = newStackTimingHandler(httpAdminMetrics, "pools", newWorkerPoolHandler(pools, handler, writeErr))
+	handler = newStackTimingHandler(httpAdminMetrics, "auth", newAuthHandler(conf.adminAuthProvider(), handler, writeErr, false))
+	handler = newStackTimingHandler(httpAdminMetrics, "gzip", newGzipHandler(handler))
+	return newStackTimingHandler(httpAdminMetrics, "headers", newExtraHeadersHandler(conf.HTTPExtraHeaders, handler))
+}
+func (c *Config) httpStackConfig(cors, vhosts []string) httpStackConfig {
+	return httpStackConfig{
+		cors:        cors,
+		vhosts:      vhosts,
+		errorWriter: c.httpErrorWriter(),
+		passthrough: c.HTTPHeaderPassthrough,
+		maxBody:     c.RPCMaxRequestBytes,
+		metrics:     httpStackMetrics,
+		headers:     c.HTTPExtraHeaders,
+	}
 }
 func newCorsHandler(srv http.Handler, allowedOrigins []string) http.Handler {
 	if len(allowedOrigins) == 0 {
@@ -27,16 +106,116 @@ func newCorsHandler(srv http.Handler, allowedOrigins []string) http.Handler {
 	})
 	return c.Handler(srv)
 }
+type liveCorsHandler struct {
+	lock    sync.RWMutex
+	origins []string
+	next    http.Handler
+	handler http.Handler
+}
+func newLiveCorsHandler(origins []string) *liveCorsHandler {
+	return &liveCorsHandler{origins: append([]string{}, origins...)}
+}
+func (h *liveCorsHandler) setNext(next http.Handler) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.next = next
+	h.handler = newCorsHandler(next, h.origins)
+}
+func (h *liveCorsHandler) setOrigins(origins []string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.origins = origins
+	h.handler = newCorsHandler(h.next, origins)
+}
+func (h *liveCorsHandler) Origins() []string {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return append([]string{}, h.origins...)
+}
+func (h *liveCorsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.RLock()
+	handler := h.handler
+	h.lock.RUnlock()
+	handler.ServeHTTP(w, r)
+}
+const (
+	httpStackMetrics = "rpc/stack/http"
+	httpAdminMetrics = "rpc/stack/admin"
+	httpUnixMetrics  = "rpc/stack/unix"
+)
+type stackSpanKey struct{}
+func newStackTimingHandler(prefix, layer string, next http.Handler) http.Handler {
+	if !metrics.Enabled || prefix == "" {
+		return next
+	}
+	var timer metrics.Timer
+	if layer != "" {
+		timer = metrics.GetOrRegisterTimer(prefix+"/"+layer, nil)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		parent, _ := r.Context().Value(stackSpanKey{}).(*time.Duration)
+		var inner time.Duration
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), stackSpanKey{}, &inner)))
+		elapsed := time.Since(start)
+		if timer != nil {
+			timer.Update(elapsed - inner)
+		}
+		if parent != nil {
+			*parent += elapsed
+		}
+	})
+}
+type requestHeadersKey struct{}
+func RequestHeaders(ctx context.Context) http.Header {
+	headers, _ := ctx.Value(requestHeadersKey{}).(http.Header)
+	return headers
+}
+func newHeaderPassthroughHandler(headers []string, next http.Handler) http.Handler {
+	if len(headers) == 0 {
+		return next
+	}
+	names := make([]string, len(headers))
+	for i, header := range headers {
+		names[i] = http.CanonicalHeaderKey(header)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		passed := make(http.Header)
+		for _, name := range names {
+			if values, ok := r.Header[name]; ok {
+				passed[name] = values
+			}
+		}
+		ctx := context.WithValue(r.Context(), requestHeadersKey{}, passed)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+func newExtraHeadersHandler(headers map[string]string, next http.Handler) http.Handler {
+	if len(headers) == 0 {
+		return next
+	}
+	canonical := make(map[string]string, len(headers))
+	for name, value := range headers {
+		canonical[http.CanonicalHeaderKey(name)] = value
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for name, value := range canonical {
+			w.Header().Set(name, value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
 type virtualHostHandler struct {
-	vhosts map[string]struct{}
-	next   http.Handler
+	vhosts   map[string]struct{}
+	next     http.Handler
+	writeErr HTTPErrorWriter
 }
-func newVHostHandler(vhosts []string, next http.Handler) http.Handler {
+func newVHostHandler(vhosts []string, next http.Handler, writeErr HTTPErrorWriter) http.Handler {
 	vhostMap := make(map[string]struct{})
 	for _, allowedHost := range vhosts {
 		vhostMap[strings.ToLower(allowedHost)] = struct{}{}
 	}
-	return &virtualHostHandler{vhostMap, next}
+	return &virtualHostHandler{vhostMap, next, writeErr}
 }
 func (h *virtualHostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Host == "" {
@@ -59,7 +238,7 @@ func (h *virtualHostHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.next.ServeHTTP(w, r)
 		return
 	}
-	http.Error(w, "invalid host specified", http.StatusForbidden)
+	h.writeErr(w, r, http.StatusForbidden, "invalid host specified")
 }
 var gzPool = sync.Pool{
 	New: func() interface{} {
@@ -102,6 +281,40 @@ func NewWebsocketUpgradeHandler(h http.Handler, ws http.Handler) http.Handler {
 		h.ServeHTTP(w, r)
 	})
 }
+type WSOriginChecker func(origin string, r *http.Request) bool
+func newWSOriginHandler(ws http.Handler, allowedOrigins []string, checker WSOriginChecker, writeErr HTTPErrorWriter) http.Handler {
+	origins := make(map[string]struct{})
+	for _, origin := range allowedOrigins {
+		origins[strings.ToLower(origin)] = struct{}{}
+	}
+	if len(origins) == 0 {
+		origins["http://localhost"] = struct{}{}
+		if hostname, err := os.Hostname(); err == nil {
+			origins["http://"+strings.ToLower(hostname)] = struct{}{}
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			ws.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := origins["*"]; ok {
+			ws.ServeHTTP(w, r)
+			return
+		}
+		if _, ok := origins[strings.ToLower(origin)]; ok {
+			ws.ServeHTTP(w, r)
+			return
+		}
+		if checker != nil && checker(origin, r) {
+			ws.ServeHTTP(w, r)
+			return
+		}
+		log.Debug("Rejected WebSocket connection", "origin", origin)
+		writeErr(w, r, http.StatusForbidden, "origin not allowed")
+	})
+}
 func isWebsocket(r *http.Request) bool {
 	return strings.ToLower(r.Header.Get("Upgrade")) == "websocket" &&
 		strings.ToLower(r.Header.Get("Connection")) == "upgrade"
@@ -0,0 +1,532 @@
+package node
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/log"
+)
+const (
+	TaskCheckpoint    = "checkpoint"
+	TaskCompact       = "compact"
+	TaskBackup        = "backup"
+	TaskRotateJournal = "rotate-journal"
+	TaskProfiles      = "profiles"
+	datadirBackups    = "backups"
+	scheduleHorizon   = 366 * 24 * time.Hour
+	taskStopTimeout   = 10 * time.Second
+)
+type ScheduledTaskConfig struct {
+	Name     string            `toml:",omitempty"`
+	Kind     string            `toml:",omitempty"`
+	Schedule string            `toml:",omitempty"`
+	Args     map[string]string `toml:",omitempty"`
+}
+type ScheduledTaskFunc func(ctx context.Context, n *Node, args map[string]string) error
+type ScheduledTaskInfo struct {
+	Name         string            `json:"name"`
+	Kind         string            `json:"kind"`
+	Schedule     string            `json:"schedule"`
+	Args         map[string]string `json:"args,omitempty"`
+	Next         time.Time         `json:"next"`
+	LastRun      *time.Time        `json:"lastRun,omitempty"`
+	LastDuration time.Duration     `json:"lastDuration"`
+	LastError    string            `json:"lastError,omitempty"`
+	Runs         uint64            `json:"runs"`
+	Failures     uint64            `json:"failures"`
+	Skipped      uint64            `json:"skipped"`
+	Running      bool              `json:"running"`
+}
+var (
+	taskKindLock sync.RWMutex
+	taskKinds    = map[string]ScheduledTaskFunc{
+		TaskCheckpoint:    runCheckpointTask,
+		TaskCompact:       runCompactTask,
+		TaskBackup:        runBackupTask,
+		TaskRotateJournal: runRotateJournalTask,
+		TaskProfiles:      runProfilesTask,
+	}
+)
+func RegisterScheduledTaskKind(kind string, fn ScheduledTaskFunc) error {
+	taskKindLock.Lock()
+	defer taskKindLock.Unlock()
+	if _, exists := taskKinds[kind]; exists {
+		return fmt.Errorf("scheduled task kind %q already registered", kind)
+	}
+	taskKinds[kind] = fn
+	return nil
+}
+func lookupTaskKind(kind string) (ScheduledTaskFunc, bool) {
+	taskKindLock.RLock()
+	defer taskKindLock.RUnlock()
+	fn, ok := taskKinds[kind]
+	return fn, ok
+}
+type taskSchedule interface {
+	next(after time.Time) time.Time
+}
+type everySchedule time.Duration
+func (s everySchedule) next(after time.Time) time.Time {
+	return after.Add(time.Duration(s))
+}
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+func (s *cronSchedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	for limit := after.Add(scheduleHorizon); t.Before(limit); t = t.Add(time.Minute) {
+		if s.month&(1<<uint(t.Month())) == 0 || s.hour&(1<<uint(t.Hour())) == 0 || s.minute&(1<<uint(t.Minute())) == 0 {
+			continue
+		}
+		domMatch := s.dom&(1<<uint(t.Day())) != 0
+		dowMatch := s.dow&(1<<uint(t.Weekday())) != 0
+		switch {
+		case s.domAny && s.dowAny, s.dowAny && domMatch, s.domAny && dowMatch:
+			return t
+		case !s.domAny && !s.dowAny && (domMatch || dowMatch):
+			return t
+		}
+	}
+	return time.Time{}
+}
+func parseSchedule(spec string) (taskSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+	if strings.HasPrefix(spec, "@every ") {
+		d, err := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if err != nil {
+			return nil, err
+		}
+		if d < time.Second {
+			return nil, fmt.Errorf("interval %v is below one second", d)
+		}
+		return everySchedule(d), nil
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 cron fields, got %d", len(fields))
+	}
+	bounds := [5][2]int{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 6}}
+	var masks [5]uint64
+	for i, field := range fields {
+		mask, err := parseCronField(field, bounds[i][0], bounds[i][1])
+		if err != nil {
+			return nil, fmt.Errorf("cron field %d (%q): %v", i+1, field, err)
+		}
+		masks[i] = mask
+	}
+	return &cronSchedule{
+		minute: masks[0],
+		hour:   masks[1],
+		dom:    masks[2],
+		month:  masks[3],
+		dow:    masks[4],
+		domAny: fields[2] == "*",
+		dowAny: fields[4] == "*",
+	}, nil
+}
+func parseCronField(field string, min, max int) (uint64, error) {
+	var mask uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+			step, part = s, part[:i]
+		}
+		lo, hi := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bits := strings.SplitN(part, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bits[0]); err != nil {
+				return 0, err
+			}
+			if hi, err = strconv.Atoi(bits[1]); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("range %d-%d outside %d-%d", lo, hi, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			mask |= 1 << uint(v)
+		}
+	}
+	return mask, nil
+}
+func (c *Config) scheduledTasks() ([]*scheduledTask, error) {
+	seen := make(map[string]bool)
+	tasks := make([]*scheduledTask, 0, len(c.ScheduledTasks))
+	for _, conf := range c.ScheduledTasks {
+		if conf.Name == "" {
+			conf.Name = conf.Kind
+		}
+		if seen[conf.Name] {
+			return nil, fmt.Errorf("duplicate scheduled task %q", conf.Name)
+		}
+		seen[conf.Name] = true
+		fn, ok := lookupTaskKind(conf.Kind)
+		if !ok {
+			return nil, fmt.Errorf("scheduled task %q: unknown kind %q", conf.Name, conf.Kind)
+		}
+		schedule, err := parseSchedule(conf.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("scheduled task %q: invalid schedule %q: %v", conf.Name, conf.Schedule, err)
+		}
+		tasks = append(tasks, &scheduledTask{conf: conf, schedule: schedule, fn: fn})
+	}
+	return tasks, nil
+}
+type scheduledTask struct {
+	conf     ScheduledTaskConfig
+	schedule taskSchedule
+	fn       ScheduledTaskFunc
+	next     time.Time
+	lastRun  time.Time
+	lastDur  time.Duration
+	lastErr  error
+	runs     uint64
+	failures uint64
+	skipped  uint64
+	running  bool
+}
+type taskScheduler struct {
+	node   *Node
+	tasks  []*scheduledTask
+	clock  Clock
+	log    log.Logger
+	lock   sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+func newTaskScheduler(n *Node, tasks []*scheduledTask) *taskScheduler {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &taskScheduler{
+		node:   n,
+		tasks:  tasks,
+		clock:  n.clock,
+		log:    n.log,
+		ctx:    ctx,
+		cancel: cancel,
+		quit:   make(chan struct{}),
+	}
+}
+func (s *taskScheduler) start() {
+	if s == nil {
+		return
+	}
+	now := s.clock.Now()
+	for _, task := range s.tasks {
+		task.next = task.schedule.next(now)
+	}
+	s.wg.Add(1)
+	go s.loop()
+}
+func (s *taskScheduler) stop() {
+	if s == nil {
+		return
+	}
+	close(s.quit)
+	s.cancel()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	timer := s.clock.NewTimer(taskStopTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C():
+		var running []string
+		s.lock.Lock()
+		for _, task := range s.tasks {
+			if task.running {
+				running = append(running, task.conf.Name)
+			}
+		}
+		s.lock.Unlock()
+		s.log.Warn("Scheduled tasks still running after stop", "tasks", running, "timeout", taskStopTimeout)
+	}
+}
+func (s *taskScheduler) loop() {
+	defer s.wg.Done()
+	for {
+		s.lock.Lock()
+		var earliest time.Time
+		for _, task := range s.tasks {
+			if !task.next.IsZero() && (earliest.IsZero() || task.next.Before(earliest)) {
+				earliest = task.next
+			}
+		}
+		s.lock.Unlock()
+		var (
+			timer Timer
+			fire  <-chan time.Time
+		)
+		if !earliest.IsZero() {
+			timer = s.clock.NewTimer(earliest.Sub(s.clock.Now()))
+			fire = timer.C()
+		}
+		select {
+		case <-fire:
+		case <-s.quit:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+		now := s.clock.Now()
+		s.lock.Lock()
+		for _, task := range s.tasks {
+			if task.next.IsZero() || task.next.After(now) {
+				continue
+			}
+			task.next = task.schedule.next(now)
+			s.dispatch(task)
+		}
+		s.lock.Unlock()
+	}
+}
+func (s *taskScheduler) dispatch(task *scheduledTask) {
+	if task.running {
+		task.skipped++
+		s.log.Warn("Skipping scheduled task, previous run still active", "task", task.conf.Name)
+		return
+	}
+	task.running = true
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		start := s.clock.Now()
+		err := task.fn(s.ctx, s.node, task.conf.Args)
+		elapsed := s.clock.Now().Sub(start)
+		s.lock.Lock()
+		task.running = false
+		task.lastRun, task.lastDur, task.lastErr = start, elapsed, err
+		task.runs++
+		if err != nil {
+			task.failures++
+		}
+		s.lock.Unlock()
+		if err != nil {
+			s.log.Warn("Scheduled task failed", "task", task.conf.Name, "kind", task.conf.Kind, "elapsed", elapsed, "err", err)
+		} else {
+			s.log.Info("Scheduled task completed", "task", task.conf.Name, "kind", task.conf.Kind, "elapsed", elapsed)
+		}
+	}()
+}
+func (s *taskScheduler) runNow(name string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, task := range s.tasks {
+		if task.conf.Name == name {
+			if task.running {
+				return fmt.Errorf("scheduled task %q is already running", name)
+			}
+			s.dispatch(task)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown scheduled task %q", name)
+}
+func (s *taskScheduler) info() []ScheduledTaskInfo {
+	if s == nil {
+		return nil
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	infos := make([]ScheduledTaskInfo, 0, len(s.tasks))
+	for _, task := range s.tasks {
+		info := ScheduledTaskInfo{
+			Name:         task.conf.Name,
+			Kind:         task.conf.Kind,
+			Schedule:     task.conf.Schedule,
+			Args:         task.conf.Args,
+			Next:         task.next,
+			LastDuration: task.lastDur,
+			Runs:         task.runs,
+			Failures:     task.failures,
+			Skipped:      task.skipped,
+			Running:      task.running,
+		}
+		if !task.lastRun.IsZero() {
+			last := task.lastRun
+			info.LastRun = &last
+		}
+		if task.lastErr != nil {
+			info.LastError = task.lastErr.Error()
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+func runCheckpointTask(ctx context.Context, n *Node, args map[string]string) error {
+	n.checkpointDatabases()
+	return nil
+}
+func runCompactTask(ctx context.Context, n *Node, args map[string]string) error {
+	var failed []string
+	for _, db := range n.openDatabases() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if name := args["database"]; name != "" && name != db.name {
+			continue
+		}
+		n.log.Info("Compacting database", "database", db.name)
+		if err := db.Compact(nil, nil); err != nil {
+			n.log.Warn("Database compaction failed", "database", db.name, "err", err)
+			failed = append(failed, db.name)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("compaction failed for %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+func runRotateJournalTask(ctx context.Context, n *Node, args map[string]string) error {
+	return n.journal.rotateNow()
+}
+func runProfilesTask(ctx context.Context, n *Node, args map[string]string) error {
+	var types []string
+	if args["types"] != "" {
+		types = strings.Split(args["types"], ",")
+	}
+	var cpu time.Duration
+	if args["cpu"] != "" {
+		d, err := time.ParseDuration(args["cpu"])
+		if err != nil {
+			return err
+		}
+		cpu = d
+	}
+	_, err := n.writeProfiles(ctx, types, args["dir"], cpu)
+	return err
+}
+func runBackupTask(ctx context.Context, n *Node, args map[string]string) error {
+	dir := args["dir"]
+	if dir == "" {
+		dir = datadirBackups
+	}
+	if dir = n.config.ResolvePath(dir); dir == "" {
+		return fmt.Errorf("relative backup directory %q requires a datadir", args["dir"])
+	}
+	target := filepath.Join(dir, "backup-"+n.clock.Now().UTC().Format("20060102T150405Z"))
+	if err := os.MkdirAll(filepath.Join(target, datadirDefaultKeyStore), 0700); err != nil {
+		return err
+	}
+	_, _, keydir, err := n.config.AccountConfig()
+	if err != nil {
+		return err
+	}
+	if keydir != "" && n.ephemeralKeystore == "" {
+		infos, err := ioutil.ReadDir(keydir)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		for _, fi := range infos {
+			if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := copyFile(filepath.Join(keydir, fi.Name()), filepath.Join(target, datadirDefaultKeyStore, fi.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	for _, name := range []string{datadirPrivateKey, datadirStaticNodes, datadirTrustedNodes} {
+		src := n.config.ResolvePath(name)
+		if src == "" {
+			continue
+		}
+		if err := copyFile(src, filepath.Join(target, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	n.log.Info("Wrote node backup", "dir", target, "databases", "excluded")
+	if keep, err := strconv.Atoi(args["keep"]); err == nil && keep > 0 {
+		pruneBackups(dir, keep, n.log)
+	}
+	return nil
+}
+func copyFile(src, dst string) error {
+	blob, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, blob, 0600)
+}
+func pruneBackups(dir string, keep int, logger log.Logger) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	var backups []string
+	for _, fi := range infos {
+		if fi.IsDir() && strings.HasPrefix(fi.Name(), "backup-") {
+			backups = append(backups, fi.Name())
+		}
+	}
+	sort.Strings(backups)
+	for len(backups) > keep {
+		path := filepath.Join(dir, backups[0])
+		if err := os.RemoveAll(path); err != nil {
+			logger.Warn("Failed to prune old backup", "dir", path, "err", err)
+		}
+		backups = backups[1:]
+	}
+}
+func (n *Node) ScheduledTasks() []ScheduledTaskInfo {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return n.scheduler.info()
+}
+func (n *Node) RunScheduledTask(name string) error {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	if n.server == nil {
+		return ErrNodeStopped
+	}
+	if n.scheduler == nil {
+		return fmt.Errorf("unknown scheduled task %q", name)
+	}
+	return n.scheduler.runNow(name)
+}
@@ -0,0 +1,235 @@
+package node
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+)
+const (
+	encryptedValuePrefix = "enc:v1:"
+	DefaultConfigKeyEnv  = "NODE_CONFIG_KEY"
+)
+type ConfigKeyProvider interface {
+	ConfigKey() ([]byte, error)
+}
+type ConfigKeyFunc func() ([]byte, error)
+func (f ConfigKeyFunc) ConfigKey() ([]byte, error) {
+	return f()
+}
+type EnvConfigKeyProvider struct {
+	Var string
+}
+func (p *EnvConfigKeyProvider) ConfigKey() ([]byte, error) {
+	v, ok := os.LookupEnv(p.Var)
+	if !ok {
+		return nil, fmt.Errorf("config key environment variable %s not set", p.Var)
+	}
+	return parseConfigKey(v)
+}
+type FileConfigKeyProvider struct {
+	Path string
+}
+func (p *FileConfigKeyProvider) ConfigKey() ([]byte, error) {
+	blob, err := ioutil.ReadFile(p.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config key file: %v", err)
+	}
+	return parseConfigKey(string(blob))
+}
+func parseConfigKey(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	key, err := hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	if err != nil {
+		if key, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return nil, ErrInvalidConfigKey
+		}
+	}
+	if len(key) != 32 {
+		return nil, ErrInvalidConfigKey
+	}
+	return key, nil
+}
+func IsEncryptedValue(value string) bool {
+	return strings.HasPrefix(value, encryptedValuePrefix)
+}
+func EncryptConfigValue(key []byte, plaintext string) (string, error) {
+	aead, err := newConfigCipher(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(encryptedValuePrefix))
+	return encryptedValuePrefix + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+func DecryptConfigValue(key []byte, value string) (string, error) {
+	if !IsEncryptedValue(value) {
+		return value, nil
+	}
+	aead, err := newConfigCipher(key)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(value, encryptedValuePrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrInvalidEncryptedValue
+	}
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(encryptedValuePrefix))
+	if err != nil {
+		return "", ErrInvalidEncryptedValue
+	}
+	return string(plain), nil
+}
+func newConfigCipher(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, ErrInvalidConfigKey
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+func (c *Config) configKeyProvider() ConfigKeyProvider {
+	switch {
+	case c.ConfigKeyProvider != nil:
+		return c.ConfigKeyProvider
+	case c.ConfigKeyFile != "":
+		return &FileConfigKeyProvider{Path: c.ConfigKeyFile}
+	case c.ConfigKeyEnv != "":
+		return &EnvConfigKeyProvider{Var: c.ConfigKeyEnv}
+	default:
+		return &EnvConfigKeyProvider{Var: DefaultConfigKeyEnv}
+	}
+}
+func (c *Config) DecryptValues() error {
+	var (
+		provider  = c.configKeyProvider()
+		key       []byte
+		decrypted = make(map[string]bool)
+	)
+	decrypt := func(name, value string) (string, error) {
+		if key == nil {
+			k, err := provider.ConfigKey()
+			if err != nil {
+				return "", fmt.Errorf("config field %s is encrypted: %v", name, err)
+			}
+			key = k
+		}
+		plain, err := DecryptConfigValue(key, value)
+		if err != nil {
+			return "", fmt.Errorf("config field %s: %v", name, err)
+		}
+		decrypted[name] = true
+		return plain, nil
+	}
+	if err := decryptFields(reflect.ValueOf(c).Elem(), "", decrypt); err != nil {
+		return err
+	}
+	if len(decrypted) > 0 {
+		c.decryptedFields = decrypted
+	}
+	return nil
+}
+func decryptFields(v reflect.Value, path string, decrypt func(name, value string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.String:
+		if !IsEncryptedValue(v.String()) {
+			return nil
+		}
+		plain, err := decrypt(path, v.String())
+		if err != nil {
+			return err
+		}
+		v.SetString(plain)
+	case reflect.Ptr:
+		if v.IsNil() || !holdsEncryptedValue(v.Elem()) {
+			return nil
+		}
+		clone := reflect.New(v.Elem().Type())
+		clone.Elem().Set(v.Elem())
+		if err := decryptFields(clone.Elem(), path, decrypt); err != nil {
+			return err
+		}
+		v.Set(clone)
+	case reflect.Slice:
+		if !holdsEncryptedValue(v) {
+			return nil
+		}
+		clone := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(clone, v)
+		for i := 0; i < clone.Len(); i++ {
+			if err := decryptFields(clone.Index(i), fmt.Sprintf("%s[%d]", path, i), decrypt); err != nil {
+				return err
+			}
+		}
+		v.Set(clone)
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String || !holdsEncryptedValue(v) {
+			return nil
+		}
+		clone := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			value := reflect.New(v.Type().Elem()).Elem()
+			value.Set(iter.Value())
+			if err := decryptFields(value, fmt.Sprintf("%s[%v]", path, iter.Key()), decrypt); err != nil {
+				return err
+			}
+			clone.SetMapIndex(iter.Key(), value)
+		}
+		v.Set(clone)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := field.Name
+			if path != "" {
+				name = path + "." + name
+			}
+			if err := decryptFields(v.Field(i), name, decrypt); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+func holdsEncryptedValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return IsEncryptedValue(v.String())
+	case reflect.Ptr:
+		return !v.IsNil() && holdsEncryptedValue(v.Elem())
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if holdsEncryptedValue(v.Index(i)) {
+				return true
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if holdsEncryptedValue(iter.Value()) {
+				return true
+			}
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).PkgPath == "" && holdsEncryptedValue(v.Field(i)) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,223 @@
+package node
+import (
+	"crypto/rand"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"time"
+	"github.com/Cryptochain-VON/crypto"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+const (
+	selfTestDiskWrites     = 10
+	selfTestMaxDiskLatency = 100 * time.Millisecond
+	selfTestSignOps        = 200
+	selfTestMinSignRate    = 500
+	selfTestMaxKDFTime     = 5 * time.Second
+	selfTestDialTimeout    = 3 * time.Second
+	selfTestMinYear        = 2020
+)
+type SelfTestCheck struct {
+	Name     string        `json:"name"`
+	OK       bool          `json:"ok"`
+	Duration time.Duration `json:"duration"`
+	Detail   string        `json:"detail,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+type SelfTestReport struct {
+	OK      bool            `json:"ok"`
+	Started time.Time       `json:"started"`
+	Elapsed time.Duration   `json:"elapsed"`
+	Checks  []SelfTestCheck `json:"checks"`
+}
+func (r *SelfTestReport) run(name string, check func() (string, error)) {
+	start := time.Now()
+	detail, err := check()
+	result := SelfTestCheck{Name: name, OK: err == nil, Duration: time.Since(start), Detail: detail}
+	if err != nil {
+		result.Error = err.Error()
+		r.OK = false
+	}
+	r.Checks = append(r.Checks, result)
+}
+func (n *Node) SelfTest() *SelfTestReport {
+	n.lock.RLock()
+	running := n.server != nil
+	var targets map[string]string
+	if running {
+		targets = n.selfTestTargets()
+	}
+	n.lock.RUnlock()
+	report := &SelfTestReport{OK: true, Started: n.clock.Now()}
+	if n.config.DataDir != "" {
+		report.run("disk-latency", func() (string, error) { return checkDiskLatency(n.config.instanceDir()) })
+	}
+	report.run("clock", n.checkClockSanity)
+	report.run("crypto-speed", checkCryptoSpeed)
+	if running {
+		for _, name := range []string{"http", "ws", "graphql", "admin", "p2p"} {
+			if addr, ok := targets[name]; ok {
+				report.run(name+"-reachable", func() (string, error) { return addr, checkReachable(addr) })
+			}
+		}
+	} else {
+		if n.httpEndpoint != "" {
+			report.run("http-port", func() (string, error) { return n.httpEndpoint, checkPortAvailable(n.httpEndpoint) })
+		}
+		if n.wsEndpoint != "" && !n.wsSharesHTTP() {
+			report.run("ws-port", func() (string, error) { return n.wsEndpoint, checkPortAvailable(n.wsEndpoint) })
+		}
+		if addr := n.config.P2P.ListenAddr; addr != "" && !n.config.NoP2P {
+			report.run("p2p-port", func() (string, error) { return addr, checkPortAvailable(addr) })
+		}
+	}
+	report.run("keystore-scrypt", n.checkScryptSpeed)
+	if format, _ := n.config.keyStoreFormat(); format == KeyStoreFormatV4 {
+		report.run("keystore-argon2id", n.checkArgon2Speed)
+	}
+	report.Elapsed = n.clock.Now().Sub(report.Started)
+	return report
+}
+func (n *Node) selfTestTargets() map[string]string {
+	targets := make(map[string]string)
+	info := n.endpointsInfo()
+	for name, ep := range map[string]*EndpointInfo{"http": info.HTTP, "ws": info.WS, "graphql": info.GraphQL, "admin": info.Admin} {
+		if ep == nil {
+			continue
+		}
+		if u, err := url.Parse(ep.URL); err == nil && u.Host != "" {
+			targets[name] = u.Host
+		}
+	}
+	if !n.config.NoP2P && !n.p2pPending() && n.server.ListenAddr != "" {
+		if _, port, err := net.SplitHostPort(n.server.ListenAddr); err == nil && port != "0" {
+			targets["p2p"] = n.server.ListenAddr
+		}
+	}
+	return targets
+}
+func checkDiskLatency(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	f, err := ioutil.TempFile(dir, ".selftest")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	block := make([]byte, 4096)
+	var total, worst time.Duration
+	for i := 0; i < selfTestDiskWrites; i++ {
+		start := time.Now()
+		if _, err := f.Write(block); err != nil {
+			return "", err
+		}
+		if err := f.Sync(); err != nil {
+			return "", err
+		}
+		elapsed := time.Since(start)
+		total += elapsed
+		if elapsed > worst {
+			worst = elapsed
+		}
+	}
+	avg := total / selfTestDiskWrites
+	detail := fmt.Sprintf("avg %v, max %v per synced 4KiB write", avg, worst)
+	if avg > selfTestMaxDiskLatency {
+		return detail, fmt.Errorf("average synced write latency %v exceeds %v", avg, selfTestMaxDiskLatency)
+	}
+	return detail, nil
+}
+func (n *Node) checkClockSanity() (string, error) {
+	now := n.clock.Now()
+	if now.Year() < selfTestMinYear {
+		return now.String(), fmt.Errorf("implausible system time %v", now)
+	}
+	if len(n.config.NTPServers) == 0 {
+		return "no NTP servers configured, drift not measured", nil
+	}
+	threshold, _ := n.config.ntpSettings()
+	var err error
+	for _, server := range n.config.NTPServers {
+		var drift time.Duration
+		if drift, err = sntpDrift(server); err != nil {
+			continue
+		}
+		detail := fmt.Sprintf("drift %v against %s", drift, server)
+		if drift < -threshold || drift > threshold {
+			return detail, fmt.Errorf("clock drift %v exceeds threshold %v", drift, threshold)
+		}
+		return detail, nil
+	}
+	return "", err
+}
+func checkCryptoSpeed() (string, error) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+	defer zeroKeyV4(key)
+	start := time.Now()
+	for i := 0; i < selfTestSignOps; i++ {
+		hash := crypto.Keccak256([]byte{byte(i), byte(i >> 8)})
+		if _, err := crypto.Sign(hash, key); err != nil {
+			return "", err
+		}
+	}
+	rate := float64(selfTestSignOps) / time.Since(start).Seconds()
+	detail := fmt.Sprintf("%.0f secp256k1 signatures/s", rate)
+	if rate < selfTestMinSignRate {
+		return detail, fmt.Errorf("signing rate %.0f/s below %d/s", rate, selfTestMinSignRate)
+	}
+	return detail, nil
+}
+func checkReachable(addr string) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, port), selfTestDialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+func (n *Node) checkScryptSpeed() (string, error) {
+	scryptN, scryptP, _, err := n.config.AccountConfig()
+	if err != nil {
+		return "", err
+	}
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	start := time.Now()
+	if _, err := scrypt.Key([]byte("selftest"), salt, scryptN, 8, scryptP, 32); err != nil {
+		return "", err
+	}
+	return kdfResult(fmt.Sprintf("scrypt N=%d p=%d", scryptN, scryptP), time.Since(start))
+}
+func (n *Node) checkArgon2Speed() (string, error) {
+	params := n.config.argon2Params()
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	start := time.Now()
+	argon2.IDKey([]byte("selftest"), salt, params.Time, params.Memory, params.Threads, 32)
+	return kdfResult(fmt.Sprintf("argon2id t=%d m=%dKiB p=%d", params.Time, params.Memory, params.Threads), time.Since(start))
+}
+func kdfResult(kdf string, elapsed time.Duration) (string, error) {
+	detail := fmt.Sprintf("%s decrypt in %v", kdf, elapsed)
+	if elapsed > selfTestMaxKDFTime {
+		return detail, fmt.Errorf("key derivation took %v, exceeding %v", elapsed, selfTestMaxKDFTime)
+	}
+	return detail, nil
+}
@@ -1,27 +1,52 @@
 package node
 import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
 	"path/filepath"
 	"reflect"
+	"time"
 	"github.com/Cryptochain-VON/accounts"
 	"github.com/Cryptochain-VON/core/rawdb"
 	"github.com/Cryptochain-VON/ethdb"
 	"github.com/Cryptochain-VON/event"
+	"github.com/Cryptochain-VON/log"
 	"github.com/Cryptochain-VON/p2p"
+	"github.com/Cryptochain-VON/p2p/enode"
 	"github.com/Cryptochain-VON/rpc"
 )
+type serviceKey struct {
+	kind     reflect.Type
+	instance string
+}
+func (k serviceKey) String() string {
+	if k.instance == "" {
+		return k.kind.String()
+	}
+	return k.kind.String() + "#" + k.instance
+}
 type ServiceContext struct {
-	services       map[reflect.Type]Service 
+	node           *Node
+	owner          *serviceKey
+	services       map[serviceKey]Service 
 	Config         Config
 	EventMux       *event.TypeMux    
 	AccountManager *accounts.Manager 
 }
 func (ctx *ServiceContext) OpenDatabase(name string, cache int, handles int, namespace string) (ethdb.Database, error) {
+	if ctx.node != nil {
+		return ctx.node.openDatabase(ctx.owner, name, cache, handles, namespace)
+	}
 	if ctx.Config.DataDir == "" {
 		return rawdb.NewMemoryDatabase(), nil
 	}
 	return rawdb.NewLevelDBDatabase(ctx.Config.ResolvePath(name), cache, handles, namespace)
 }
 func (ctx *ServiceContext) OpenDatabaseWithFreezer(name string, cache int, handles int, freezer string, namespace string) (ethdb.Database, error) {
+	if ctx.node != nil {
+		return ctx.node.openDatabaseWithFreezer(ctx.owner, name, cache, handles, freezer, namespace)
+	}
 	if ctx.Config.DataDir == "" {
 		return rawdb.NewMemoryDatabase(), nil
 	}
@@ -34,24 +59,135 @@ func (ctx *ServiceContext) OpenDatabaseWithFreezer(name string, cache int, handl
 	}
 	return rawdb.NewLevelDBDatabaseWithFreezer(root, cache, handles, freezer, namespace)
 }
+func (ctx *ServiceContext) AddDatabaseHooks(hooks DatabaseHooks) {
+	if ctx.node != nil {
+		ctx.node.AddDatabaseHooks(hooks)
+	}
+}
 func (ctx *ServiceContext) ResolvePath(path string) string {
 	return ctx.Config.ResolvePath(path)
 }
 func (ctx *ServiceContext) Service(service interface{}) error {
+	return ctx.ServiceInstance("", service)
+}
+func (ctx *ServiceContext) ServiceInstance(instance string, service interface{}) error {
 	element := reflect.ValueOf(service).Elem()
-	if running, ok := ctx.services[element.Type()]; ok {
+	if running, ok := ctx.services[serviceKey{element.Type(), instance}]; ok {
 		element.Set(reflect.ValueOf(running))
 		return nil
 	}
 	return ErrServiceUnknown
 }
+func (ctx *ServiceContext) Passphrase(account accounts.Account) (string, error) {
+	provider := ctx.Config.passphraseProvider()
+	if provider == nil {
+		return "", ErrNoPassphraseProvider
+	}
+	return provider.Passphrase(account)
+}
+func (ctx *ServiceContext) StartGraphQLEndpoint(handler http.Handler) (*http.Server, net.Addr, error) {
+	if ctx.node == nil {
+		return nil, nil, ErrNodeStopped
+	}
+	return ctx.node.StartGraphQLEndpoint(handler)
+}
+func (ctx *ServiceContext) FeatureEnabled(name string) bool {
+	if ctx.node != nil {
+		return ctx.node.FeatureEnabled(name)
+	}
+	if enabled, ok := ctx.Config.FeatureFlags[name]; ok {
+		return enabled
+	}
+	flag, _ := lookupFeatureFlag(name)
+	return flag.Default
+}
+func (ctx *ServiceContext) NewSubscriptionBuffer(notifier *rpc.Notifier, sub *rpc.Subscription) *SubscriptionBuffer {
+	if ctx.node != nil {
+		return ctx.node.NewSubscriptionBuffer(notifier, sub)
+	}
+	return newSubscriptionBuffer(&ctx.Config, new(subscriptionCounters), nil, notifier, sub)
+}
+func (ctx *ServiceContext) ReportPeer(id enode.ID, metric string, value float64) {
+	if ctx.node != nil {
+		ctx.node.ReportPeer(id, metric, value)
+	}
+}
+func (ctx *ServiceContext) Logger(name string) log.Logger {
+	if ctx.node != nil {
+		return ctx.node.log.New("service", name)
+	}
+	return ctx.Config.logger().New("service", name)
+}
+func (ctx *ServiceContext) Clock() Clock {
+	if ctx.node != nil {
+		return ctx.node.clock
+	}
+	return ctx.Config.clock()
+}
 func (ctx *ServiceContext) ExtRPCEnabled() bool {
 	return ctx.Config.ExtRPCEnabled()
 }
 type ServiceConstructor func(ctx *ServiceContext) (Service, error)
+type serviceFunc struct {
+	instance    string
+	constructor ServiceConstructor
+}
 type Service interface {
 	Protocols() []p2p.Protocol
 	APIs() []rpc.API
 	Start(server *p2p.Server) error
 	Stop() error
 }
+type Drainer interface {
+	Drain(ctx context.Context) error
+}
+type NodeDrainingEvent struct {
+	Deadline time.Time
+}
+type HealthChecker interface {
+	Health() error
+}
+const (
+	ServiceHealthy   = "healthy"
+	ServiceUnhealthy = "unhealthy"
+	ServiceUnknown   = "unknown"
+)
+type ServiceInfo struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Instance    string    `json:"instance,omitempty"`
+	Protocols   []string  `json:"protocols"`
+	APIs        []string  `json:"apis"`
+	Started     time.Time `json:"started"`
+	Health      string    `json:"health"`
+	HealthError string    `json:"healthError,omitempty"`
+}
+func newServiceInfo(kind serviceKey, service Service, started time.Time) ServiceInfo {
+	info := ServiceInfo{
+		Name:      kind.String(),
+		Type:      kind.kind.String(),
+		Instance:  kind.instance,
+		Protocols: []string{},
+		APIs:      []string{},
+		Started:   started,
+		Health:    ServiceUnknown,
+	}
+	for _, proto := range service.Protocols() {
+		info.Protocols = append(info.Protocols, fmt.Sprintf("%s/%d", proto.Name, proto.Version))
+	}
+	seen := make(map[string]bool)
+	for _, api := range service.APIs() {
+		if !seen[api.Namespace] {
+			seen[api.Namespace] = true
+			info.APIs = append(info.APIs, api.Namespace)
+		}
+	}
+	if checker, ok := service.(HealthChecker); ok {
+		if err := checker.Health(); err != nil {
+			info.Health, info.HealthError = ServiceUnhealthy, err.Error()
+		} else {
+			info.Health = ServiceHealthy
+		}
+	}
+	return info
+}
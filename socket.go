@@ -0,0 +1,35 @@
+package node
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"time"
+	"github.com/Cryptochain-VON/log"
+)
+const socketProbeTimeout = time.Second
+func clearStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return &ErrSocketInUse{Path: path, Err: errors.New("path exists and is not a socket")}
+	}
+	conn, err := net.DialTimeout("unix", path, socketProbeTimeout)
+	if err == nil {
+		conn.Close()
+		return &ErrSocketInUse{Path: path, Err: errors.New("socket is accepting connections")}
+	}
+	if !errors.Is(err, syscall.ECONNREFUSED) && !errors.Is(err, syscall.ENOENT) {
+		return &ErrSocketInUse{Path: path, Err: err}
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	log.Info("Removed stale unix socket", "path", path)
+	return nil
+}
@@ -0,0 +1,124 @@
+package node
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+const NodeStartingErrorCode = -32002
+type standbyStatus struct {
+	lock  sync.RWMutex
+	stage string
+	began time.Time
+	clock Clock
+}
+func (s *standbyStatus) set(stage string) {
+	s.lock.Lock()
+	s.stage = stage
+	s.lock.Unlock()
+}
+func (s *standbyStatus) snapshot() (string, time.Duration) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.stage, s.clock.Now().Sub(s.began)
+}
+type standbyHandler struct {
+	status *standbyStatus
+	lock   sync.RWMutex
+	next   http.Handler
+}
+func (h *standbyHandler) activate(next http.Handler) {
+	h.lock.Lock()
+	h.next = next
+	h.lock.Unlock()
+}
+func (h *standbyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.lock.RLock()
+	next := h.next
+	h.lock.RUnlock()
+	if next != nil {
+		next.ServeHTTP(w, r)
+		return
+	}
+	type startingData struct {
+		Stage   string `json:"stage,omitempty"`
+		Elapsed string `json:"elapsed"`
+	}
+	type startingError struct {
+		Code    int          `json:"code"`
+		Message string       `json:"message"`
+		Data    startingData `json:"data"`
+	}
+	type startingResponse struct {
+		Version string        `json:"jsonrpc"`
+		ID      interface{}   `json:"id"`
+		Error   startingError `json:"error"`
+	}
+	stage, elapsed := h.status.snapshot()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", strconv.Itoa(1))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(startingResponse{
+		Version: "2.0",
+		Error: startingError{
+			Code:    NodeStartingErrorCode,
+			Message: "node starting",
+			Data:    startingData{Stage: stage, Elapsed: elapsed.Round(time.Millisecond).String()},
+		},
+	})
+}
+type preboundEndpoint struct {
+	endpoint string
+	server   *http.Server
+	addr     net.Addr
+	handler  *standbyHandler
+}
+func (n *Node) prebindEndpoints() error {
+	if !n.config.RPCPrebind {
+		return nil
+	}
+	n.standby = &standbyStatus{began: n.clock.Now(), clock: n.clock}
+	n.prebound = make(map[string]*preboundEndpoint)
+	if n.httpEndpoint != "" {
+		tlsConfig, err := n.serverTLSConfig(n.httpEndpoint, n.config.HTTPTLSCert, n.config.HTTPTLSKey)
+		if err != nil {
+			return err
+		}
+		handler := &standbyHandler{status: n.standby}
+		server, addr, err := startHTTPEndpoint(n.httpEndpoint, n.config.HTTPTimeouts, tlsConfig, n.config.RPCMaxConnections, handler)
+		if err != nil {
+			return err
+		}
+		n.prebound["http"] = &preboundEndpoint{endpoint: n.httpEndpoint, server: server, addr: addr, handler: handler}
+		n.log.Info("HTTP endpoint pre-bound, serving standby", "addr", addr)
+	}
+	if n.wsEndpoint != "" && !n.wsSharesHTTP() {
+		handler := &standbyHandler{status: n.standby}
+		server, addr, err := startWSEndpoint(n.wsEndpoint, n.config.WSTimeouts, n.config.RPCMaxConnections, handler)
+		if err != nil {
+			n.releasePrebound()
+			return err
+		}
+		n.prebound["ws"] = &preboundEndpoint{endpoint: n.wsEndpoint, server: server, addr: addr, handler: handler}
+		n.log.Info("WebSocket endpoint pre-bound, serving standby", "addr", addr)
+	}
+	return nil
+}
+func (n *Node) takePrebound(kind, endpoint string) *preboundEndpoint {
+	pb := n.prebound[kind]
+	if pb == nil || pb.endpoint != endpoint {
+		return nil
+	}
+	delete(n.prebound, kind)
+	return pb
+}
+func (n *Node) releasePrebound() {
+	for kind, pb := range n.prebound {
+		pb.server.Close()
+		n.log.Info("Pre-bound endpoint closed", "kind", kind, "addr", pb.addr)
+	}
+	n.prebound = nil
+	n.standby = nil
+}
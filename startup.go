@@ -0,0 +1,116 @@
+package node
+import (
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/p2p"
+)
+const (
+	StartupDatadirOpened  = "datadir-opened"
+	StartupServiceCreated = "service-created"
+	StartupP2PListening   = "p2p-listening"
+	StartupServiceStarted = "service-started"
+	StartupEndpointBound  = "endpoint-bound"
+	StartupComplete       = "complete"
+	StartupFailed         = "failed"
+)
+type StartupEvent struct {
+	Stage   string        `json:"stage"`
+	Detail  string        `json:"detail,omitempty"`
+	Time    time.Time     `json:"time"`
+	Elapsed time.Duration `json:"elapsed"`
+}
+func (n *Node) resetStartupReport() {
+	n.startupBegin = n.clock.Now()
+	n.startupReport = nil
+}
+func (n *Node) reportStartup(stage, detail string) {
+	now := n.clock.Now()
+	ev := StartupEvent{Stage: stage, Detail: detail, Time: now, Elapsed: now.Sub(n.startupBegin)}
+	n.startupReport = append(n.startupReport, ev)
+	if n.standby != nil {
+		n.standby.set(stage)
+	}
+	n.log.Debug("Startup progress", "stage", stage, "detail", detail, "elapsed", ev.Elapsed)
+	n.startupNotify.post(ev)
+}
+type startupNotifier struct {
+	fn      func(StartupEvent)
+	lock    sync.Mutex
+	queue   []StartupEvent
+	running bool
+}
+func newStartupNotifier(fn func(StartupEvent)) *startupNotifier {
+	if fn == nil {
+		return nil
+	}
+	return &startupNotifier{fn: fn}
+}
+func (sn *startupNotifier) post(ev StartupEvent) {
+	if sn == nil {
+		return
+	}
+	sn.lock.Lock()
+	defer sn.lock.Unlock()
+	sn.queue = append(sn.queue, ev)
+	if !sn.running {
+		sn.running = true
+		go sn.deliver()
+	}
+}
+func (sn *startupNotifier) deliver() {
+	for {
+		sn.lock.Lock()
+		if len(sn.queue) == 0 {
+			sn.running = false
+			sn.lock.Unlock()
+			return
+		}
+		ev := sn.queue[0]
+		sn.queue = sn.queue[1:]
+		sn.lock.Unlock()
+		sn.fn(ev)
+	}
+}
+func (n *Node) StartupReport() []StartupEvent {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return append([]StartupEvent(nil), n.startupReport...)
+}
+func (n *Node) rollbackStart(failure *StartError, dbs []*sharedDatabase, running *p2p.Server, order, started []serviceKey, services map[serviceKey]Service) error {
+	stopErrs := n.stopServices(started, services)
+	failed, _ := failure.Err.(*ServiceError)
+	for i, kind := range order {
+		result := &ServiceStartResult{Kind: kind.kind, Instance: kind.instance, Status: ServiceStatusConstructed}
+		switch {
+		case i < len(started):
+			result.Status, result.StopErr = ServiceStatusRolledBack, stopErrs[kind]
+		case failed != nil && failed.Op == "start" && failed.Kind == kind.kind && failed.Instance == kind.instance:
+			result.Status, result.Err = ServiceStatusFailed, failed.Err
+		}
+		failure.Services = append(failure.Services, result)
+	}
+	switch err := failure.Err.(type) {
+	case *ServiceError:
+		if err.Op == "construct" {
+			failure.Services = append(failure.Services, &ServiceStartResult{Instance: err.Instance, Status: ServiceStatusFailed, Err: err.Err})
+		}
+	case *DuplicateServiceError:
+		failure.Services = append(failure.Services, &ServiceStartResult{Kind: err.Kind, Instance: err.Instance, Status: ServiceStatusFailed, Err: err})
+	}
+	n.stopGraphQL()
+	if running != nil {
+		running.Stop()
+	}
+	stalled := make(map[serviceKey]bool)
+	for kind, err := range stopErrs {
+		if err == ErrServiceStopTimeout {
+			stalled[kind] = true
+		}
+	}
+	n.closeDatabasesExcept(dbs, stalled)
+	n.restoreGCSettings()
+	n.releaseDataDir()
+	n.log.Error("Node start failed, rolled back", "stage", failure.Stage, "err", failure.Err, "rolledBack", len(started))
+	n.reportStartup(StartupFailed, failure.Error())
+	return failure
+}
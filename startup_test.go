@@ -0,0 +1,283 @@
+package node
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"strconv"
+	"testing"
+	"time"
+	"github.com/Cryptochain-VON/crypto"
+	"github.com/Cryptochain-VON/ethdb"
+	"github.com/Cryptochain-VON/p2p"
+	"github.com/Cryptochain-VON/rpc"
+	"github.com/prometheus/tsdb/fileutil"
+)
+var rollbackServiceType = reflect.TypeOf(new(rollbackService))
+type rollbackService struct {
+	startErr error
+	started  bool
+	stopped  bool
+}
+func (s *rollbackService) Protocols() []p2p.Protocol { return nil }
+func (s *rollbackService) APIs() []rpc.API           { return nil }
+func (s *rollbackService) Start(*p2p.Server) error {
+	s.started = true
+	return s.startErr
+}
+func (s *rollbackService) Stop() error {
+	s.stopped = true
+	return nil
+}
+type rollbackTest struct {
+	t        *testing.T
+	conf     *Config
+	stack    *Node
+	dbs      []ethdb.Database
+	services map[string]*rollbackService
+	reports  chan []StartupEvent
+	gc       int
+}
+func newRollbackTest(t *testing.T, configure func(*Config)) *rollbackTest {
+	datadir, err := ioutil.TempDir("", "node-rollback-")
+	if err != nil {
+		t.Fatalf("failed to create temporary data directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(datadir) })
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate node key: %v", err)
+	}
+	gc := 50
+	rt := &rollbackTest{
+		t:        t,
+		services: make(map[string]*rollbackService),
+		reports:  make(chan []StartupEvent, 1),
+		gc:       100,
+	}
+	httpAddr := freeTCPAddr(t)
+	rt.conf = &Config{
+		Name:       "rollback",
+		DataDir:    datadir,
+		NoUSB:      true,
+		GCPercent:  &gc,
+		RPCPrebind: true,
+		HTTPHost:   httpAddr.IP.String(),
+		HTTPPort:   httpAddr.Port,
+		P2P: p2p.Config{
+			PrivateKey:  key,
+			ListenAddr:  freeTCPAddr(t).String(),
+			MaxPeers:    1,
+			NoDiscovery: true,
+		},
+		StartupProgress: func(ev StartupEvent) {
+			if ev.Stage == StartupFailed {
+				rt.reports <- rt.stack.StartupReport()
+			}
+		},
+	}
+	if configure != nil {
+		configure(rt.conf)
+	}
+	if rt.stack, err = New(rt.conf); err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	t.Cleanup(func() { rt.stack.Close() })
+	return rt
+}
+func freeTCPAddr(t *testing.T) *net.TCPAddr {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to reserve port: %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr)
+}
+func (rt *rollbackTest) register(instance string, constructErr, startErr error) {
+	err := rt.stack.RegisterInstance(instance, func(ctx *ServiceContext) (Service, error) {
+		if constructErr != nil {
+			return nil, constructErr
+		}
+		db, err := ctx.OpenDatabase("chaindata-"+instance, 0, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		if err := db.Put([]byte("key"), []byte("value")); err != nil {
+			return nil, err
+		}
+		rt.dbs = append(rt.dbs, db)
+		service := &rollbackService{startErr: startErr}
+		rt.services[instance] = service
+		return service, nil
+	})
+	if err != nil {
+		rt.t.Fatalf("failed to register service %q: %v", instance, err)
+	}
+}
+func (rt *rollbackTest) start(stage string, released ...string) *StartError {
+	rt.t.Helper()
+	debug.SetGCPercent(rt.gc)
+	defer debug.SetGCPercent(rt.gc)
+	err := rt.stack.Start()
+	if err == nil {
+		rt.t.Fatalf("node started, want failure during %s", stage)
+	}
+	failure, ok := err.(*StartError)
+	if !ok {
+		rt.t.Fatalf("start error type mismatch: have %T (%v), want *StartError", err, err)
+	}
+	if failure.Stage != stage {
+		rt.t.Fatalf("start error stage mismatch: have %q, want %q", failure.Stage, stage)
+	}
+	if rt.stack.Server() != nil {
+		rt.t.Errorf("p2p server retained after failed start")
+	}
+	for i, db := range rt.dbs {
+		if _, err := db.Get([]byte("key")); err == nil {
+			rt.t.Errorf("database %d still open after rollback", i)
+		}
+	}
+	rt.stack.dbLock.Lock()
+	if len(rt.stack.databases) != 0 || len(rt.stack.sharedDBs) != 0 {
+		rt.t.Errorf("database handles retained after rollback: %d handles, %d shared", len(rt.stack.databases), len(rt.stack.sharedDBs))
+	}
+	rt.stack.dbLock.Unlock()
+	lock, _, err := fileutil.Flock(filepath.Join(rt.conf.DataDir, rt.conf.Name, "LOCK"))
+	if err != nil {
+		rt.t.Errorf("datadir lock retained after rollback: %v", err)
+	} else {
+		lock.Release()
+	}
+	for _, addr := range released {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			rt.t.Errorf("listener on %s retained after rollback: %v", addr, err)
+			continue
+		}
+		listener.Close()
+	}
+	if have := debug.SetGCPercent(rt.gc); have != rt.gc {
+		rt.t.Errorf("GC percent not restored: have %d, want %d", have, rt.gc)
+	}
+	select {
+	case report := <-rt.reports:
+		if len(report) == 0 || report[len(report)-1].Stage != StartupFailed {
+			rt.t.Errorf("startup report does not end in failure: %v", report)
+		}
+	case <-time.After(5 * time.Second):
+		rt.t.Fatalf("startup failure not reported")
+	}
+	return failure
+}
+func (rt *rollbackTest) httpAddr() string {
+	return net.JoinHostPort(rt.conf.HTTPHost, strconv.Itoa(rt.conf.HTTPPort))
+}
+func checkServiceResults(t *testing.T, failure *StartError, want []*ServiceStartResult) {
+	t.Helper()
+	if len(failure.Services) != len(want) {
+		t.Fatalf("service result count mismatch: have %d, want %d", len(failure.Services), len(want))
+	}
+	for i, have := range failure.Services {
+		if have.Kind != want[i].Kind || have.Instance != want[i].Instance || have.Status != want[i].Status {
+			t.Errorf("service result %d mismatch: have %v/%q/%v, want %v/%q/%v", i, have.Kind, have.Instance, have.Status, want[i].Kind, want[i].Instance, want[i].Status)
+		}
+		if have.Err != want[i].Err {
+			t.Errorf("service result %d error mismatch: have %v, want %v", i, have.Err, want[i].Err)
+		}
+	}
+}
+func TestStartRollbackConstructFailure(t *testing.T) {
+	rt := newRollbackTest(t, nil)
+	constructErr := errors.New("construct failure")
+	rt.register("a", nil, nil)
+	rt.register("b", constructErr, nil)
+	failure := rt.start("construct", rt.httpAddr(), rt.conf.P2P.ListenAddr)
+	if err, ok := failure.Err.(*ServiceError); !ok || err.Op != "construct" || err.Instance != "b" || err.Err != constructErr {
+		t.Fatalf("start error cause mismatch: have %v, want construct failure of b", failure.Err)
+	}
+	checkServiceResults(t, failure, []*ServiceStartResult{
+		{Kind: rollbackServiceType, Instance: "a", Status: ServiceStatusConstructed},
+		{Instance: "b", Status: ServiceStatusFailed, Err: constructErr},
+	})
+	if rt.services["a"].started || rt.services["a"].stopped {
+		t.Errorf("constructed service was started or stopped")
+	}
+}
+func TestStartRollbackDuplicateService(t *testing.T) {
+	rt := newRollbackTest(t, nil)
+	rt.register("", nil, nil)
+	rt.register("", nil, nil)
+	failure := rt.start("construct", rt.httpAddr(), rt.conf.P2P.ListenAddr)
+	if err, ok := failure.Err.(*DuplicateServiceError); !ok || err.Kind != rollbackServiceType {
+		t.Fatalf("start error cause mismatch: have %v, want duplicate service", failure.Err)
+	}
+	checkServiceResults(t, failure, []*ServiceStartResult{
+		{Kind: rollbackServiceType, Status: ServiceStatusConstructed},
+		{Kind: rollbackServiceType, Status: ServiceStatusFailed, Err: failure.Err},
+	})
+}
+func TestStartRollbackP2PFailure(t *testing.T) {
+	occupied, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to occupy p2p port: %v", err)
+	}
+	defer occupied.Close()
+	rt := newRollbackTest(t, func(conf *Config) { conf.P2P.ListenAddr = occupied.Addr().String() })
+	rt.register("a", nil, nil)
+	failure := rt.start("p2p", rt.httpAddr())
+	checkServiceResults(t, failure, []*ServiceStartResult{
+		{Kind: rollbackServiceType, Instance: "a", Status: ServiceStatusConstructed},
+	})
+	if rt.services["a"].started {
+		t.Errorf("service started despite p2p failure")
+	}
+}
+func TestStartRollbackServiceStartFailure(t *testing.T) {
+	rt := newRollbackTest(t, nil)
+	startErr := errors.New("start failure")
+	rt.register("a", nil, nil)
+	rt.register("b", nil, startErr)
+	rt.register("c", nil, nil)
+	failure := rt.start("start", rt.httpAddr(), rt.conf.P2P.ListenAddr)
+	if err, ok := failure.Err.(*ServiceError); !ok || err.Op != "start" || err.Instance != "b" || err.Err != startErr {
+		t.Fatalf("start error cause mismatch: have %v, want start failure of b", failure.Err)
+	}
+	checkServiceResults(t, failure, []*ServiceStartResult{
+		{Kind: rollbackServiceType, Instance: "a", Status: ServiceStatusRolledBack},
+		{Kind: rollbackServiceType, Instance: "b", Status: ServiceStatusFailed, Err: startErr},
+		{Kind: rollbackServiceType, Instance: "c", Status: ServiceStatusConstructed},
+	})
+	if !rt.services["a"].stopped {
+		t.Errorf("started service not stopped during rollback")
+	}
+	if rt.services["b"].stopped || rt.services["c"].started {
+		t.Errorf("unstarted services touched during rollback")
+	}
+}
+func TestStartRollbackRPCFailure(t *testing.T) {
+	rt := newRollbackTest(t, func(conf *Config) {
+		conf.IPCPath = "rollback.ipc"
+		conf.IPCModules = []string{"nonexistent"}
+	})
+	rt.register("a", nil, nil)
+	rt.register("b", nil, nil)
+	failure := rt.start("rpc", rt.httpAddr(), rt.conf.P2P.ListenAddr)
+	if _, ok := failure.Err.(*ErrInvalidWhitelist); !ok {
+		t.Fatalf("start error cause mismatch: have %v, want invalid whitelist", failure.Err)
+	}
+	checkServiceResults(t, failure, []*ServiceStartResult{
+		{Kind: rollbackServiceType, Instance: "a", Status: ServiceStatusRolledBack},
+		{Kind: rollbackServiceType, Instance: "b", Status: ServiceStatusRolledBack},
+	})
+	for instance, service := range rt.services {
+		if !service.stopped {
+			t.Errorf("service %q not stopped during rollback", instance)
+		}
+	}
+	if _, err := os.Stat(rt.conf.IPCEndpoint()); err == nil {
+		t.Errorf("IPC endpoint left behind after rollback")
+	}
+}
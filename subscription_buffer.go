@@ -0,0 +1,162 @@
+package node
+import (
+	"sync"
+	"sync/atomic"
+	"github.com/Cryptochain-VON/metrics"
+	"github.com/Cryptochain-VON/rpc"
+)
+const (
+	DefaultSubscriptionBufferSize = 256
+	SubscriptionDropOldest        = "drop-oldest"
+	SubscriptionDisconnect        = "disconnect"
+)
+var (
+	subscriptionDroppedMeter      = metrics.NewRegisteredMeter("rpc/subscriptions/dropped", nil)
+	subscriptionDisconnectedMeter = metrics.NewRegisteredMeter("rpc/subscriptions/disconnected", nil)
+)
+type SubscriptionEnd struct {
+	Error string `json:"error"`
+}
+type SubscriptionStats struct {
+	Active       int64 `json:"active"`
+	Dropped      int64 `json:"dropped"`
+	Disconnected int64 `json:"disconnected"`
+}
+type subscriptionCounters struct {
+	active       int64
+	dropped      int64
+	disconnected int64
+}
+type SubscriptionBuffer struct {
+	notifier *rpc.Notifier
+	sub      *rpc.Subscription
+	size     int
+	policy   string
+	counters *subscriptionCounters
+	conns    *rpcSubscriptionConns
+	lock     sync.Mutex
+	queue    []interface{}
+	ending   bool
+	wake     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+func (n *Node) NewSubscriptionBuffer(notifier *rpc.Notifier, sub *rpc.Subscription) *SubscriptionBuffer {
+	return newSubscriptionBuffer(n.config, &n.subCounters, n.rpcSubs, notifier, sub)
+}
+func newSubscriptionBuffer(conf *Config, counters *subscriptionCounters, conns *rpcSubscriptionConns, notifier *rpc.Notifier, sub *rpc.Subscription) *SubscriptionBuffer {
+	b := &SubscriptionBuffer{
+		notifier: notifier,
+		sub:      sub,
+		size:     conf.SubscriptionBufferSize,
+		policy:   conf.SubscriptionOverflowPolicy,
+		counters: counters,
+		conns:    conns,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	if b.size <= 0 {
+		b.size = DefaultSubscriptionBufferSize
+	}
+	if b.policy == "" {
+		b.policy = SubscriptionDropOldest
+	}
+	atomic.AddInt64(&b.counters.active, 1)
+	go b.loop()
+	return b
+}
+func (b *SubscriptionBuffer) Send(data interface{}) bool {
+	b.lock.Lock()
+	select {
+	case <-b.done:
+		b.lock.Unlock()
+		return false
+	default:
+	}
+	if b.ending {
+		b.lock.Unlock()
+		return false
+	}
+	if len(b.queue) >= b.size {
+		if b.policy == SubscriptionDisconnect {
+			b.lock.Unlock()
+			subscriptionDisconnectedMeter.Mark(1)
+			atomic.AddInt64(&b.counters.disconnected, 1)
+			b.close()
+			b.conns.drop(string(b.sub.ID))
+			return false
+		}
+		b.queue = b.queue[1:]
+		subscriptionDroppedMeter.Mark(1)
+		atomic.AddInt64(&b.counters.dropped, 1)
+	}
+	b.queue = append(b.queue, data)
+	b.lock.Unlock()
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+	return true
+}
+func (b *SubscriptionBuffer) End(err error) {
+	b.lock.Lock()
+	if b.ending {
+		b.lock.Unlock()
+		return
+	}
+	b.ending = true
+	b.queue = append(b.queue, &SubscriptionEnd{Error: err.Error()})
+	b.lock.Unlock()
+	select {
+	case b.wake <- struct{}{}:
+	default:
+	}
+}
+func (b *SubscriptionBuffer) Done() <-chan struct{} {
+	return b.done
+}
+func (b *SubscriptionBuffer) close() {
+	b.once.Do(func() {
+		close(b.done)
+		atomic.AddInt64(&b.counters.active, -1)
+	})
+}
+func (b *SubscriptionBuffer) loop() {
+	defer b.close()
+	for {
+		select {
+		case <-b.wake:
+			for {
+				b.lock.Lock()
+				if len(b.queue) == 0 {
+					ending := b.ending
+					b.lock.Unlock()
+					if ending {
+						return
+					}
+					break
+				}
+				data := b.queue[0]
+				b.queue[0] = nil
+				b.queue = b.queue[1:]
+				b.lock.Unlock()
+				if err := b.notifier.Notify(b.sub.ID, data); err != nil {
+					return
+				}
+			}
+		case <-b.sub.Err():
+			return
+		case <-b.notifier.Closed():
+			return
+		case <-b.done:
+			return
+		}
+	}
+}
+func (n *Node) SubscriptionStats() SubscriptionStats {
+	return SubscriptionStats{
+		Active:       atomic.LoadInt64(&n.subCounters.active),
+		Dropped:      atomic.LoadInt64(&n.subCounters.dropped),
+		Disconnected: atomic.LoadInt64(&n.subCounters.disconnected),
+	}
+}
@@ -0,0 +1,27 @@
+package node
+import (
+	"crypto/tls"
+	"errors"
+)
+func loadTLSConfig(endpoint, certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, &ErrTLSConfig{Endpoint: endpoint, Err: errors.New("both certificate and key file must be set")}
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, &ErrTLSConfig{Endpoint: endpoint, Err: err}
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+func (n *Node) serverTLSConfig(endpoint, certFile, keyFile string) (*tls.Config, error) {
+	tlsConfig, err := loadTLSConfig(endpoint, certFile, keyFile)
+	if err != nil || tlsConfig == nil || n.clientCAs == nil {
+		return tlsConfig, err
+	}
+	tlsConfig.ClientCAs = n.clientCAs
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
@@ -0,0 +1,266 @@
+package node
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/log"
+)
+const (
+	datadirUsage          = "rpc-usage.json"
+	usageSaveInterval     = 5 * time.Minute
+	usageMaxEntries       = 10000
+	usageKeyPrefix        = "apikey:"
+	DefaultQuotaKeyHeader = "X-API-Key"
+)
+type UsageEntry struct {
+	Identity  string    `json:"identity"`
+	Hour      time.Time `json:"hour"`
+	HourCount uint64    `json:"hourCount"`
+	Day       time.Time `json:"day"`
+	DayCount  uint64    `json:"dayCount"`
+	Total     uint64    `json:"total"`
+	Rejected  uint64    `json:"rejected"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+type usageTracker struct {
+	keyBy   string
+	header  string
+	hourly  uint64
+	daily   uint64
+	path    string
+	clock   Clock
+	log     log.Logger
+	lock    sync.Mutex
+	entries map[string]*UsageEntry
+	dirty   bool
+	quit    chan struct{}
+	wg      sync.WaitGroup
+}
+func newUsageTracker(conf *Config, clock Clock, logger log.Logger) *usageTracker {
+	if !conf.RPCUsageAccounting && conf.RPCQuotaHourly == 0 && conf.RPCQuotaDaily == 0 {
+		return nil
+	}
+	t := &usageTracker{
+		keyBy:   conf.RPCQuotaKey,
+		header:  conf.RPCQuotaKeyHeader,
+		hourly:  conf.RPCQuotaHourly,
+		daily:   conf.RPCQuotaDaily,
+		path:    conf.ResolvePath(datadirUsage),
+		clock:   clock,
+		log:     logger,
+		entries: make(map[string]*UsageEntry),
+	}
+	if t.header == "" {
+		t.header = DefaultQuotaKeyHeader
+	}
+	if t.path != "" {
+		if blob, err := ioutil.ReadFile(t.path); err == nil {
+			var entries []*UsageEntry
+			if err := json.Unmarshal(blob, &entries); err != nil {
+				logger.Warn("Discarding corrupt RPC usage file", "path", t.path, "err", err)
+			}
+			for _, e := range entries {
+				if key := strings.TrimPrefix(e.Identity, usageKeyPrefix); key != e.Identity && len(key) != 16 {
+					e.Identity = usageKeyPrefix + fingerprintKey(key)
+				}
+				t.entries[e.Identity] = e
+			}
+		}
+	}
+	return t
+}
+func (t *usageTracker) identity(r *http.Request) string {
+	switch t.keyBy {
+	case "origin":
+		if origin := r.Header.Get("Origin"); origin != "" {
+			return "origin:" + origin
+		}
+	case "apikey":
+		if key := r.Header.Get(t.header); key != "" && authSubject(r) != "" {
+			return usageKeyPrefix + fingerprintKey(key)
+		}
+	case "auth":
+		if subject := authSubject(r); subject != "" {
+			return "auth:" + subject
+		}
+	case "cert":
+		if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+			return "cert:" + r.TLS.PeerCertificates[0].Subject.String()
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+func fingerprintKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+func (t *usageTracker) admit(id string, calls int) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	now := t.clock.Now().UTC()
+	hour, day := now.Truncate(time.Hour), now.Truncate(24*time.Hour)
+	e, ok := t.entries[id]
+	if !ok {
+		if len(t.entries) >= usageMaxEntries {
+			t.evictOldest()
+		}
+		e = &UsageEntry{Identity: id}
+		t.entries[id] = e
+	}
+	if !e.Hour.Equal(hour) {
+		e.Hour, e.HourCount = hour, 0
+	}
+	if !e.Day.Equal(day) {
+		e.Day, e.DayCount = day, 0
+	}
+	e.LastSeen = now
+	t.dirty = true
+	n := uint64(calls)
+	switch {
+	case t.hourly > 0 && e.HourCount+n > t.hourly:
+		e.Rejected += n
+		return &RequestQuotaError{Period: "hourly", Limit: t.hourly}
+	case t.daily > 0 && e.DayCount+n > t.daily:
+		e.Rejected += n
+		return &RequestQuotaError{Period: "daily", Limit: t.daily}
+	}
+	e.HourCount += n
+	e.DayCount += n
+	e.Total += n
+	return nil
+}
+func (t *usageTracker) evictOldest() {
+	var oldest *UsageEntry
+	for _, e := range t.entries {
+		if oldest == nil || e.LastSeen.Before(oldest.LastSeen) {
+			oldest = e
+		}
+	}
+	if oldest != nil {
+		delete(t.entries, oldest.Identity)
+	}
+}
+func (t *usageTracker) report() []UsageEntry {
+	report := []UsageEntry{}
+	if t == nil {
+		return report
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for _, e := range t.entries {
+		report = append(report, *e)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Total > report[j].Total })
+	return report
+}
+func (t *usageTracker) start() {
+	if t == nil || t.path == "" {
+		return
+	}
+	t.quit = make(chan struct{})
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+		ticker := t.clock.NewTicker(usageSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				t.save()
+			case <-t.quit:
+				return
+			}
+		}
+	}()
+}
+func (t *usageTracker) stop() {
+	if t == nil || t.quit == nil {
+		return
+	}
+	close(t.quit)
+	t.wg.Wait()
+	t.quit = nil
+	t.save()
+}
+func (t *usageTracker) save() {
+	t.lock.Lock()
+	if !t.dirty {
+		t.lock.Unlock()
+		return
+	}
+	entries := make([]*UsageEntry, 0, len(t.entries))
+	for _, e := range t.entries {
+		entry := *e
+		entries = append(entries, &entry)
+	}
+	t.dirty = false
+	t.lock.Unlock()
+	blob, err := json.Marshal(entries)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(t.path), 0700)
+	}
+	if err == nil {
+		err = ioutil.WriteFile(t.path+".tmp", blob, 0600)
+	}
+	if err == nil {
+		err = os.Rename(t.path+".tmp", t.path)
+	}
+	if err != nil {
+		t.log.Warn("Failed to persist RPC usage", "path", t.path, "err", err)
+	}
+}
+func newQuotaHandler(t *usageTracker, next http.Handler, writeErr HTTPErrorWriter) http.Handler {
+	if t == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions || isWebsocket(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		calls := 1
+		if r.Method == http.MethodPost {
+			body, err := ioutil.ReadAll(r.Body)
+			r.Body.Close()
+			if err != nil {
+				writeErr(w, r, bodyReadStatus(err), err.Error())
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			calls = countRPCCalls(body)
+		}
+		if err := t.admit(t.identity(r), calls); err != nil {
+			writeErr(w, r, http.StatusTooManyRequests, err.Error())
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+func countRPCCalls(body []byte) int {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return 1
+	}
+	var batch []json.RawMessage
+	if json.Unmarshal(trimmed, &batch) != nil || len(batch) == 0 {
+		return 1
+	}
+	return len(batch)
+}
+func (n *Node) UsageReport() []UsageEntry {
+	return n.usage.report()
+}
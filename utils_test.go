@@ -0,0 +1,50 @@
+package node
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"github.com/Cryptochain-VON/crypto"
+	"github.com/Cryptochain-VON/p2p"
+	"github.com/Cryptochain-VON/rpc"
+)
+var testNodeKey, _ = crypto.GenerateKey()
+func testNodeConfig() *Config {
+	return &Config{
+		Name: "test node",
+		P2P:  p2p.Config{PrivateKey: testNodeKey},
+	}
+}
+func testDataDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "node-test-")
+	if err != nil {
+		t.Fatalf("failed to create temporary data directory: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+func startTestNode(t *testing.T, conf *Config, services ...ServiceConstructor) *Node {
+	stack, err := New(conf)
+	if err != nil {
+		t.Fatalf("failed to create protocol stack: %v", err)
+	}
+	t.Cleanup(func() { stack.Close() })
+	for _, constructor := range services {
+		if err := stack.Register(constructor); err != nil {
+			t.Fatalf("failed to register service: %v", err)
+		}
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start protocol stack: %v", err)
+	}
+	return stack
+}
+type APIService struct {
+	apis []rpc.API
+}
+func NewAPIService(apis ...rpc.API) ServiceConstructor {
+	return func(*ServiceContext) (Service, error) { return &APIService{apis: apis}, nil }
+}
+func (s *APIService) Protocols() []p2p.Protocol { return nil }
+func (s *APIService) APIs() []rpc.API           { return s.apis }
+func (s *APIService) Start(*p2p.Server) error   { return nil }
+func (s *APIService) Stop() error               { return nil }
@@ -0,0 +1,168 @@
+package node
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"github.com/Cryptochain-VON/log"
+	"github.com/Cryptochain-VON/p2p"
+)
+const (
+	WebhookPeerAdd      = "peer-add"
+	WebhookPeerDrop     = "peer-drop"
+	WebhookNodeStarted  = "node-started"
+	WebhookNodeStopping = "node-stopping"
+	webhookQueueSize    = 64
+	webhookTimeout      = 5 * time.Second
+)
+type WebhookConfig struct {
+	URL        string   `toml:",omitempty"`
+	AuthHeader string   `toml:",omitempty"`
+	AuthValue  string   `toml:",omitempty" secret:"true"`
+	Events     []string `toml:",omitempty"`
+}
+type WebhookEvent struct {
+	Type string      `json:"type"`
+	Time time.Time   `json:"time"`
+	Node string      `json:"node"`
+	Data interface{} `json:"data,omitempty"`
+}
+type webhookSink struct {
+	conf   WebhookConfig
+	filter map[string]bool
+	queue  chan []byte
+}
+func (s *webhookSink) wants(typ string) bool {
+	return len(s.filter) == 0 || s.filter[typ]
+}
+func (s *webhookSink) post(ctx context.Context, client *http.Client, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodPost, s.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if s.conf.AuthHeader != "" {
+		req.Header.Set(s.conf.AuthHeader, s.conf.AuthValue)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+type webhookDispatcher struct {
+	sinks  []*webhookSink
+	node   string
+	clock  Clock
+	log    log.Logger
+	client *http.Client
+	ctx    context.Context
+	cancel context.CancelFunc
+	quit   chan struct{}
+	wg     sync.WaitGroup
+}
+func newWebhookDispatcher(hooks []WebhookConfig, node string, clock Clock, logger log.Logger) *webhookDispatcher {
+	if len(hooks) == 0 {
+		return nil
+	}
+	d := &webhookDispatcher{node: node, clock: clock, log: logger, client: new(http.Client), quit: make(chan struct{})}
+	d.ctx, d.cancel = context.WithCancel(context.Background())
+	for _, hook := range hooks {
+		sink := &webhookSink{conf: hook, filter: make(map[string]bool), queue: make(chan []byte, webhookQueueSize)}
+		for _, typ := range hook.Events {
+			sink.filter[typ] = true
+		}
+		d.sinks = append(d.sinks, sink)
+	}
+	return d
+}
+func (d *webhookDispatcher) start(server *p2p.Server) {
+	for _, sink := range d.sinks {
+		d.wg.Add(1)
+		go d.deliver(sink)
+	}
+	events := make(chan *p2p.PeerEvent, 64)
+	sub := server.SubscribeEvents(events)
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case ev := <-events:
+				switch ev.Type {
+				case p2p.PeerEventTypeAdd:
+					d.emit(WebhookPeerAdd, ev)
+				case p2p.PeerEventTypeDrop:
+					d.emit(WebhookPeerDrop, ev)
+				}
+			case <-sub.Err():
+				return
+			case <-d.quit:
+				return
+			}
+		}
+	}()
+}
+func (d *webhookDispatcher) deliver(sink *webhookSink) {
+	defer d.wg.Done()
+	for {
+		select {
+		case body := <-sink.queue:
+			if err := sink.post(d.ctx, d.client, body); err != nil {
+				d.log.Warn("Webhook delivery failed", "url", sink.conf.URL, "err", err)
+			}
+		case <-d.quit:
+			for {
+				select {
+				case body := <-sink.queue:
+					if err := sink.post(d.ctx, d.client, body); err != nil {
+						d.log.Debug("Webhook delivery failed during shutdown", "url", sink.conf.URL, "err", err)
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+func (d *webhookDispatcher) emit(typ string, data interface{}) {
+	if d == nil {
+		return
+	}
+	body, err := json.Marshal(WebhookEvent{Type: typ, Time: d.clock.Now(), Node: d.node, Data: data})
+	if err != nil {
+		d.log.Warn("Failed to encode webhook event", "type", typ, "err", err)
+		return
+	}
+	for _, sink := range d.sinks {
+		if !sink.wants(typ) {
+			continue
+		}
+		select {
+		case sink.queue <- body:
+		default:
+			d.log.Warn("Webhook queue full, dropping event", "url", sink.conf.URL, "type", typ)
+		}
+	}
+}
+func (d *webhookDispatcher) stop() {
+	if d == nil {
+		return
+	}
+	close(d.quit)
+	timer := time.AfterFunc(webhookTimeout, d.cancel)
+	d.wg.Wait()
+	timer.Stop()
+	d.cancel()
+}
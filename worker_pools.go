@@ -0,0 +1,188 @@
+package node
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+type WorkerPoolStats struct {
+	Size      int           `json:"size"`
+	Active    int           `json:"active"`
+	Queued    int           `json:"queued"`
+	Completed uint64        `json:"completed"`
+	Rejected  uint64        `json:"rejected"`
+	AvgWait   time.Duration `json:"avgWait"`
+}
+type workerPool struct {
+	slots     chan struct{}
+	lock      sync.Mutex
+	queued    int
+	completed uint64
+	rejected  uint64
+	waited    time.Duration
+}
+type rpcWorkerPools struct {
+	maxQueue int
+	pools    map[string]*workerPool
+}
+func newRPCWorkerPools(sizes map[string]int, maxQueue int) *rpcWorkerPools {
+	if len(sizes) == 0 {
+		return nil
+	}
+	p := &rpcWorkerPools{maxQueue: maxQueue, pools: make(map[string]*workerPool)}
+	for namespace, size := range sizes {
+		if size > 0 {
+			p.pools[namespace] = &workerPool{slots: make(chan struct{}, size)}
+		}
+	}
+	return p
+}
+func (p *rpcWorkerPools) acquire(namespace string, done <-chan struct{}) (func(), bool) {
+	pool := p.pools[namespace]
+	pool.lock.Lock()
+	if p.maxQueue > 0 && pool.queued >= p.maxQueue && len(pool.slots) == cap(pool.slots) {
+		pool.rejected++
+		pool.lock.Unlock()
+		return nil, false
+	}
+	pool.queued++
+	pool.lock.Unlock()
+	start := time.Now()
+	select {
+	case pool.slots <- struct{}{}:
+	case <-done:
+		pool.lock.Lock()
+		pool.queued--
+		pool.lock.Unlock()
+		return nil, false
+	}
+	pool.lock.Lock()
+	pool.queued--
+	pool.waited += time.Since(start)
+	pool.lock.Unlock()
+	return func() {
+		<-pool.slots
+		pool.lock.Lock()
+		pool.completed++
+		pool.lock.Unlock()
+	}, true
+}
+func (p *rpcWorkerPools) stats() map[string]WorkerPoolStats {
+	stats := make(map[string]WorkerPoolStats)
+	if p == nil {
+		return stats
+	}
+	for namespace, pool := range p.pools {
+		pool.lock.Lock()
+		s := WorkerPoolStats{
+			Size:      cap(pool.slots),
+			Active:    len(pool.slots),
+			Queued:    pool.queued,
+			Completed: pool.completed,
+			Rejected:  pool.rejected,
+		}
+		if pool.completed > 0 {
+			s.AvgWait = pool.waited / time.Duration(pool.completed)
+		}
+		pool.lock.Unlock()
+		stats[namespace] = s
+	}
+	return stats
+}
+func (p *rpcWorkerPools) pooled(method string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	namespace := method
+	if i := strings.IndexByte(namespace, '_'); i >= 0 {
+		namespace = namespace[:i]
+	}
+	_, ok := p.pools[namespace]
+	return namespace, ok
+}
+func (p *rpcWorkerPools) namespaces(body []byte) []string {
+	var calls []struct {
+		Method string `json:"method"`
+	}
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &calls); err != nil {
+			return nil
+		}
+	} else {
+		calls = append(calls, struct {
+			Method string `json:"method"`
+		}{})
+		if err := json.Unmarshal(trimmed, &calls[0]); err != nil {
+			return nil
+		}
+	}
+	seen := make(map[string]bool)
+	var namespaces []string
+	for _, call := range calls {
+		if namespace, pooled := p.pooled(call.Method); pooled && !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+func newWorkerPoolHandler(pools *rpcWorkerPools, next http.Handler, writeErr HTTPErrorWriter) http.Handler {
+	if pools == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || isWebsocket(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			writeErr(w, r, bodyReadStatus(err), err.Error())
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		var releases []func()
+		defer func() {
+			for _, release := range releases {
+				release()
+			}
+		}()
+		for _, namespace := range pools.namespaces(body) {
+			release, ok := pools.acquire(namespace, r.Context().Done())
+			if !ok {
+				writeErr(w, r, http.StatusServiceUnavailable, (&WorkerPoolSaturatedError{Namespace: namespace}).Error())
+				return
+			}
+			releases = append(releases, release)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+func newNamespacePoolHandler(pools *rpcWorkerPools, namespace string, next http.Handler, writeErr HTTPErrorWriter) http.Handler {
+	if _, ok := pools.pooled(namespace); !ok {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+		release, ok := pools.acquire(namespace, r.Context().Done())
+		if !ok {
+			writeErr(w, r, http.StatusServiceUnavailable, (&WorkerPoolSaturatedError{Namespace: namespace}).Error())
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
+func (n *Node) RPCStats() map[string]WorkerPoolStats {
+	return n.rpcPools.stats()
+}
@@ -0,0 +1,238 @@
+package node
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+type WSClientInfo struct {
+	ID            string    `json:"id"`
+	RemoteAddr    string    `json:"remoteAddr"`
+	Origin        string    `json:"origin,omitempty"`
+	Identity      string    `json:"identity,omitempty"`
+	UserAgent     string    `json:"userAgent,omitempty"`
+	Connected     time.Time `json:"connected"`
+	Subscriptions int       `json:"subscriptions"`
+	MessagesIn    uint64    `json:"messagesIn"`
+	MessagesOut   uint64    `json:"messagesOut"`
+	BytesIn       uint64    `json:"bytesIn"`
+	BytesOut      uint64    `json:"bytesOut"`
+	InRate        float64   `json:"inRate"`
+	OutRate       float64   `json:"outRate"`
+}
+type wsClientRegistry struct {
+	clock          Clock
+	identityHeader string
+	lock           sync.Mutex
+	nextID         uint64
+	clients        map[string]*wsClientConn
+}
+func newWSClientRegistry(clock Clock, identityHeader string) *wsClientRegistry {
+	return &wsClientRegistry{clock: clock, identityHeader: identityHeader, clients: make(map[string]*wsClientConn)}
+}
+type wsClientKey struct{}
+func (reg *wsClientRegistry) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hw := &clientHijackWriter{ResponseWriter: w, reg: reg, req: r}
+		next.ServeHTTP(hw, r.WithContext(context.WithValue(r.Context(), wsClientKey{}, hw)))
+	})
+}
+func wsClientFromRequest(r *http.Request) *wsClientConn {
+	if hw, ok := r.Context().Value(wsClientKey{}).(*clientHijackWriter); ok {
+		return hw.conn
+	}
+	return nil
+}
+func (reg *wsClientRegistry) identity(r *http.Request) string {
+	if subject := authSubject(r); subject != "" {
+		return subject
+	}
+	if reg.identityHeader != "" {
+		if id := r.Header.Get(reg.identityHeader); id != "" {
+			return id
+		}
+	}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return r.TLS.PeerCertificates[0].Subject.String()
+	}
+	return ""
+}
+func (reg *wsClientRegistry) track(conn net.Conn, r *http.Request) *wsClientConn {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	reg.nextID++
+	now := reg.clock.Now()
+	c := &wsClientConn{
+		Conn: conn,
+		reg:  reg,
+		info: WSClientInfo{
+			ID:         fmt.Sprintf("ws-%d", reg.nextID),
+			RemoteAddr: r.RemoteAddr,
+			Origin:     r.Header.Get("Origin"),
+			Identity:   reg.identity(r),
+			UserAgent:  r.UserAgent(),
+			Connected:  now,
+		},
+		inRate:  rateWindow{start: now},
+		outRate: rateWindow{start: now},
+	}
+	reg.clients[c.info.ID] = c
+	return c
+}
+func (reg *wsClientRegistry) untrack(id string) {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	delete(reg.clients, id)
+}
+func (reg *wsClientRegistry) active() int {
+	if reg == nil {
+		return 0
+	}
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	return len(reg.clients)
+}
+func (reg *wsClientRegistry) list() []WSClientInfo {
+	reg.lock.Lock()
+	conns := make([]*wsClientConn, 0, len(reg.clients))
+	for _, c := range reg.clients {
+		conns = append(conns, c)
+	}
+	reg.lock.Unlock()
+	now := reg.clock.Now()
+	infos := make([]WSClientInfo, 0, len(conns))
+	for _, c := range conns {
+		infos = append(infos, c.snapshot(now))
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Connected.Before(infos[j].Connected) })
+	return infos
+}
+func (reg *wsClientRegistry) disconnect(id string) error {
+	reg.lock.Lock()
+	c, ok := reg.clients[id]
+	reg.lock.Unlock()
+	if !ok {
+		return ErrWSClientUnknown
+	}
+	return c.Conn.Close()
+}
+type clientHijackWriter struct {
+	http.ResponseWriter
+	reg  *wsClientRegistry
+	req  *http.Request
+	conn *wsClientConn
+}
+func (w *clientHijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("connection does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	w.conn = w.reg.track(conn, w.req)
+	return w.conn, rw, nil
+}
+type rateWindow struct {
+	start time.Time
+	cur   uint64
+	prev  uint64
+}
+func (rw *rateWindow) roll(now time.Time) {
+	switch elapsed := now.Sub(rw.start); {
+	case elapsed >= 2*time.Minute:
+		rw.prev, rw.cur = 0, 0
+		rw.start = now
+	case elapsed >= time.Minute:
+		rw.prev, rw.cur = rw.cur, 0
+		rw.start = rw.start.Add(time.Minute)
+	}
+}
+func (rw *rateWindow) add(now time.Time, n uint64) {
+	rw.roll(now)
+	rw.cur += n
+}
+func (rw *rateWindow) rate(now time.Time) float64 {
+	rw.roll(now)
+	weight := 1 - float64(now.Sub(rw.start))/float64(time.Minute)
+	return (float64(rw.prev)*weight + float64(rw.cur)) / 60
+}
+type wsClientConn struct {
+	net.Conn
+	reg     *wsClientRegistry
+	once    sync.Once
+	lock    sync.Mutex
+	info    WSClientInfo
+	inRate  rateWindow
+	outRate rateWindow
+}
+func (c *wsClientConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.lock.Lock()
+		c.info.BytesIn += uint64(n)
+		c.lock.Unlock()
+	}
+	return n, err
+}
+func (c *wsClientConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.lock.Lock()
+		c.info.BytesOut += uint64(n)
+		c.lock.Unlock()
+	}
+	return n, err
+}
+func (c *wsClientConn) messageIn() {
+	if c == nil {
+		return
+	}
+	now := c.reg.clock.Now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.info.MessagesIn++
+	c.inRate.add(now, 1)
+}
+func (c *wsClientConn) messageOut() {
+	if c == nil {
+		return
+	}
+	now := c.reg.clock.Now()
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.info.MessagesOut++
+	c.outRate.add(now, 1)
+}
+func (c *wsClientConn) setSubscriptions(n int) {
+	if c == nil {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.info.Subscriptions = n
+}
+func (c *wsClientConn) snapshot(now time.Time) WSClientInfo {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	info := c.info
+	info.InRate = c.inRate.rate(now)
+	info.OutRate = c.outRate.rate(now)
+	return info
+}
+func (c *wsClientConn) Close() error {
+	c.once.Do(func() { c.reg.untrack(c.info.ID) })
+	return c.Conn.Close()
+}
+func (n *Node) WSClients() []WSClientInfo {
+	return n.wsClients.list()
+}
+func (n *Node) DisconnectWSClient(id string) error {
+	return n.wsClients.disconnect(id)
+}
@@ -0,0 +1,58 @@
+package node
+import (
+	"net"
+	"net/http"
+	"sync"
+)
+type wsSubscriptionQuota struct {
+	perConn        int
+	perClient      int
+	identityHeader string
+	lock           sync.Mutex
+	clients        map[string]int
+}
+func newWSSubscriptionQuota(perConn, perClient int, identityHeader string) *wsSubscriptionQuota {
+	if perConn <= 0 && perClient <= 0 {
+		return nil
+	}
+	return &wsSubscriptionQuota{
+		perConn:        perConn,
+		perClient:      perClient,
+		identityHeader: identityHeader,
+		clients:        make(map[string]int),
+	}
+}
+func (q *wsSubscriptionQuota) identity(r *http.Request) string {
+	if q == nil {
+		return ""
+	}
+	if q.identityHeader != "" {
+		if id := r.Header.Get(q.identityHeader); id != "" {
+			return id
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+func (q *wsSubscriptionQuota) acquire(client string, active int) *SubscriptionQuotaError {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.perConn > 0 && active >= q.perConn {
+		return &SubscriptionQuotaError{Scope: "connection", Limit: q.perConn}
+	}
+	if q.perClient > 0 && q.clients[client] >= q.perClient {
+		return &SubscriptionQuotaError{Scope: "client", Limit: q.perClient}
+	}
+	q.clients[client]++
+	return nil
+}
+func (q *wsSubscriptionQuota) release(client string, n int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if q.clients[client] -= n; q.clients[client] <= 0 {
+		delete(q.clients, client)
+	}
+}